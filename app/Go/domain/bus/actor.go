@@ -0,0 +1,22 @@
+package bus
+
+import (
+	"context"
+)
+
+// SystemActor is used by the trusted callers such as the administrative CLI.
+const SystemActor = "system"
+
+type actorKey struct{}
+
+// WithActor stores the ID of the user or service on behalf of which the messages are dispatched.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in the context, empty string for anonymous callers.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+
+	return actor
+}
@@ -0,0 +1,68 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Message is a command or a query dispatched through a bus.
+type Message interface {
+	// MessageName identifies the handler of the message.
+	MessageName() string
+}
+
+// Handler processes the message and returns its result.
+type Handler func(ctx context.Context, msg Message) (interface{}, error)
+
+// Middleware wraps the handlers to add cross-cutting behaviour such as logging or transactions.
+type Middleware func(next Handler) Handler
+
+// HandlerNotFound signifies there is no handler registered for the message.
+type HandlerNotFound struct {
+	MessageName string
+}
+
+func (err HandlerNotFound) Error() string {
+	return fmt.Sprintf("No handler registered for %s", err.MessageName)
+}
+
+// Bus dispatches the messages to their handlers through the middlewares, safe for concurrent use.
+type Bus struct {
+	mu          sync.RWMutex
+	handlers    map[string]Handler
+	middlewares []Middleware
+}
+
+// New bus with the given middlewares, the first middleware is the outermost one.
+func New(middlewares ...Middleware) *Bus {
+	return &Bus{
+		handlers:    map[string]Handler{},
+		middlewares: middlewares,
+	}
+}
+
+// Register the handler for the messages with the same name as the given one.
+func (b *Bus) Register(msg Message, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		handler = b.middlewares[i](handler)
+	}
+
+	b.handlers[msg.MessageName()] = handler
+}
+
+// Dispatch the message to its handler.
+func (b *Bus) Dispatch(ctx context.Context, msg Message) (interface{}, error) {
+	b.mu.RLock()
+	handler, ok := b.handlers[msg.MessageName()]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, HandlerNotFound{MessageName: msg.MessageName()}
+	}
+
+	return handler(ctx, msg)
+}
@@ -0,0 +1,120 @@
+package bus_test
+
+import (
+	"context"
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/bus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type greet struct {
+	Name string `json:"name"`
+}
+
+func (m greet) MessageName() string {
+	return "greet"
+}
+
+func (m greet) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required),
+	)
+}
+
+func handleGreet(ctx context.Context, msg bus.Message) (interface{}, error) {
+	return "Hello " + msg.(greet).Name, nil
+}
+
+var _ = Describe("Bus", func() {
+	ctx := context.Background()
+
+	When("a message is dispatched", func() {
+		Specify("the result of its handler is returned", func() {
+			b := bus.New()
+			b.Register(greet{}, handleGreet)
+
+			result, err := b.Dispatch(ctx, greet{Name: "world"})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal("Hello world"))
+		})
+
+		Specify("the middlewares are run in the registration order", func() {
+			var calls []string
+			trace := func(name string) bus.Middleware {
+				return func(next bus.Handler) bus.Handler {
+					return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+						calls = append(calls, name)
+						return next(ctx, msg)
+					}
+				}
+			}
+
+			b := bus.New(trace("outer"), trace("inner"))
+			b.Register(greet{}, handleGreet)
+
+			_, err := b.Dispatch(ctx, greet{Name: "world"})
+
+			Expect(err).To(BeNil())
+			Expect(calls).To(Equal([]string{"outer", "inner"}))
+		})
+	})
+
+	When("no handler is registered for the message", func() {
+		Specify("a handler not found error is returned", func() {
+			_, err := bus.New().Dispatch(ctx, greet{Name: "world"})
+
+			Expect(errors.As(err, &bus.HandlerNotFound{})).To(BeTrue())
+		})
+	})
+
+	When("the message is invalid", func() {
+		Specify("the validation errors are returned", func() {
+			b := bus.New(bus.Validation())
+			b.Register(greet{}, handleGreet)
+
+			_, err := b.Dispatch(ctx, greet{})
+
+			Expect(err).To(MatchError("name: cannot be blank."))
+		})
+	})
+
+	When("the actor is not authorized", func() {
+		Specify("a forbidden error is returned", func() {
+			b := bus.New(bus.Authorization(func(ctx context.Context, msg bus.Message) bool {
+				return bus.ActorFromContext(ctx) == bus.SystemActor
+			}))
+			b.Register(greet{}, handleGreet)
+
+			_, err := b.Dispatch(bus.WithActor(ctx, "someone"), greet{Name: "world"})
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+
+			_, err = b.Dispatch(bus.WithActor(ctx, bus.SystemActor), greet{Name: "world"})
+			Expect(err).To(BeNil())
+		})
+	})
+
+	When("the message is logged", func() {
+		Specify("it is logged to the logger of its context", func() {
+			core, logs := observer.New(zap.DebugLevel)
+			type loggerKey struct{}
+			loggerCtx := context.WithValue(ctx, loggerKey{}, zap.New(core).Sugar().With("request_id", "request-1"))
+
+			b := bus.New(bus.ContextLogging(func(ctx context.Context) *zap.SugaredLogger {
+				return ctx.Value(loggerKey{}).(*zap.SugaredLogger)
+			}))
+			b.Register(greet{}, handleGreet)
+
+			_, err := b.Dispatch(loggerCtx, greet{Name: "world"})
+			Expect(err).To(BeNil())
+
+			Expect(logs.All()).To(HaveLen(1))
+			Expect(logs.All()[0].ContextMap()).To(HaveKeyWithValue("request_id", "request-1"))
+			Expect(logs.All()[0].ContextMap()).To(HaveKeyWithValue("message", "greet"))
+		})
+	})
+})
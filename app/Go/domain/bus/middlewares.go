@@ -0,0 +1,91 @@
+package bus
+
+import (
+	"context"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Forbidden signifies the actor is not allowed to dispatch the message.
+type Forbidden struct{}
+
+func (err Forbidden) Error() string {
+	return "Forbidden"
+}
+
+// Validation rejects the messages which fail their own validation rules.
+func Validation() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) (interface{}, error) {
+			if validatable, ok := msg.(validation.Validatable); ok {
+				if err := validatable.Validate(); err != nil {
+					return nil, err
+				}
+			}
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Authorization rejects the messages the actor is not allowed to dispatch.
+// The authorize function returns false when the actor is not allowed to dispatch the message.
+func Authorization(authorize func(ctx context.Context, msg Message) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) (interface{}, error) {
+			if !authorize(ctx, msg) {
+				return nil, Forbidden{}
+			}
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Logging logs every dispatched message with its outcome.
+func Logging(logger *zap.SugaredLogger) Middleware {
+	return ContextLogging(func(ctx context.Context) *zap.SugaredLogger { return logger })
+}
+
+// ContextLogging logs every dispatched message with its outcome to the logger of the message context,
+// e.g. the request-scoped logger carrying the request ID.
+func ContextLogging(loggerFromContext func(ctx context.Context) *zap.SugaredLogger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) (interface{}, error) {
+			start := time.Now()
+			result, err := next(ctx, msg)
+			logger := loggerFromContext(ctx)
+
+			if err != nil {
+				logger.Infow("Message failed",
+					"message", msg.MessageName(),
+					"actor", ActorFromContext(ctx),
+					"duration", time.Since(start),
+					"error", err,
+				)
+			} else {
+				logger.Debugw("Message handled",
+					"message", msg.MessageName(),
+					"actor", ActorFromContext(ctx),
+					"duration", time.Since(start),
+				)
+			}
+
+			return result, err
+		}
+	}
+}
+
+// Metrics reports the duration and the outcome of every dispatched message to the observer.
+func Metrics(observe func(name string, duration time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg Message) (interface{}, error) {
+			start := time.Now()
+			result, err := next(ctx, msg)
+			observe(msg.MessageName(), time.Since(start), err)
+
+			return result, err
+		}
+	}
+}
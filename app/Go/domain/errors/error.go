@@ -1,11 +1,23 @@
 package domain_errors
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 type (
 	// InvalidVersion signifies an entity with specified version does not exist in the system.
 	InvalidVersion struct{}
 
 	// InvalidVersion signifies an entity with specified state does not exist in the system.
 	StateConflict struct{}
+
+	// Timeout signifies an operation was interrupted because the deadline of its context exceeded.
+	Timeout struct{}
+
+	// Canceled signifies an operation was interrupted because its context was cancelled, e.g. the client disconnected.
+	Canceled struct{}
 )
 
 func (err InvalidVersion) Error() string {
@@ -15,3 +27,24 @@ func (err InvalidVersion) Error() string {
 func (err StateConflict) Error() string {
 	return "Invalid state"
 }
+
+func (err Timeout) Error() string {
+	return "Operation timed out"
+}
+
+func (err Canceled) Error() string {
+	return "Operation cancelled"
+}
+
+// FromContext returns a Canceled error if the context was cancelled, a Timeout error if its deadline exceeded,
+// nil otherwise.
+func FromContext(ctx context.Context) error {
+	switch err := ctx.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("%v: %w", err, Canceled{})
+	default:
+		return fmt.Errorf("%v: %w", err, Timeout{})
+	}
+}
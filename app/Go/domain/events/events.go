@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"sync"
+)
+
+// Event is a domain event raised by a command.
+type Event interface {
+	// Topic the event is published to.
+	Topic() string
+}
+
+// Publisher delivers the event payloads to the message broker.
+type Publisher interface {
+	Publish(topic string, body []byte) error
+}
+
+// Subscriber delivers the event payloads published to the message broker.
+type Subscriber interface {
+	// Subscribe calls the handler with the payloads published to the topics from now on until unsubscribed,
+	// the handler is not called concurrently.
+	Subscribe(topics []string, handle func(topic string, body []byte)) (unsubscribe func(), err error)
+}
+
+// Recorder collects the events raised during a command, safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Record an event raised by the command.
+func (r *Recorder) Record(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+// Events recorded so far in the order they were raised.
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Event(nil), r.events...)
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns the context carrying the correlation ID attached to the events raised within it,
+// e.g. the ID of the request issuing the command.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID of the context, empty if there's none.
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// Envelope of the published event, it carries the W3C trace context of the command
+// so that the consumers can continue its trace, and the correlation ID of the request issuing it,
+// e.g. {"event": {...}, "trace_context": {"traceparent": "..."}, "correlation_id": "..."}.
+type Envelope struct {
+	Event         json.RawMessage   `json:"event"`
+	TraceContext  map[string]string `json:"trace_context,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+}
+
+// Marshal the event as JSON wrapped in the envelope with the trace context and the correlation ID of the context.
+func Marshal(ctx context.Context, event Event) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return json.Marshal(Envelope{Event: payload, TraceContext: carrier, CorrelationID: CorrelationIDFromContext(ctx)})
+}
+
+// ContextFromPayload returns the context continuing the trace carried by the envelope of the payload.
+// The context is returned as is if the payload isn't an envelope.
+func ContextFromPayload(ctx context.Context, payload []byte) context.Context {
+	envelope := Envelope{}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return ctx
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(envelope.TraceContext))
+}
+
+// Publish the event in its envelope to its topic.
+func Publish(ctx context.Context, publisher Publisher, event Event) error {
+	payload, err := Marshal(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	return publisher.Publish(event.Topic(), payload)
+}
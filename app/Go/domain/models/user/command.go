@@ -1,16 +1,19 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
-	"github.com/jinzhu/gorm"
+	"github.com/gofrs/uuid"
 	domain_errors "go-ddd-cqrs-example/domain/errors"
 	"strings"
+	"time"
 )
 
 // Create a new active user.
-func Create(db gorm.DB, pendingUser PendingUser) (*UserCreated, error) {
+func Create(ctx context.Context, repo Repository, pendingUser PendingUser) (*UserCreated, error) {
 	pendingUser.EmailAddress = strings.TrimSpace(pendingUser.EmailAddress)
 	pendingUser.EmailAddress = strings.ToLower(pendingUser.EmailAddress)
 
@@ -23,14 +26,14 @@ func Create(db gorm.DB, pendingUser PendingUser) (*UserCreated, error) {
 		return nil, err
 	}
 
-	err, exists := isEmailAddressUnique(db, pendingUser.EmailAddress)
+	err, exists := isEmailAddressUnique(ctx, repo, pendingUser.EmailAddress)
 	if err != nil {
 		return nil, err
 	} else if exists != true {
 		return nil, AlreadyExists{}
 	}
 
-	passwordHash, err := Hash(pendingUser.Password)
+	passwordHash, err := Hash(ctx, pendingUser.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -41,13 +44,13 @@ func Create(db gorm.DB, pendingUser PendingUser) (*UserCreated, error) {
 		Version:      1,
 	}
 
-	if err := db.Create(&User{
+	if err := repo.Insert(ctx, User{
 		ID:           activeUser.ID,
 		EmailAddress: activeUser.EmailAddress,
 		Password:     *passwordHash,
 		IsActive:     true,
 		Version:      activeUser.Version,
-	}).Error; err != nil {
+	}); err != nil {
 		return nil, err
 	}
 
@@ -59,27 +62,29 @@ func Create(db gorm.DB, pendingUser PendingUser) (*UserCreated, error) {
 }
 
 // Deactivate an active user.
-func Deactivate(db gorm.DB, activeUser ActiveUser) (*UserDeactivated, error) {
+func Deactivate(ctx context.Context, repo Repository, activeUser ActiveUser) (*UserDeactivated, error) {
 	inactiveUser := InactiveUser{
 		ID:      activeUser.ID,
 		Version: activeUser.Version + 1,
 	}
 
-	// Update attributes with `struct`, will only update non-zero fields.
-	// Update attributes with `map` instead.
-	// https://gorm.io/docs/update.html#Updates-multiple-columns
-	result := db.Model(&User{}).
-		Where("id = ? AND version = ?",
-			activeUser.ID,
-			activeUser.Version,
-		).Updates(map[string]interface{}{"is_active": false, "version": inactiveUser.Version})
-
-	if result.Error != nil {
-		return nil, fmt.Errorf("Error deactivating active user: %w", result.Error)
-	} else if result.RowsAffected != 1 {
+	user, err := repo.FindByID(ctx, activeUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Error deactivating active user: %w", err)
+	} else if user.Version != activeUser.Version {
 		return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
 	}
 
+	user.IsActive = false
+	user.Version = inactiveUser.Version
+
+	if err := repo.Update(ctx, *user, activeUser.Version); err != nil {
+		if errors.As(err, &domain_errors.StateConflict{}) {
+			return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+		}
+		return nil, fmt.Errorf("Error deactivating active user: %w", err)
+	}
+
 	return &UserDeactivated{
 		UserID:  inactiveUser.ID.String(),
 		Version: inactiveUser.Version,
@@ -87,29 +92,246 @@ func Deactivate(db gorm.DB, activeUser ActiveUser) (*UserDeactivated, error) {
 }
 
 // Activate an inactive user.
-func Activate(db gorm.DB, inactiveUser InactiveUser) (*UserActivated, error) {
+func Activate(ctx context.Context, repo Repository, inactiveUser InactiveUser) (*UserActivated, error) {
 	activeUser := ActiveUser{
 		ID:      inactiveUser.ID,
 		Version: inactiveUser.Version + 1,
 	}
 
-	// Update attributes with `struct`, will only update non-zero fields.
-	// Update attributes with `map` instead.
-	// https://gorm.io/docs/update.html#Updates-multiple-columns
-	result := db.Model(&User{}).
-		Where("id = ? AND version = ?",
-			inactiveUser.ID,
-			inactiveUser.Version,
-		).Updates(map[string]interface{}{"is_active": true, "version": activeUser.Version})
-
-	if result.Error != nil {
-		return nil, fmt.Errorf("Error activating inactive user: %w", result.Error)
-	} else if result.RowsAffected != 1 {
+	user, err := repo.FindByID(ctx, inactiveUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Error activating inactive user: %w", err)
+	} else if user.Version != inactiveUser.Version {
 		return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
 	}
 
+	user.IsActive = true
+	user.Version = activeUser.Version
+	// Activating the user cancels its pending deletion.
+	user.DeletionRequestedAt = nil
+
+	if err := repo.Update(ctx, *user, inactiveUser.Version); err != nil {
+		if errors.As(err, &domain_errors.StateConflict{}) {
+			return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+		}
+		return nil, fmt.Errorf("Error activating inactive user: %w", err)
+	}
+
 	return &UserActivated{
 		UserID:  activeUser.ID.String(),
 		Version: activeUser.Version,
 	}, nil
 }
+
+// ResetPassword of a user regardless of its state.
+func ResetPassword(ctx context.Context, repo Repository, pk uuid.UUID, password string) error {
+	if err := validation.Validate(password, validation.Required, validation.Length(6, 20)); err != nil {
+		return validation.Errors{"password": err}
+	}
+
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
+		return fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return fmt.Errorf("Error resetting password: %w", err)
+	}
+
+	passwordHash, err := Hash(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	version := user.Version
+	user.Password = *passwordHash
+	user.Version = version + 1
+
+	if err := repo.Update(ctx, *user, version); err != nil {
+		if errors.As(err, &domain_errors.StateConflict{}) {
+			return fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+		}
+		return fmt.Errorf("Error resetting password: %w", err)
+	}
+
+	return nil
+}
+
+// ChangeEmail of a user regardless of its state from the old email address to the new one, the user has to be at the given version if any.
+// The new email address has to be unique, which is checked again by the repository on update.
+func ChangeEmail(ctx context.Context, repo Repository, pk uuid.UUID, version *uint32, oldEmailAddress, newEmailAddress string) (*UserEmailChanged, error) {
+	oldEmailAddress = strings.ToLower(strings.TrimSpace(oldEmailAddress))
+	newEmailAddress = strings.ToLower(strings.TrimSpace(newEmailAddress))
+
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
+		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error changing email address: %w", err)
+	} else if version != nil && user.Version != *version {
+		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
+	} else if user.EmailAddress != oldEmailAddress {
+		return nil, fmt.Errorf("Invariant failed: %w", EmailAddressMismatch{})
+	}
+
+	err, unique := isEmailAddressUnique(ctx, repo, newEmailAddress)
+	if err != nil {
+		return nil, err
+	} else if unique != true {
+		return nil, AlreadyExists{}
+	}
+
+	updated := *user
+	updated.EmailAddress = newEmailAddress
+	updated.Version = user.Version + 1
+
+	if err := repo.Update(ctx, updated, user.Version); err != nil {
+		if errors.As(err, &domain_errors.StateConflict{}) {
+			return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+		}
+		return nil, fmt.Errorf("Error changing email address: %w", err)
+	}
+
+	return &UserEmailChanged{
+		UserID:          updated.ID.String(),
+		OldEmailAddress: oldEmailAddress,
+		NewEmailAddress: newEmailAddress,
+		Version:         updated.Version,
+	}, nil
+}
+
+// UpdateProfile of a user regardless of its state, the user has to be at the given version if any.
+// Nothing is stored and no event is returned when the changes keep the profile as it is.
+func UpdateProfile(ctx context.Context, repo Repository, pk uuid.UUID, version *uint32, changes ProfileChanges) (*UserProfileUpdated, error) {
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
+		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error updating user profile: %w", err)
+	} else if version != nil && user.Version != *version {
+		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
+	}
+
+	updated := *user
+	applyChange(&updated.DisplayName, changes.DisplayName)
+	applyChange(&updated.Locale, changes.Locale)
+	applyChange(&updated.Timezone, changes.Timezone)
+	applyChange(&updated.AvatarURL, changes.AvatarURL)
+
+	if updated == *user {
+		return nil, nil
+	}
+
+	updated.Version = user.Version + 1
+
+	if err := repo.Update(ctx, updated, user.Version); err != nil {
+		if errors.As(err, &domain_errors.StateConflict{}) {
+			return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+		}
+		return nil, fmt.Errorf("Error updating user profile: %w", err)
+	}
+
+	return &UserProfileUpdated{
+		UserID:      updated.ID.String(),
+		DisplayName: updated.DisplayName,
+		Locale:      updated.Locale,
+		Timezone:    updated.Timezone,
+		AvatarURL:   updated.AvatarURL,
+		Version:     updated.Version,
+	}, nil
+}
+
+// RequestDeletion of a user regardless of its state, the user is deactivated until its erasure.
+// The deactivated event is returned only if the user was active, the repeated requests keep the original request time.
+func RequestDeletion(ctx context.Context, repo Repository, pk uuid.UUID, now time.Time) (*UserDeactivated, error) {
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
+		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error requesting user deletion: %w", err)
+	} else if user.DeletionRequestedAt != nil {
+		return nil, nil
+	}
+
+	wasActive := user.IsActive
+	version := user.Version
+	user.IsActive = false
+	user.DeletionRequestedAt = &now
+	user.Version = version + 1
+
+	if err := repo.Update(ctx, *user, version); err != nil {
+		if errors.As(err, &domain_errors.StateConflict{}) {
+			return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+		}
+		return nil, fmt.Errorf("Error requesting user deletion: %w", err)
+	}
+
+	if !wasActive {
+		return nil, nil
+	}
+
+	return &UserDeactivated{
+		UserID:  user.ID.String(),
+		Version: user.Version,
+	}, nil
+}
+
+// Erase a user regardless of its state, only the tombstone with the given reason is kept.
+// The user erased for its deletion request has to be past the grace period of the request, the user has to be at the given version if any.
+func Erase(ctx context.Context, repo Repository, pk uuid.UUID, version *uint32, reason string, now time.Time) (*UserErased, error) {
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
+		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error erasing user: %w", err)
+	} else if version != nil && user.Version != *version {
+		return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+	} else if reason == ErasureReasonDeletionRequest && !dueForErasure(*user, now) {
+		// The deletion was cancelled or is still within its grace period, e.g. since the due users were listed.
+		return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+	}
+
+	err = repo.Erase(ctx, pk, Tombstone{
+		UserID:              pk,
+		Version:             user.Version,
+		Reason:              reason,
+		DeletionRequestedAt: user.DeletionRequestedAt,
+		ErasedAt:            now,
+	})
+	if errors.As(err, &UserNotFound{}) {
+		return nil, fmt.Errorf("State conflict: %w", domain_errors.StateConflict{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error erasing user: %w", err)
+	}
+
+	return &UserErased{
+		UserID:  pk.String(),
+		Version: user.Version + 1,
+	}, nil
+}
+
+// RecordLogin of a user in its login history, the login is recorded regardless of the user state.
+func RecordLogin(ctx context.Context, repo Repository, pk uuid.UUID, method string, now time.Time) error {
+	err := repo.InsertLogin(ctx, Login{
+		UserID:     pk,
+		Method:     method,
+		LoggedInAt: now,
+	})
+	if errors.As(err, &UserNotFound{}) {
+		return fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return fmt.Errorf("Error recording user login: %w", err)
+	}
+
+	return nil
+}
+
+// dueForErasure checks whether the deletion of the user was requested over DeletionGracePeriod before the given time.
+func dueForErasure(user User, now time.Time) bool {
+	return user.DeletionRequestedAt != nil && !now.Before(user.DeletionRequestedAt.Add(DeletionGracePeriod))
+}
+
+// applyChange to the field unless the change is nil.
+func applyChange(field *string, change *string) {
+	if change != nil {
+		*field = strings.TrimSpace(*change)
+	}
+}
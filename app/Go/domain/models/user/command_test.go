@@ -1,58 +1,24 @@
 package user_test
 
 import (
+	"context"
 	"errors"
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"github.com/spf13/viper"
 	domain_errors "go-ddd-cqrs-example/domain/errors"
 	"go-ddd-cqrs-example/domain/models/user"
-	"go-ddd-cqrs-example/usersapi/cmd/config"
-	"go-ddd-cqrs-example/usersapi/utils"
-	"os"
-	"path"
-	"runtime"
+	"go-ddd-cqrs-example/domain/models/user/memory"
 )
 
 var _ = Describe("Managing users", func() {
 	var (
-		db *gorm.DB
+		ctx  = context.Background()
+		repo *memory.UserRepository
 	)
 
-	// Hotfix, fix inconsistent current directory to get configuration file.
-	// TODO find better way to handle this.
-	_, filename, _, _ := runtime.Caller(0)
-	dir := path.Join(path.Dir(filename), "../../..")
-	err := os.Chdir(dir)
-	if err != nil {
-		panic(err)
-	}
-
-	// Set up database connection using configuration details.
-	cfg := config.Config{}
-	viper.AddConfigPath(dir + "/usersapi/cmd/config")
-	viper.SetConfigName("configuration")
-	viper.ReadInConfig()
-	viper.Unmarshal(&cfg)
-	conn, err := utils.GetDB(
-		cfg.DBDriver,
-		cfg.DBUsername,
-		cfg.DBPassword,
-		cfg.DBPort,
-		cfg.DBHost,
-		cfg.DBName,
-	)
-	Expect(err).To(BeNil())
-
 	BeforeEach(func() {
-		db = conn.Begin()
-	})
-
-	AfterEach(func() {
-		_ = db.Rollback()
+		repo = memory.NewUserRepository()
 	})
 
 	Describe("Creating a user", func() {
@@ -68,7 +34,7 @@ var _ = Describe("Managing users", func() {
 
 		When("the user is created", func() {
 			Specify("the returned event", func() {
-				event, err := user.Create(*db, pendingUser)
+				event, err := user.Create(ctx, repo, pendingUser)
 
 				Expect(err).To(BeNil())
 				Expect(event).To(Equal(&user.UserCreated{
@@ -79,12 +45,11 @@ var _ = Describe("Managing users", func() {
 			})
 
 			Specify("the user is persisted in the database", func() {
-				_, err := user.Create(*db, pendingUser)
+				_, err := user.Create(ctx, repo, pendingUser)
 
 				Expect(err).To(BeNil())
 
-				u := user.User{}
-				err = db.Model(&u).Where("id = ?", pendingUser.ID).Take(&u).Error
+				u, err := repo.FindByID(ctx, pendingUser.ID)
 
 				Expect(err).To(BeNil())
 				Expect(u.ID).To(Equal(pendingUser.ID))
@@ -94,15 +59,31 @@ var _ = Describe("Managing users", func() {
 			})
 		})
 
+		When("the context is cancelled", func() {
+			Specify("a cancellation error is returned and the user is not persisted", func() {
+				cancelledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+
+				event, err := user.Create(cancelledCtx, repo, pendingUser)
+
+				Expect(event).To(BeNil())
+				Expect(errors.As(err, &domain_errors.Canceled{})).To(BeTrue())
+				Expect(errors.As(err, &domain_errors.Timeout{})).To(BeFalse())
+
+				_, err = repo.FindByID(ctx, pendingUser.ID)
+				Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+			})
+		})
+
 		When("a user with specified email address already exists in the system", func() {
 			BeforeEach(func() {
-				err := db.Create(&user.User{
+				err := repo.Insert(ctx, user.User{
 					ID:           uuid.Must(uuid.NewV4()),
 					EmailAddress: "user@example.com",
 					Password:     "someHashedPassword",
 					IsActive:     true,
 					Version:      1,
-				}).Error
+				})
 
 				Expect(err).To(BeNil())
 			})
@@ -114,7 +95,7 @@ var _ = Describe("Managing users", func() {
 					Password:     "someHashedPassword",
 				}
 
-				event, err := user.Create(*db, pendingUser)
+				event, err := user.Create(ctx, repo, pendingUser)
 
 				Expect(event).To(BeNil())
 				Expect(errors.As(err, &user.AlreadyExists{})).To(BeTrue())
@@ -128,21 +109,21 @@ var _ = Describe("Managing users", func() {
 		BeforeEach(func() {
 			UserID = uuid.Must(uuid.NewV4())
 
-			err := db.Create(&user.User{
+			err := repo.Insert(ctx, user.User{
 				ID:           UserID,
 				EmailAddress: "user@example.com",
 				IsActive:     true,
 				Version:      1,
-			}).Error
+			})
 			Expect(err).To(BeNil())
 		})
 
 		When("the user is deactivated", func() {
 			Specify("the returned event", func() {
-				activeUser, err := user.GetActive(*db, UserID, nil)
+				activeUser, err := user.GetActive(ctx, repo, UserID, nil)
 				Expect(err).To(BeNil())
 
-				event, err := user.Deactivate(*db, *activeUser)
+				event, err := user.Deactivate(ctx, repo, *activeUser)
 
 				Expect(err).To(BeNil())
 				Expect(event).To(Equal(&user.UserDeactivated{
@@ -152,15 +133,14 @@ var _ = Describe("Managing users", func() {
 			})
 
 			Specify("the deactivated user is persisted in the database", func() {
-				activeUser, err := user.GetActive(*db, UserID, nil)
+				activeUser, err := user.GetActive(ctx, repo, UserID, nil)
 				Expect(err).To(BeNil())
 
-				_, err = user.Deactivate(*db, *activeUser)
+				_, err = user.Deactivate(ctx, repo, *activeUser)
 
 				Expect(err).To(BeNil())
 
-				u := user.User{}
-				err = db.Model(&u).Where("id = ?", activeUser.ID).Take(&u).Error
+				u, err := repo.FindByID(ctx, activeUser.ID)
 
 				Expect(err).To(BeNil())
 				Expect(u.ID).To(Equal(activeUser.ID))
@@ -172,21 +152,19 @@ var _ = Describe("Managing users", func() {
 
 		When("the user's state has been modified during deactivation", func() {
 			Specify("a state conflict error is returned", func() {
-				activeUser, err := user.GetActive(*db, UserID, nil)
+				activeUser, err := user.GetActive(ctx, repo, UserID, nil)
 				Expect(err).To(BeNil())
 
 				// Simulate a concurrent action on the entity by increasing its version.
-				result := db.Model(&user.User{}).
-					Where("id = ?", activeUser.ID).
-					Updates(user.User{
-						Version: activeUser.Version + 1,
-					},
-					)
+				u, err := repo.FindByID(ctx, activeUser.ID)
+				Expect(err).To(BeNil())
+
+				u.Version = activeUser.Version + 1
+				err = repo.Update(ctx, *u, activeUser.Version)
 
 				Expect(err).To(BeNil())
-				Expect(result.RowsAffected).To(Equal(int64(1)))
 
-				inactiveUser, err := user.Deactivate(*db, *activeUser)
+				inactiveUser, err := user.Deactivate(ctx, repo, *activeUser)
 
 				Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
 				Expect(inactiveUser).To(BeNil())
@@ -200,21 +178,21 @@ var _ = Describe("Managing users", func() {
 		BeforeEach(func() {
 			UserID = uuid.Must(uuid.NewV4())
 
-			err := db.Create(&user.User{
+			err := repo.Insert(ctx, user.User{
 				ID:           UserID,
 				EmailAddress: "user@example.com",
 				IsActive:     false,
 				Version:      1,
-			}).Error
+			})
 			Expect(err).To(BeNil())
 		})
 
 		When("the user is activated", func() {
 			Specify("the returned event", func() {
-				inactiveUser, err := user.GetInactive(*db, UserID, nil)
+				inactiveUser, err := user.GetInactive(ctx, repo, UserID, nil)
 				Expect(err).To(BeNil())
 
-				event, err := user.Activate(*db, *inactiveUser)
+				event, err := user.Activate(ctx, repo, *inactiveUser)
 
 				Expect(err).To(BeNil())
 				Expect(event).To(Equal(&user.UserActivated{
@@ -224,15 +202,14 @@ var _ = Describe("Managing users", func() {
 			})
 
 			Specify("the activated user is persisted in the database", func() {
-				inactiveUser, err := user.GetInactive(*db, UserID, nil)
+				inactiveUser, err := user.GetInactive(ctx, repo, UserID, nil)
 				Expect(err).To(BeNil())
 
-				_, err = user.Activate(*db, *inactiveUser)
+				_, err = user.Activate(ctx, repo, *inactiveUser)
 
 				Expect(err).To(BeNil())
 
-				u := user.User{}
-				err = db.Model(&u).Where("id = ?", inactiveUser.ID).Take(&u).Error
+				u, err := repo.FindByID(ctx, inactiveUser.ID)
 
 				Expect(err).To(BeNil())
 				Expect(u.ID).To(Equal(inactiveUser.ID))
@@ -244,21 +221,19 @@ var _ = Describe("Managing users", func() {
 
 		When("the user's state has been modified during deactivation", func() {
 			Specify("a state conflict error is returned", func() {
-				inactiveUser, err := user.GetInactive(*db, UserID, nil)
+				inactiveUser, err := user.GetInactive(ctx, repo, UserID, nil)
 				Expect(err).To(BeNil())
 
 				// Simulate a concurrent action on the entity by increasing its version.
-				result := db.Model(&user.User{}).
-					Where("id = ?", inactiveUser.ID).
-					Updates(user.User{
-						Version: inactiveUser.Version + 1,
-					},
-					)
+				u, err := repo.FindByID(ctx, inactiveUser.ID)
+				Expect(err).To(BeNil())
+
+				u.Version = inactiveUser.Version + 1
+				err = repo.Update(ctx, *u, inactiveUser.Version)
 
 				Expect(err).To(BeNil())
-				Expect(result.RowsAffected).To(Equal(int64(1)))
 
-				activeUser, err := user.Activate(*db, *inactiveUser)
+				activeUser, err := user.Activate(ctx, repo, *inactiveUser)
 
 				Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
 				Expect(activeUser).To(BeNil())
@@ -12,6 +12,9 @@ type (
 
 	// UserNotFound signifies a user is not found.
 	UserNotFound struct{}
+
+	// EmailAddressMismatch signifies a user no longer has the email address a change was requested for.
+	EmailAddressMismatch struct{}
 )
 
 func (err AlreadyExists) Error() string {
@@ -29,3 +32,7 @@ func (err IsInactive) Error() string {
 func (err UserNotFound) Error() string {
 	return "User is unverified"
 }
+
+func (err EmailAddressMismatch) Error() string {
+	return "Email address does not match"
+}
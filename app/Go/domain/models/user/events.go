@@ -0,0 +1,43 @@
+package user
+
+// Topics of the user events.
+func Topics() []string {
+	return []string{
+		(&UserCreated{}).Topic(),
+		(&UserDeactivated{}).Topic(),
+		(&UserActivated{}).Topic(),
+		(&UserProfileUpdated{}).Topic(),
+		(&UserEmailChanged{}).Topic(),
+		(&UserErased{}).Topic(),
+	}
+}
+
+// Topic the user created event is published to.
+func (m *UserCreated) Topic() string {
+	return "new_user"
+}
+
+// Topic the user deactivated event is published to.
+func (m *UserDeactivated) Topic() string {
+	return "deactivated_user"
+}
+
+// Topic the user activated event is published to.
+func (m *UserActivated) Topic() string {
+	return "activated_user"
+}
+
+// Topic the user profile updated event is published to.
+func (m *UserProfileUpdated) Topic() string {
+	return "updated_user_profile"
+}
+
+// Topic the user email changed event is published to.
+func (m *UserEmailChanged) Topic() string {
+	return "changed_user_email"
+}
+
+// Topic the user erased event is published to, the consumers have to remove the personal data of the user they hold.
+func (m *UserErased) Topic() string {
+	return "erased_user"
+}
@@ -0,0 +1,416 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/events"
+	"strings"
+	"time"
+)
+
+type unitKey struct{}
+
+// unit holds the repository and the recorder of the running unit of work.
+type unit struct {
+	repo     Repository
+	recorder *events.Recorder
+}
+
+// NewCommandBus with the user command handlers registered, the given middlewares wrap the built-in
+// authorization, validation and transaction ones.
+func NewCommandBus(uow UnitOfWork, middlewares ...bus.Middleware) *bus.Bus {
+	b := bus.New(append(append([]bus.Middleware{}, middlewares...),
+		bus.Authorization(Authorize),
+		bus.Validation(),
+		Transactional(uow),
+	)...)
+
+	b.Register(RegisterUser{}, handleRegisterUser)
+	b.Register(DeactivateUser{}, handleDeactivateUser)
+	b.Register(ActivateUser{}, handleActivateUser)
+	b.Register(ResetUserPassword{}, handleResetPassword)
+	b.Register(UpdateUser{}, handleUpdateUser)
+	b.Register(ChangeUserEmail{}, handleChangeUserEmail)
+	b.Register(RequestUserDeletion{}, handleRequestUserDeletion)
+	b.Register(EraseUser{}, handleEraseUser)
+	b.Register(RecordUserLogin{}, handleRecordUserLogin)
+
+	return b
+}
+
+// NewQueryBus with the user query handlers registered, the given middlewares wrap the built-in
+// authorization and validation ones.
+func NewQueryBus(repo UserReader, middlewares ...bus.Middleware) *bus.Bus {
+	b := bus.New(append(append([]bus.Middleware{}, middlewares...),
+		bus.Authorization(Authorize),
+		bus.Validation(),
+	)...)
+
+	b.Register(GetUser{}, handleGetUser(repo))
+	b.Register(GetUserByEmail{}, handleGetUserByEmail(repo))
+	b.Register(ListUsers{}, handleListUsers(repo))
+	b.Register(GetUserHistory{}, handleGetUserHistory(repo))
+	b.Register(GetUserLogins{}, handleGetUserLogins(repo))
+	b.Register(GetUserTombstone{}, handleGetUserTombstone(repo))
+
+	return b
+}
+
+// Transactional runs the command handlers within the unit of work.
+func Transactional(uow UnitOfWork) bus.Middleware {
+	return func(next bus.Handler) bus.Handler {
+		return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+			var result interface{}
+
+			err := uow.Do(ctx, func(ctx context.Context, repo Repository, recorder *events.Recorder) error {
+				var err error
+				result, err = next(context.WithValue(ctx, unitKey{}, unit{repo: repo, recorder: recorder}), msg)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return result, nil
+		}
+	}
+}
+
+// Authorize allows the users to manage their own accounts only, while the system actor is allowed everything.
+func Authorize(ctx context.Context, msg bus.Message) bool {
+	actor := bus.ActorFromContext(ctx)
+	if actor == bus.SystemActor {
+		return true
+	}
+
+	switch m := msg.(type) {
+	case RegisterUser:
+		return true
+	case DeactivateUser:
+		return actor == m.UserID.String()
+	case ActivateUser:
+		return actor == m.UserID.String()
+	case ResetUserPassword:
+		return actor == m.UserID.String()
+	case UpdateUser:
+		return actor == m.UserID.String()
+	case ChangeUserEmail:
+		return actor == m.UserID.String()
+	case RequestUserDeletion:
+		return actor == m.UserID.String()
+	case GetUser:
+		return actor == m.UserID.String()
+	case RecordUserLogin:
+		return actor == m.UserID.String()
+	case GetUserHistory:
+		return actor == m.UserID.String()
+	case GetUserLogins:
+		return actor == m.UserID.String()
+	}
+
+	return false
+}
+
+func unitFromContext(ctx context.Context) (*unit, error) {
+	u, ok := ctx.Value(unitKey{}).(unit)
+	if !ok {
+		return nil, errors.New("Command has to run within a unit of work")
+	}
+
+	return &u, nil
+}
+
+func handleRegisterUser(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(RegisterUser)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := Create(ctx, u.repo, PendingUser{
+		ID:           cmd.ID,
+		EmailAddress: cmd.EmailAddress,
+		Password:     cmd.Password,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	u.recorder.Record(event)
+
+	return event, nil
+}
+
+func handleDeactivateUser(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(DeactivateUser)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	activeUser, err := GetActive(ctx, u.repo, cmd.UserID, cmd.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := Deactivate(ctx, u.repo, *activeUser)
+	if err != nil {
+		return nil, err
+	}
+
+	u.recorder.Record(event)
+
+	return event, nil
+}
+
+func handleActivateUser(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(ActivateUser)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inactiveUser, err := GetInactive(ctx, u.repo, cmd.UserID, cmd.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := Activate(ctx, u.repo, *inactiveUser)
+	if err != nil {
+		return nil, err
+	}
+
+	u.recorder.Record(event)
+
+	return event, nil
+}
+
+func handleResetPassword(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(ResetUserPassword)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, ResetPassword(ctx, u.repo, cmd.UserID, cmd.Password)
+}
+
+// handleUpdateUser applies the profile changes before the state transition, both within the same unit of work,
+// and returns the recorded events.
+func handleUpdateUser(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(UpdateUser)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := []events.Event{}
+	version := cmd.Version
+
+	updated, err := UpdateProfile(ctx, u.repo, cmd.UserID, version, ProfileChanges{
+		DisplayName: cmd.DisplayName,
+		Locale:      cmd.Locale,
+		Timezone:    cmd.Timezone,
+		AvatarURL:   cmd.AvatarURL,
+	})
+	if err != nil {
+		return nil, err
+	} else if updated != nil {
+		recorded = append(recorded, updated)
+		if version != nil {
+			version = &updated.Version
+		}
+	}
+
+	if cmd.IsActive != nil && *cmd.IsActive {
+		inactiveUser, err := GetInactive(ctx, u.repo, cmd.UserID, version)
+		if err != nil && !errors.As(err, &IsActive{}) {
+			return nil, err
+		} else if err == nil {
+			event, err := Activate(ctx, u.repo, *inactiveUser)
+			if err != nil {
+				return nil, err
+			}
+			recorded = append(recorded, event)
+		}
+	} else if cmd.IsActive != nil {
+		activeUser, err := GetActive(ctx, u.repo, cmd.UserID, version)
+		if err != nil && !errors.As(err, &IsInactive{}) {
+			return nil, err
+		} else if err == nil {
+			event, err := Deactivate(ctx, u.repo, *activeUser)
+			if err != nil {
+				return nil, err
+			}
+			recorded = append(recorded, event)
+		}
+	}
+
+	for _, event := range recorded {
+		u.recorder.Record(event)
+	}
+
+	return recorded, nil
+}
+
+func handleChangeUserEmail(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(ChangeUserEmail)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := ChangeEmail(ctx, u.repo, cmd.UserID, cmd.Version, cmd.OldEmailAddress, cmd.NewEmailAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	u.recorder.Record(event)
+
+	return event, nil
+}
+
+func handleRequestUserDeletion(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(RequestUserDeletion)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := RequestDeletion(ctx, u.repo, cmd.UserID, time.Now())
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	u.recorder.Record(event)
+
+	return event, nil
+}
+
+func handleEraseUser(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(EraseUser)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := Erase(ctx, u.repo, cmd.UserID, cmd.Version, cmd.Reason, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	u.recorder.Record(event)
+
+	return event, nil
+}
+
+func handleRecordUserLogin(ctx context.Context, msg bus.Message) (interface{}, error) {
+	cmd := msg.(RecordUserLogin)
+
+	u, err := unitFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, RecordLogin(ctx, u.repo, cmd.UserID, cmd.Method, time.Now())
+}
+
+func handleGetUser(repo UserReader) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+		query := msg.(GetUser)
+
+		user, err := repo.FindByID(ctx, query.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		return newUserView(*user), nil
+	}
+}
+
+func handleGetUserByEmail(repo UserReader) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+		query := msg.(GetUserByEmail)
+
+		user, err := repo.FindByEmail(ctx, strings.ToLower(strings.TrimSpace(query.EmailAddress)))
+		if err != nil {
+			return nil, err
+		}
+
+		return newUserView(*user), nil
+	}
+}
+
+func handleListUsers(repo UserReader) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+		query := msg.(ListUsers)
+
+		limit := query.Limit
+		if limit == 0 {
+			limit = DefaultListLimit
+		}
+
+		users, err := repo.Search(ctx, UserFilter{
+			EmailContains:           strings.ToLower(strings.TrimSpace(query.EmailContains)),
+			IsActive:                query.IsActive,
+			Limit:                   limit,
+			Offset:                  query.Offset,
+			DeletionRequestedBefore: query.DeletionRequestedBefore,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		views := make([]UserView, 0, len(users))
+		for _, user := range users {
+			views = append(views, *newUserView(user))
+		}
+
+		return views, nil
+	}
+}
+
+func handleGetUserHistory(repo UserReader) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+		query := msg.(GetUserHistory)
+
+		history, err := repo.History(ctx, query.UserID)
+		if err != nil {
+			return nil, err
+		} else if len(history) == 0 {
+			return nil, UserNotFound{}
+		}
+
+		return history, nil
+	}
+}
+
+func handleGetUserLogins(repo UserReader) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+		query := msg.(GetUserLogins)
+
+		return repo.Logins(ctx, query.UserID)
+	}
+}
+
+func handleGetUserTombstone(repo UserReader) bus.Handler {
+	return func(ctx context.Context, msg bus.Message) (interface{}, error) {
+		query := msg.(GetUserTombstone)
+
+		tombstone, err := repo.FindTombstone(ctx, query.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		return tombstone, nil
+	}
+}
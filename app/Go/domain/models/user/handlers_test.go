@@ -0,0 +1,537 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/bus"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"strings"
+	"time"
+)
+
+var _ = Describe("User command and query buses", func() {
+	var (
+		ctx       = context.Background()
+		repo      *memory.UserRepository
+		publisher *memory.Publisher
+		commands  *bus.Bus
+		queries   *bus.Bus
+		userID    uuid.UUID
+	)
+
+	BeforeEach(func() {
+		repo = memory.NewUserRepository()
+		publisher = &memory.Publisher{}
+		commands = user.NewCommandBus(memory.NewUnitOfWork(repo, publisher))
+		queries = user.NewQueryBus(repo)
+		userID = uuid.Must(uuid.NewV4())
+
+		_, err := commands.Dispatch(ctx, user.RegisterUser{
+			ID:           userID,
+			EmailAddress: "user@example.com",
+			Password:     "password",
+		})
+		Expect(err).To(BeNil())
+	})
+
+	Describe("Registering a user", func() {
+		Specify("the user created event is published", func() {
+			messages := publisher.Messages()
+
+			Expect(messages).To(HaveLen(1))
+			Expect(messages[0].Topic).To(Equal("new_user"))
+		})
+
+		Specify("invalid details are rejected", func() {
+			_, err := commands.Dispatch(ctx, user.RegisterUser{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: "Wrong email",
+				Password:     "password",
+			})
+
+			Expect(err).To(MatchError("email_address: must be a valid email address."))
+		})
+	})
+
+	Describe("Deactivating and activating a user", func() {
+		Specify("the user is allowed to change its own state", func() {
+			userCtx := bus.WithActor(ctx, userID.String())
+
+			result, err := commands.Dispatch(userCtx, user.DeactivateUser{UserID: userID})
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(&user.UserDeactivated{UserID: userID.String(), Version: 2}))
+
+			result, err = commands.Dispatch(userCtx, user.ActivateUser{UserID: userID})
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(&user.UserActivated{UserID: userID.String(), Version: 3}))
+
+			Expect(publisher.Messages()).To(HaveLen(3))
+		})
+
+		Specify("other users are forbidden to change the state", func() {
+			otherCtx := bus.WithActor(ctx, uuid.Must(uuid.NewV4()).String())
+
+			_, err := commands.Dispatch(otherCtx, user.DeactivateUser{UserID: userID})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+
+		Specify("the domain invariants are enforced", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.ActivateUser{UserID: userID})
+
+			Expect(errors.As(err, &user.IsActive{})).To(BeTrue())
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+	})
+
+	Describe("Querying a user", func() {
+		Specify("the user view is returned", func() {
+			result, err := queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.GetUserByEmail{EmailAddress: "User@example.com"})
+
+			Expect(err).To(BeNil())
+			view := result.(*user.UserView)
+			Expect(view.ID).To(Equal(userID))
+			Expect(view.IsActive).To(BeTrue())
+			Expect(view.Version).To(Equal(uint32(1)))
+		})
+	})
+	Describe("Resetting a password", func() {
+		Specify("the password is replaced without publishing events", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.ResetUserPassword{
+				UserID:   userID,
+				Password: "newPassword",
+			})
+			Expect(err).To(BeNil())
+
+			err = user.VerifyUserPassword(ctx, repo, "user@example.com", "newPassword")
+			Expect(err).To(BeNil())
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+
+		Specify("a too short password is rejected", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.ResetUserPassword{
+				UserID:   userID,
+				Password: "short",
+			})
+
+			Expect(err).To(MatchError("password: the length must be between 6 and 20."))
+		})
+	})
+
+	Describe("Listing users", func() {
+		Specify("the matching users are returned to the system actor", func() {
+			result, err := queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.ListUsers{EmailContains: "USER@"})
+
+			Expect(err).To(BeNil())
+			views := result.([]user.UserView)
+			Expect(views).To(HaveLen(1))
+			Expect(views[0].ID).To(Equal(userID))
+		})
+
+		Specify("the users are forbidden to list other users", func() {
+			_, err := queries.Dispatch(bus.WithActor(ctx, userID.String()), user.ListUsers{})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+	})
+
+	Describe("Updating a user", func() {
+		Specify("the profile and the state are changed at once and every event is published", func() {
+			version, displayName, inactive := uint32(1), "Jane Doe", false
+
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.UpdateUser{
+				UserID:      userID,
+				Version:     &version,
+				IsActive:    &inactive,
+				DisplayName: &displayName,
+			})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal([]events.Event{
+				&user.UserProfileUpdated{UserID: userID.String(), DisplayName: "Jane Doe", Version: 2},
+				&user.UserDeactivated{UserID: userID.String(), Version: 3},
+			}))
+			Expect(publisher.Messages()).To(HaveLen(3))
+
+			result, err = queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUser{UserID: userID})
+			Expect(err).To(BeNil())
+			Expect(result.(*user.UserView).IsActive).To(BeFalse())
+			Expect(result.(*user.UserView).Version).To(Equal(uint32(3)))
+		})
+
+		Specify("the trimmed profile fields are stored and the user profile updated event is published", func() {
+			displayName, locale, timezone := " Jane Doe ", "en-GB", "Europe/London"
+
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.UpdateUser{
+				UserID:      userID,
+				DisplayName: &displayName,
+				Locale:      &locale,
+				Timezone:    &timezone,
+			})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal([]events.Event{
+				&user.UserProfileUpdated{UserID: userID.String(), DisplayName: "Jane Doe", Locale: "en-GB", Timezone: "Europe/London", Version: 2},
+			}))
+			Expect(publisher.Messages()).To(HaveLen(2))
+			Expect(publisher.Messages()[1].Topic).To(Equal("updated_user_profile"))
+
+			result, err = queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUser{UserID: userID})
+			Expect(err).To(BeNil())
+			Expect(result.(*user.UserView).DisplayName).To(Equal("Jane Doe"))
+		})
+
+		Specify("nothing is stored nor published when the profile is kept as it is", func() {
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.UpdateUser{UserID: userID, AvatarURL: stringPtr("")})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(BeEmpty())
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+
+		Specify("setting the current state is a no-op", func() {
+			active := true
+
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.UpdateUser{UserID: userID, IsActive: &active})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(BeEmpty())
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+
+		Specify("an invalid version error is returned for an outdated version and nothing is changed", func() {
+			version, inactive := uint32(2), false
+
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.UpdateUser{UserID: userID, Version: &version, IsActive: &inactive})
+
+			Expect(errors.As(err, &domain_errors.InvalidVersion{})).To(BeTrue())
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+
+		Specify("invalid profile fields are rejected", func() {
+			samples := []struct {
+				command user.UpdateUser
+				message string
+			}{
+				{user.UpdateUser{UserID: userID, Locale: stringPtr("english")}, "locale: must be a language tag such as en-US."},
+				{user.UpdateUser{UserID: userID, Timezone: stringPtr("Mars/Olympus")}, "timezone: must be an IANA time zone such as Europe/Berlin."},
+				{user.UpdateUser{UserID: userID, Timezone: stringPtr("Local")}, "timezone: must be an IANA time zone such as Europe/Berlin."},
+				{user.UpdateUser{UserID: userID, AvatarURL: stringPtr("ftp://example.com/avatar.png")}, "avatar_url: must be an HTTP URL."},
+				{user.UpdateUser{UserID: userID, DisplayName: stringPtr(strings.Repeat("a", 101))}, "display_name: the length must be no more than 100."},
+			}
+
+			for _, sample := range samples {
+				_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), sample.command)
+
+				Expect(err).To(MatchError(sample.message))
+			}
+		})
+
+		Specify("other users are forbidden to update the user", func() {
+			otherCtx := bus.WithActor(ctx, uuid.Must(uuid.NewV4()).String())
+
+			_, err := commands.Dispatch(otherCtx, user.UpdateUser{UserID: userID, DisplayName: stringPtr("Jane Doe")})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+	})
+
+	Describe("Changing an email address", func() {
+		Specify("the email address is replaced and the user email changed event is published", func() {
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.ChangeUserEmail{
+				UserID:          userID,
+				OldEmailAddress: "user@example.com",
+				NewEmailAddress: "New@example.com",
+			})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(&user.UserEmailChanged{
+				UserID:          userID.String(),
+				OldEmailAddress: "user@example.com",
+				NewEmailAddress: "new@example.com",
+				Version:         2,
+			}))
+			Expect(publisher.Messages()).To(HaveLen(2))
+			Expect(publisher.Messages()[1].Topic).To(Equal("changed_user_email"))
+
+			err = user.VerifyUserPassword(ctx, repo, "new@example.com", "password")
+			Expect(err).To(BeNil())
+		})
+
+		Specify("an email address mismatch error is returned once the email address has changed", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.ChangeUserEmail{
+				UserID:          userID,
+				OldEmailAddress: "other@example.com",
+				NewEmailAddress: "new@example.com",
+			})
+
+			Expect(errors.As(err, &user.EmailAddressMismatch{})).To(BeTrue())
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+
+		Specify("an invalid version error is returned once the user has changed", func() {
+			version := uint32(1)
+
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.UpdateUser{UserID: userID, DisplayName: stringPtr("Jane Doe")})
+			Expect(err).To(BeNil())
+
+			_, err = commands.Dispatch(bus.WithActor(ctx, userID.String()), user.ChangeUserEmail{
+				UserID:          userID,
+				Version:         &version,
+				OldEmailAddress: "user@example.com",
+				NewEmailAddress: "new@example.com",
+			})
+
+			Expect(errors.As(err, &domain_errors.InvalidVersion{})).To(BeTrue())
+			Expect(publisher.Messages()).To(HaveLen(2))
+		})
+
+		Specify("a user already exists error is returned for a taken email address", func() {
+			_, err := commands.Dispatch(ctx, user.RegisterUser{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: "taken@example.com",
+				Password:     "password",
+			})
+			Expect(err).To(BeNil())
+
+			_, err = commands.Dispatch(bus.WithActor(ctx, userID.String()), user.ChangeUserEmail{
+				UserID:          userID,
+				OldEmailAddress: "user@example.com",
+				NewEmailAddress: "taken@example.com",
+			})
+
+			Expect(errors.As(err, &user.AlreadyExists{})).To(BeTrue())
+		})
+
+		Specify("other users are forbidden to change the email address", func() {
+			otherCtx := bus.WithActor(ctx, uuid.Must(uuid.NewV4()).String())
+
+			_, err := commands.Dispatch(otherCtx, user.ChangeUserEmail{
+				UserID:          userID,
+				OldEmailAddress: "user@example.com",
+				NewEmailAddress: "new@example.com",
+			})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+	})
+
+	Describe("Deleting a user", func() {
+		Specify("the user is deactivated and waits for the erasure", func() {
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(&user.UserDeactivated{UserID: userID.String(), Version: 2}))
+			Expect(publisher.Messages()).To(HaveLen(2))
+
+			before := time.Now().Add(time.Second)
+			result, err = queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.ListUsers{DeletionRequestedBefore: &before})
+			Expect(err).To(BeNil())
+			Expect(result).To(HaveLen(1))
+			Expect(result.([]user.UserView)[0].IsActive).To(BeFalse())
+			Expect(result.([]user.UserView)[0].DeletionRequestedAt).NotTo(BeNil())
+		})
+
+		Specify("the repeated request keeps the user as it is", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+			Expect(err).To(BeNil())
+
+			result, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(BeNil())
+			u, err := repo.FindByID(ctx, userID)
+			Expect(err).To(BeNil())
+			Expect(u.Version).To(Equal(uint32(2)))
+		})
+
+		Specify("activating the user cancels the deletion", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+			Expect(err).To(BeNil())
+
+			_, err = commands.Dispatch(bus.WithActor(ctx, userID.String()), user.ActivateUser{UserID: userID})
+
+			Expect(err).To(BeNil())
+			u, err := repo.FindByID(ctx, userID)
+			Expect(err).To(BeNil())
+			Expect(u.IsActive).To(BeTrue())
+			Expect(u.DeletionRequestedAt).To(BeNil())
+		})
+
+		Specify("other users are forbidden to request the deletion", func() {
+			otherCtx := bus.WithActor(ctx, uuid.Must(uuid.NewV4()).String())
+
+			_, err := commands.Dispatch(otherCtx, user.RequestUserDeletion{UserID: userID})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+	})
+
+	Describe("Erasing a user", func() {
+		Specify("only the tombstone is kept and the user erased event is published", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+			Expect(err).To(BeNil())
+
+			result, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{
+				UserID: userID,
+				Reason: user.ErasureReasonOperator,
+			})
+
+			Expect(err).To(BeNil())
+			Expect(result).To(Equal(&user.UserErased{UserID: userID.String(), Version: 3}))
+			Expect(publisher.Messages()).To(HaveLen(3))
+			Expect(publisher.Messages()[2].Topic).To(Equal("erased_user"))
+			Expect(string(publisher.Messages()[2].Body)).NotTo(ContainSubstring("user@example.com"))
+
+			_, err = repo.FindByID(ctx, userID)
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+			history, err := repo.History(ctx, userID)
+			Expect(err).To(BeNil())
+			Expect(history).To(BeEmpty())
+
+			result, err = queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.GetUserTombstone{UserID: userID})
+			Expect(err).To(BeNil())
+			tombstone := result.(*user.Tombstone)
+			Expect(tombstone.Version).To(Equal(uint32(2)))
+			Expect(tombstone.Reason).To(Equal(user.ErasureReasonOperator))
+			Expect(tombstone.DeletionRequestedAt).NotTo(BeNil())
+		})
+
+		Specify("the users are erased for their deletion request only once due and at the expected version", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{UserID: userID, Reason: user.ErasureReasonDeletionRequest})
+			Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
+
+			_, err = commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+			Expect(err).To(BeNil())
+
+			_, err = commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{UserID: userID, Reason: user.ErasureReasonDeletionRequest})
+			Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
+
+			stored, err := repo.FindByID(ctx, userID)
+			Expect(err).To(BeNil())
+			requestedAt := time.Now().Add(-user.DeletionGracePeriod - time.Minute)
+			stored.DeletionRequestedAt = &requestedAt
+			Expect(repo.Update(ctx, *stored, stored.Version)).To(BeNil())
+
+			outdated := stored.Version - 1
+			_, err = commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{UserID: userID, Version: &outdated, Reason: user.ErasureReasonDeletionRequest})
+			Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
+
+			_, err = commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{UserID: userID, Version: &stored.Version, Reason: user.ErasureReasonDeletionRequest})
+			Expect(err).To(BeNil())
+		})
+
+		Specify("the erased email address is free to register again", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{UserID: userID, Reason: user.ErasureReasonOperator})
+			Expect(err).To(BeNil())
+
+			_, err = commands.Dispatch(ctx, user.RegisterUser{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: "user@example.com",
+				Password:     "password",
+			})
+
+			Expect(err).To(BeNil())
+		})
+
+		Specify("a user not found error is returned for an unknown user", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{
+				UserID: uuid.Must(uuid.NewV4()),
+				Reason: user.ErasureReasonOperator,
+			})
+
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+
+		Specify("a validation error is returned for an unknown reason", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.EraseUser{UserID: userID, Reason: "asked by user@example.com"})
+
+			Expect(err).NotTo(BeNil())
+			_, err = repo.FindByID(ctx, userID)
+			Expect(err).To(BeNil())
+		})
+
+		Specify("the users are forbidden to erase themselves and to query the tombstones", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.EraseUser{UserID: userID, Reason: user.ErasureReasonOperator})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+
+			_, err = queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUserTombstone{UserID: userID})
+
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+	})
+
+	Describe("Querying the user history", func() {
+		Specify("every version of the user is returned", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.DeactivateUser{UserID: userID})
+			Expect(err).To(BeNil())
+
+			result, err := queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUserHistory{UserID: userID})
+
+			Expect(err).To(BeNil())
+			history := result.([]user.UserVersion)
+			Expect(history).To(HaveLen(2))
+			Expect(history[1].Version).To(Equal(uint32(2)))
+			Expect(history[1].IsActive).To(BeFalse())
+		})
+
+		Specify("a user not found error is returned for an unknown user", func() {
+			_, err := queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.GetUserHistory{UserID: uuid.Must(uuid.NewV4())})
+
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+	})
+
+	Describe("Recording the logins", func() {
+		Specify("the logins are recorded without publishing events and returned as the login history", func() {
+			for _, method := range []string{user.LoginMethodPassword, user.LoginMethodMagicLink} {
+				_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RecordUserLogin{UserID: userID, Method: method})
+				Expect(err).To(BeNil())
+			}
+
+			result, err := queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUserLogins{UserID: userID})
+
+			Expect(err).To(BeNil())
+			logins := result.([]user.Login)
+			Expect(logins).To(HaveLen(2))
+			Expect(logins[0].Method).To(Equal(user.LoginMethodPassword))
+			Expect(logins[1].Method).To(Equal(user.LoginMethodMagicLink))
+			Expect(publisher.Messages()).To(HaveLen(1))
+		})
+
+		Specify("a user not found error is returned for an unknown user", func() {
+			pk := uuid.Must(uuid.NewV4())
+
+			_, err := commands.Dispatch(bus.WithActor(ctx, pk.String()), user.RecordUserLogin{UserID: pk, Method: user.LoginMethodPassword})
+
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+
+		Specify("a validation error is returned for an unknown method", func() {
+			_, err := commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RecordUserLogin{UserID: userID, Method: "sms"})
+
+			Expect(err).To(MatchError("method: must be a valid value."))
+		})
+
+		Specify("other users are forbidden to record the logins and to query the login history", func() {
+			otherCtx := bus.WithActor(ctx, uuid.Must(uuid.NewV4()).String())
+
+			_, err := commands.Dispatch(otherCtx, user.RecordUserLogin{UserID: userID, Method: user.LoginMethodPassword})
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+
+			_, err = queries.Dispatch(otherCtx, user.GetUserLogins{UserID: userID})
+			Expect(errors.As(err, &bus.Forbidden{})).To(BeTrue())
+		})
+	})
+})
+
+func stringPtr(value string) *string {
+	return &value
+}
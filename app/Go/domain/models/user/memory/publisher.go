@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"sync"
+)
+
+// Message published to the in-memory publisher.
+type Message struct {
+	Topic string
+	Body  []byte
+}
+
+// Publisher keeps the published messages in memory and delivers them to its subscribers, safe for concurrent use.
+type Publisher struct {
+	mu          sync.Mutex
+	messages    []Message
+	subscribers map[*subscription]struct{}
+}
+
+type subscription struct {
+	mu     sync.Mutex
+	topics map[string]bool
+	handle func(topic string, body []byte)
+}
+
+// Publish stores the message and delivers it to the subscribers of its topic before returning.
+func (p *Publisher) Publish(topic string, body []byte) error {
+	p.mu.Lock()
+	p.messages = append(p.messages, Message{Topic: topic, Body: body})
+
+	var subscribers []*subscription
+	for s := range p.subscribers {
+		if s.topics[topic] {
+			subscribers = append(subscribers, s)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, s := range subscribers {
+		s.mu.Lock()
+		s.handle(topic, body)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Messages published so far in the order they were published.
+func (p *Publisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Message(nil), p.messages...)
+}
+
+// Subscribe to the messages published to the topics from now on.
+func (p *Publisher) Subscribe(topics []string, handle func(topic string, body []byte)) (func(), error) {
+	s := &subscription{topics: map[string]bool{}, handle: handle}
+	for _, topic := range topics {
+		s.topics[topic] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.subscribers == nil {
+		p.subscribers = map[*subscription]struct{}{}
+	}
+	p.subscribers[s] = struct{}{}
+
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		delete(p.subscribers, s)
+	}, nil
+}
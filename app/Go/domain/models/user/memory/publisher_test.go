@@ -0,0 +1,27 @@
+package memory_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+)
+
+var _ = Describe("In-memory publisher", func() {
+	Specify("the subscribers receive the messages of their topics until they unsubscribe", func() {
+		publisher := &memory.Publisher{}
+
+		var received []memory.Message
+		unsubscribe, err := publisher.Subscribe([]string{"new_user"}, func(topic string, body []byte) {
+			received = append(received, memory.Message{Topic: topic, Body: body})
+		})
+		Expect(err).To(BeNil())
+
+		Expect(publisher.Publish("new_user", []byte("first"))).To(Succeed())
+		Expect(publisher.Publish("activated_user", []byte("other topic"))).To(Succeed())
+		unsubscribe()
+		Expect(publisher.Publish("new_user", []byte("after unsubscribing"))).To(Succeed())
+
+		Expect(received).To(Equal([]memory.Message{{Topic: "new_user", Body: []byte("first")}}))
+		Expect(publisher.Messages()).To(HaveLen(3))
+	})
+})
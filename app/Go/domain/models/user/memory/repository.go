@@ -0,0 +1,300 @@
+package memory
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserRepository stores users in memory, safe for concurrent use.
+type UserRepository struct {
+	mu         sync.RWMutex
+	users      map[uuid.UUID]user.User
+	versions   map[uuid.UUID][]user.UserVersion
+	logins     map[uuid.UUID][]user.Login
+	tombstones map[uuid.UUID]user.Tombstone
+}
+
+// NewUserRepository with no users stored.
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		users:      map[uuid.UUID]user.User{},
+		versions:   map[uuid.UUID][]user.UserVersion{},
+		logins:     map[uuid.UUID][]user.Login{},
+		tombstones: map[uuid.UUID]user.Tombstone{},
+	}
+}
+
+// FindByID fetches a user by primary key.
+func (r *UserRepository) FindByID(ctx context.Context, pk uuid.UUID) (*user.User, error) {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[pk]
+	if !ok {
+		return nil, user.UserNotFound{}
+	}
+
+	return &u, nil
+}
+
+// FindByEmail fetches a user by email address.
+func (r *UserRepository) FindByEmail(ctx context.Context, emailAddress string) (*user.User, error) {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, u := range r.users {
+		if u.EmailAddress == emailAddress {
+			return &u, nil
+		}
+	}
+
+	return nil, user.UserNotFound{}
+}
+
+// Insert a new user.
+func (r *UserRepository) Insert(ctx context.Context, u user.User) error {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.users {
+		if stored.EmailAddress == u.EmailAddress {
+			return user.AlreadyExists{}
+		}
+	}
+
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	r.users[u.ID] = u
+	r.record(u)
+
+	return nil
+}
+
+// Update the user if the stored version matches the given one.
+func (r *UserRepository) Update(ctx context.Context, u user.User, version uint32) error {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok || stored.Version != version {
+		return domain_errors.StateConflict{}
+	}
+
+	for _, other := range r.users {
+		if other.ID != u.ID && other.EmailAddress == u.EmailAddress {
+			return user.AlreadyExists{}
+		}
+	}
+
+	u.CreatedAt = stored.CreatedAt
+	r.users[u.ID] = u
+	r.record(u)
+
+	return nil
+}
+
+// Search the users matching the filter.
+func (r *UserRepository) Search(ctx context.Context, filter user.UserFilter) ([]user.User, error) {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched := []user.User{}
+	for _, u := range r.users {
+		if !strings.Contains(strings.ToLower(u.EmailAddress), strings.ToLower(filter.EmailContains)) {
+			continue
+		} else if filter.IsActive != nil && u.IsActive != *filter.IsActive {
+			continue
+		} else if filter.DeletionRequestedBefore != nil && (u.DeletionRequestedAt == nil || !u.DeletionRequestedAt.Before(*filter.DeletionRequestedBefore)) {
+			continue
+		}
+		matched = append(matched, u)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].ID.String() < matched[j].ID.String()
+		}
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+
+	if filter.Offset >= len(matched) {
+		return []user.User{}, nil
+	}
+	matched = matched[filter.Offset:]
+
+	if filter.Limit > 0 && filter.Limit < len(matched) {
+		matched = matched[:filter.Limit]
+	}
+
+	return matched, nil
+}
+
+// History of the user versions.
+func (r *UserRepository) History(ctx context.Context, pk uuid.UUID) ([]user.UserVersion, error) {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]user.UserVersion{}, r.versions[pk]...), nil
+}
+
+// Logins of the user.
+func (r *UserRepository) Logins(ctx context.Context, pk uuid.UUID) ([]user.Login, error) {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]user.Login{}, r.logins[pk]...), nil
+}
+
+// InsertLogin of an existing user.
+func (r *UserRepository) InsertLogin(ctx context.Context, login user.Login) error {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[login.UserID]; !ok {
+		return user.UserNotFound{}
+	}
+
+	if login.LoggedInAt.IsZero() {
+		login.LoggedInAt = time.Now()
+	}
+	r.logins[login.UserID] = append(r.logins[login.UserID], login)
+
+	return nil
+}
+
+// FindTombstone of an erased user.
+func (r *UserRepository) FindTombstone(ctx context.Context, pk uuid.UUID) (*user.Tombstone, error) {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tombstone, ok := r.tombstones[pk]
+	if !ok {
+		return nil, user.UserNotFound{}
+	}
+
+	return &tombstone, nil
+}
+
+// Erase the user, its history and its logins, the tombstone is stored instead.
+func (r *UserRepository) Erase(ctx context.Context, pk uuid.UUID, tombstone user.Tombstone) error {
+	if err := domain_errors.FromContext(ctx); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[pk]; !ok {
+		return user.UserNotFound{}
+	}
+
+	if tombstone.ErasedAt.IsZero() {
+		tombstone.ErasedAt = time.Now()
+	}
+	delete(r.users, pk)
+	delete(r.versions, pk)
+	delete(r.logins, pk)
+	r.tombstones[pk] = tombstone
+
+	return nil
+}
+
+// record the user state in its history, the caller has to hold the write lock.
+func (r *UserRepository) record(u user.User) {
+	r.versions[u.ID] = append(r.versions[u.ID], user.UserVersion{
+		UserID:       u.ID,
+		Version:      u.Version,
+		EmailAddress: u.EmailAddress,
+		IsActive:     u.IsActive,
+		DisplayName:  u.DisplayName,
+		Locale:       u.Locale,
+		Timezone:     u.Timezone,
+		AvatarURL:    u.AvatarURL,
+		RecordedAt:   time.Now(),
+	})
+}
+
+// clone the repository contents into a new repository.
+func (r *UserRepository) clone() *UserRepository {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make(map[uuid.UUID]user.User, len(r.users))
+	for id, u := range r.users {
+		users[id] = u
+	}
+
+	versions := make(map[uuid.UUID][]user.UserVersion, len(r.versions))
+	for id, v := range r.versions {
+		versions[id] = append([]user.UserVersion{}, v...)
+	}
+
+	logins := make(map[uuid.UUID][]user.Login, len(r.logins))
+	for id, l := range r.logins {
+		logins[id] = append([]user.Login{}, l...)
+	}
+
+	tombstones := make(map[uuid.UUID]user.Tombstone, len(r.tombstones))
+	for id, t := range r.tombstones {
+		tombstones[id] = t
+	}
+
+	return &UserRepository{users: users, versions: versions, logins: logins, tombstones: tombstones}
+}
+
+// replace the repository contents with the contents of the other repository.
+func (r *UserRepository) replace(other *UserRepository) {
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.users = other.users
+	r.versions = other.versions
+	r.logins = other.logins
+	r.tombstones = other.tombstones
+}
@@ -0,0 +1,64 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/domain/models/user/usertest"
+	"sync"
+)
+
+var _ = Describe("In-memory user repository", func() {
+	var repo *memory.UserRepository
+
+	BeforeEach(func() {
+		repo = memory.NewUserRepository()
+	})
+
+	usertest.RepositoryContract(func() user.Repository {
+		return repo
+	})
+
+	When("the same email address is inserted concurrently", func() {
+		Specify("only one of the users is stored", func() {
+			var (
+				wg       sync.WaitGroup
+				mu       sync.Mutex
+				inserted int
+				rejected int
+			)
+
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					err := repo.Insert(context.Background(), user.User{
+						ID:           uuid.Must(uuid.NewV4()),
+						EmailAddress: "concurrent@example.com",
+						Password:     fmt.Sprintf("someHashedPassword%d", i),
+						IsActive:     true,
+						Version:      1,
+					})
+
+					mu.Lock()
+					defer mu.Unlock()
+					if err == nil {
+						inserted++
+					} else if errors.As(err, &user.AlreadyExists{}) {
+						rejected++
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			Expect(inserted).To(Equal(1))
+			Expect(rejected).To(Equal(9))
+		})
+	})
+})
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"sync"
+)
+
+// UnitOfWork runs the command handlers one at a time against a copy of the repository
+// and replaces the repository contents with the copy once the handler succeeds.
+type UnitOfWork struct {
+	mu        sync.Mutex
+	users     *UserRepository
+	publisher events.Publisher
+
+	// OnPublishError is called when an event fails to be published after the commit.
+	OnPublishError func(event events.Event, err error)
+}
+
+// NewUnitOfWork on top of the given repository.
+func NewUnitOfWork(users *UserRepository, publisher events.Publisher) *UnitOfWork {
+	return &UnitOfWork{
+		users:     users,
+		publisher: publisher,
+	}
+}
+
+// Do runs the command handler and publishes the recorded events once its changes are applied.
+func (u *UnitOfWork) Do(ctx context.Context, fn user.CommandFunc) error {
+	recorder := &events.Recorder{}
+
+	if err := u.commit(ctx, fn, recorder); err != nil {
+		return err
+	}
+
+	for _, event := range recorder.Events() {
+		if err := events.Publish(ctx, u.publisher, event); err != nil && u.OnPublishError != nil {
+			u.OnPublishError(event, err)
+		}
+	}
+
+	return nil
+}
+
+func (u *UnitOfWork) commit(ctx context.Context, fn user.CommandFunc, recorder *events.Recorder) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	tx := u.users.clone()
+	if err := fn(ctx, tx, recorder); err != nil {
+		return err
+	}
+
+	u.users.replace(tx)
+
+	return nil
+}
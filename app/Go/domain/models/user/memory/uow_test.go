@@ -0,0 +1,135 @@
+package memory_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("In-memory unit of work", func() {
+	var (
+		ctx         = context.Background()
+		repo        *memory.UserRepository
+		publisher   *memory.Publisher
+		unitOfWork  *memory.UnitOfWork
+		pendingUser user.PendingUser
+	)
+
+	BeforeEach(func() {
+		repo = memory.NewUserRepository()
+		publisher = &memory.Publisher{}
+		unitOfWork = memory.NewUnitOfWork(repo, publisher)
+
+		pendingUser = user.PendingUser{
+			ID:           uuid.Must(uuid.NewV4()),
+			EmailAddress: "user@example.com",
+			Password:     "password",
+		}
+	})
+
+	When("the command succeeds", func() {
+		Specify("the changes are stored and the events are published", func() {
+			err := unitOfWork.Do(ctx, func(ctx context.Context, repo user.Repository, recorder *events.Recorder) error {
+				event, err := user.Create(ctx, repo, pendingUser)
+				if err != nil {
+					return err
+				}
+
+				recorder.Record(event)
+
+				return nil
+			})
+			Expect(err).To(BeNil())
+
+			_, err = repo.FindByID(ctx, pendingUser.ID)
+			Expect(err).To(BeNil())
+
+			messages := publisher.Messages()
+			Expect(messages).To(HaveLen(1))
+			Expect(messages[0].Topic).To(Equal("new_user"))
+		})
+
+		Specify("the events are published in envelopes carrying the trace context", func() {
+			otel.SetTextMapPropagator(propagation.TraceContext{})
+			traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+			spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+			tracedCtx := trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    traceID,
+				SpanID:     spanID,
+				TraceFlags: trace.FlagsSampled,
+			}))
+
+			err := unitOfWork.Do(tracedCtx, func(ctx context.Context, repo user.Repository, recorder *events.Recorder) error {
+				event, err := user.Create(ctx, repo, pendingUser)
+				if err != nil {
+					return err
+				}
+
+				recorder.Record(event)
+
+				return nil
+			})
+			Expect(err).To(BeNil())
+
+			envelope := events.Envelope{}
+			Expect(json.Unmarshal(publisher.Messages()[0].Body, &envelope)).To(Succeed())
+			Expect(envelope.Event).To(MatchJSON(fmt.Sprintf(`{"UserID": %q, "EmailAddress": "user@example.com", "Version": 1}`, pendingUser.ID)))
+			Expect(envelope.TraceContext).To(HaveKeyWithValue("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"))
+
+			continued := events.ContextFromPayload(context.Background(), publisher.Messages()[0].Body)
+			Expect(trace.SpanContextFromContext(continued).TraceID()).To(Equal(traceID))
+		})
+
+		Specify("the events carry the correlation ID of the context", func() {
+			correlatedCtx := events.WithCorrelationID(ctx, "request-1")
+
+			err := unitOfWork.Do(correlatedCtx, func(ctx context.Context, repo user.Repository, recorder *events.Recorder) error {
+				event, err := user.Create(ctx, repo, pendingUser)
+				if err != nil {
+					return err
+				}
+
+				recorder.Record(event)
+
+				return nil
+			})
+			Expect(err).To(BeNil())
+
+			envelope := events.Envelope{}
+			Expect(json.Unmarshal(publisher.Messages()[0].Body, &envelope)).To(Succeed())
+			Expect(envelope.CorrelationID).To(Equal("request-1"))
+		})
+	})
+
+	When("the command fails", func() {
+		Specify("the changes are discarded and no events are published", func() {
+			commandErr := errors.New("command failed")
+
+			err := unitOfWork.Do(ctx, func(ctx context.Context, repo user.Repository, recorder *events.Recorder) error {
+				event, err := user.Create(ctx, repo, pendingUser)
+				if err != nil {
+					return err
+				}
+
+				recorder.Record(event)
+
+				return commandErr
+			})
+			Expect(err).To(Equal(commandErr))
+
+			_, err = repo.FindByID(ctx, pendingUser.ID)
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+			Expect(publisher.Messages()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,345 @@
+package user
+
+import (
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/gofrs/uuid"
+	"regexp"
+	"time"
+)
+
+// RegisterUser command signs up a new active user.
+type RegisterUser struct {
+	ID           uuid.UUID `json:"id"`
+	EmailAddress string    `json:"email_address"`
+	Password     string    `json:"password"`
+}
+
+// DeactivateUser command deactivates an active user, the user has to be at the given version if any.
+type DeactivateUser struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Version *uint32   `json:"version"`
+}
+
+// ActivateUser command activates an inactive user, the user has to be at the given version if any.
+type ActivateUser struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Version *uint32   `json:"version"`
+}
+
+// ChangeUserEmail command replaces the email address of a user regardless of its state,
+// the user has to still have the old email address and to be at the given version if any.
+type ChangeUserEmail struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Version         *uint32   `json:"version"`
+	OldEmailAddress string    `json:"old_email_address"`
+	NewEmailAddress string    `json:"new_email_address"`
+}
+
+// RequestUserDeletion command deactivates a user regardless of its state and schedules its erasure
+// once the DeletionGracePeriod is over.
+type RequestUserDeletion struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// EraseUser command removes a user along with its personal data and records a tombstone for audit.
+// The user has to be at the given version if any, and due for erasure when erased for its deletion request.
+type EraseUser struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Version *uint32   `json:"version"`
+	Reason  string    `json:"reason"`
+}
+
+// RecordUserLogin command records a successful login of a user in its login history.
+type RecordUserLogin struct {
+	UserID uuid.UUID `json:"user_id"`
+	Method string    `json:"method"`
+}
+
+// UpdateUser command changes the given profile fields of a user and activates or deactivates it at once,
+// setting the current state is a no-op. The user has to be at the given version if any.
+type UpdateUser struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Version     *uint32   `json:"version"`
+	IsActive    *bool     `json:"is_active"`
+	DisplayName *string   `json:"display_name"`
+	Locale      *string   `json:"locale"`
+	Timezone    *string   `json:"timezone"`
+	AvatarURL   *string   `json:"avatar_url"`
+}
+
+// MaxDisplayNameLength of the user profile in characters.
+const MaxDisplayNameLength = 100
+
+// localePattern matches the BCP 47 language tags made of a language, an optional script and an optional region, e.g. en-US.
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// httpURLPattern restricts the avatar URLs to the HTTP schemes.
+var httpURLPattern = regexp.MustCompile(`^https?://`)
+
+// Page sizes of the ListUsers query.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 1000
+)
+
+// ResetUserPassword command replaces the password of a user regardless of its state.
+type ResetUserPassword struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Password string    `json:"password"`
+}
+
+// GetUser query fetches a user by ID regardless of its state.
+type GetUser struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// GetUserByEmail query fetches a user by email address regardless of its state.
+type GetUserByEmail struct {
+	EmailAddress string `json:"email_address"`
+}
+
+// ListUsers query searches the users by email address and state,
+// DeletionRequestedBefore narrows them down to the ones waiting for the erasure since before the given time.
+type ListUsers struct {
+	EmailContains           string     `json:"email_contains"`
+	IsActive                *bool      `json:"is_active"`
+	DeletionRequestedBefore *time.Time `json:"deletion_requested_before"`
+	Limit                   int        `json:"limit"`
+	Offset                  int        `json:"offset"`
+}
+
+// GetUserHistory query fetches the recorded versions of a user.
+type GetUserHistory struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// GetUserLogins query fetches the login history of a user.
+type GetUserLogins struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// GetUserTombstone query fetches the audit record of an erased user.
+type GetUserTombstone struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// UserView is the read model returned by the user queries.
+type UserView struct {
+	ID           uuid.UUID `json:"id"`
+	EmailAddress string    `json:"email_address"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	Version      uint32    `json:"version"`
+	DisplayName  string    `json:"display_name"`
+	Locale       string    `json:"locale"`
+	Timezone     string    `json:"timezone"`
+	AvatarURL    string    `json:"avatar_url"`
+	// DeletionRequestedAt is set while the user waits for the erasure.
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at"`
+}
+
+func (c RegisterUser) MessageName() string {
+	return "user.RegisterUser"
+}
+
+func (c DeactivateUser) MessageName() string {
+	return "user.DeactivateUser"
+}
+
+func (c ActivateUser) MessageName() string {
+	return "user.ActivateUser"
+}
+
+func (c ResetUserPassword) MessageName() string {
+	return "user.ResetUserPassword"
+}
+
+func (c ChangeUserEmail) MessageName() string {
+	return "user.ChangeUserEmail"
+}
+
+func (c UpdateUser) MessageName() string {
+	return "user.UpdateUser"
+}
+
+func (c RequestUserDeletion) MessageName() string {
+	return "user.RequestUserDeletion"
+}
+
+func (c EraseUser) MessageName() string {
+	return "user.EraseUser"
+}
+
+func (c RecordUserLogin) MessageName() string {
+	return "user.RecordUserLogin"
+}
+
+func (q GetUser) MessageName() string {
+	return "user.GetUser"
+}
+
+func (q GetUserByEmail) MessageName() string {
+	return "user.GetUserByEmail"
+}
+
+func (q ListUsers) MessageName() string {
+	return "user.ListUsers"
+}
+
+func (q GetUserHistory) MessageName() string {
+	return "user.GetUserHistory"
+}
+
+func (q GetUserLogins) MessageName() string {
+	return "user.GetUserLogins"
+}
+
+func (q GetUserTombstone) MessageName() string {
+	return "user.GetUserTombstone"
+}
+
+// Validate the registration details.
+func (c RegisterUser) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.EmailAddress, validation.Required, is.Email),
+		validation.Field(&c.Password, validation.Required, validation.Length(6, 20)),
+	)
+}
+
+// Validate the user ID is present.
+func (c DeactivateUser) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+	)
+}
+
+// Validate the user ID is present.
+func (c ActivateUser) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+	)
+}
+
+// Validate the user ID and the new password.
+func (c ResetUserPassword) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+		validation.Field(&c.Password, validation.Required, validation.Length(6, 20)),
+	)
+}
+
+// Validate the user ID and the email addresses.
+func (c ChangeUserEmail) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+		validation.Field(&c.OldEmailAddress, validation.Required, is.Email),
+		validation.Field(&c.NewEmailAddress, validation.Required, is.Email),
+	)
+}
+
+// Validate the user ID and the profile fields.
+func (c UpdateUser) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+		validation.Field(&c.DisplayName, validation.RuneLength(0, MaxDisplayNameLength)),
+		validation.Field(&c.Locale, validation.Match(localePattern).Error("must be a language tag such as en-US")),
+		validation.Field(&c.Timezone, validation.By(isTimezone)),
+		validation.Field(&c.AvatarURL, is.URL, validation.Match(httpURLPattern).Error("must be an HTTP URL")),
+	)
+}
+
+// Validate the user ID is present.
+func (c RequestUserDeletion) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+	)
+}
+
+// Validate the user ID and the reason, the reason is one of the known ones to keep personal data out of the tombstone.
+func (c EraseUser) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+		validation.Field(&c.Reason, validation.Required, validation.In(ErasureReasonDeletionRequest, ErasureReasonOperator, ErasureReasonLegalRequest)),
+	)
+}
+
+// Validate the user ID and the login method.
+func (c RecordUserLogin) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserID, validation.Required),
+		validation.Field(&c.Method, validation.Required, validation.In(LoginMethodPassword, LoginMethodMagicLink)),
+	)
+}
+
+// Validate the user ID is present.
+func (q GetUser) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.UserID, validation.Required),
+	)
+}
+
+// Validate the email address.
+func (q GetUserByEmail) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.EmailAddress, validation.Required, is.Email),
+	)
+}
+
+// Validate the pagination boundaries.
+func (q ListUsers) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Limit, validation.Min(0), validation.Max(MaxListLimit)),
+		validation.Field(&q.Offset, validation.Min(0)),
+	)
+}
+
+// Validate the user ID is present.
+func (q GetUserHistory) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.UserID, validation.Required),
+	)
+}
+
+// Validate the user ID is present.
+func (q GetUserLogins) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.UserID, validation.Required),
+	)
+}
+
+// Validate the user ID is present.
+func (q GetUserTombstone) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.UserID, validation.Required),
+	)
+}
+
+// newUserView from the persistence model.
+func newUserView(user User) *UserView {
+	return &UserView{
+		ID:                  user.ID,
+		EmailAddress:        user.EmailAddress,
+		IsActive:            user.IsActive,
+		CreatedAt:           user.CreatedAt,
+		Version:             user.Version,
+		DisplayName:         user.DisplayName,
+		Locale:              user.Locale,
+		Timezone:            user.Timezone,
+		AvatarURL:           user.AvatarURL,
+		DeletionRequestedAt: user.DeletionRequestedAt,
+	}
+}
+
+// isTimezone checks the value is the name of an IANA time zone, e.g. Europe/Berlin.
+func isTimezone(value interface{}) error {
+	name, _ := value.(*string)
+	if name == nil || *name == "" {
+		return nil
+	} else if _, err := time.LoadLocation(*name); err != nil || *name == "Local" {
+		return errors.New("must be an IANA time zone such as Europe/Berlin")
+	}
+
+	return nil
+}
@@ -1,10 +1,13 @@
 package user
 
 import (
+	"context"
 	"errors"
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
+	"runtime"
 	"time"
 )
 
@@ -37,21 +40,111 @@ type User struct {
 	IsActive     bool      `gorm:"not null" json:"is_active"`
 	CreatedAt    time.Time `gorm:"default:now();not null" json:"created_at"`
 	Version      uint32    `gorm:"not null" json:"version"`
+	DisplayName  string    `gorm:"not null" json:"display_name"`
+	Locale       string    `gorm:"not null" json:"locale"`
+	Timezone     string    `gorm:"not null" json:"timezone"`
+	AvatarURL    string    `gorm:"not null" json:"avatar_url"`
+	// DeletionRequestedAt is set while the user waits for the erasure, see DeletionGracePeriod.
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at"`
+}
+
+// DeletionGracePeriod between the deletion request of a user and its erasure, activating the user cancels the request.
+const DeletionGracePeriod = time.Hour * 24 * 30
+
+// Reasons of the user erasures recorded in the tombstones.
+const (
+	ErasureReasonDeletionRequest = "deletion_request"
+	ErasureReasonOperator        = "operator"
+	ErasureReasonLegalRequest    = "legal_request"
+)
+
+// Tombstone records the erasure of a user for audit, it carries no personal data.
+type Tombstone struct {
+	UserID              uuid.UUID  `json:"user_id"`
+	Version             uint32     `json:"version"`
+	Reason              string     `json:"reason"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at"`
+	ErasedAt            time.Time  `json:"erased_at"`
+}
+
+// Methods of the user logins recorded in the login history.
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodMagicLink = "magic_link"
+)
+
+// Login records a successful login of a user in its login history.
+type Login struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Method     string    `json:"method"`
+	LoggedInAt time.Time `json:"logged_in_at"`
+}
+
+// ProfileChanges to the user, the nil fields are kept as they are.
+type ProfileChanges struct {
+	DisplayName *string
+	Locale      *string
+	Timezone    *string
+	AvatarURL   *string
+}
+
+// UserVersion represents a recorded state of the user entity, the password is never recorded.
+type UserVersion struct {
+	UserID       uuid.UUID `json:"user_id"`
+	Version      uint32    `json:"version"`
+	EmailAddress string    `json:"email_address"`
+	IsActive     bool      `json:"is_active"`
+	DisplayName  string    `json:"display_name"`
+	Locale       string    `json:"locale"`
+	Timezone     string    `json:"timezone"`
+	AvatarURL    string    `json:"avatar_url"`
+	RecordedAt   time.Time `json:"recorded_at"`
+}
+
+// tracer of the password hashing.
+var tracer = otel.Tracer("go-ddd-cqrs-example/domain/models/user")
+
+// PasswordHashObserver is notified of the duration of every bcrypt operation, either hash or verify, e.g. to export metrics.
+// It is set at startup before any password is hashed.
+var PasswordHashObserver func(operation string, duration time.Duration)
+
+// observePasswordHash started at the given time.
+func observePasswordHash(operation string, start time.Time) {
+	if PasswordHashObserver != nil {
+		PasswordHashObserver(operation, time.Since(start))
+	}
 }
 
 // VerifyUserPassword with the hash stored in database.
-func VerifyUserPassword(db *gorm.DB, emailAddress string, password string) error {
-	userPasswordHash, err := GetUserPasswordHash(*db, emailAddress, nil)
+func VerifyUserPassword(ctx context.Context, repo UserReader, emailAddress string, password string) error {
+	userPasswordHash, err := GetUserPasswordHash(ctx, repo, emailAddress, nil)
 	if err != nil {
 		return err
 	}
 
-	return bcrypt.CompareHashAndPassword([]byte(*userPasswordHash), []byte(password))
+	_, span := tracer.Start(ctx, "bcrypt verify")
+	defer span.End()
+
+	return withContext(ctx, func() error {
+		defer observePasswordHash("verify", time.Now())
+		return bcrypt.CompareHashAndPassword([]byte(*userPasswordHash), []byte(password))
+	})
 }
 
 // Hash the password.
-func Hash(password string) (*string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func Hash(ctx context.Context, password string) (*string, error) {
+	_, span := tracer.Start(ctx, "bcrypt hash")
+	defer span.End()
+
+	var hash []byte
+
+	err := withContext(ctx, func() error {
+		defer observePasswordHash("hash", time.Now())
+
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -61,14 +154,9 @@ func Hash(password string) (*string, error) {
 	return &hashString, err
 }
 
-func isEmailAddressUnique(db gorm.DB, emailAddress string) (error, bool) {
-	var user User
-
-	if err := db.Model(&user).Where(
-		"email_address = ?",
-		emailAddress,
-	).First(&user).Error; err != nil {
-		if errors.As(err, &gorm.ErrRecordNotFound) {
+func isEmailAddressUnique(ctx context.Context, repo UserReader, emailAddress string) (error, bool) {
+	if _, err := repo.FindByEmail(ctx, emailAddress); err != nil {
+		if errors.As(err, &UserNotFound{}) {
 			return nil, true
 		}
 		return err, false
@@ -76,3 +164,36 @@ func isEmailAddressUnique(db gorm.DB, emailAddress string) (error, bool) {
 
 	return nil, false
 }
+
+// passwordHashSlots bound the bcrypt operations running at once to the number of CPUs, the abandoned ones included.
+var passwordHashSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// withContext runs the CPU heavy function in background and stops waiting for it once the context is done.
+// The function cannot be interrupted, so it is abandoned rather than cancelled and keeps using the CPU until it returns.
+// It holds one of the passwordHashSlots until then, so the abandoned functions cannot pile up, and the callers beyond
+// the limit wait for a slot until their context is done.
+func withContext(ctx context.Context, fn func() error) error {
+	select {
+	case passwordHashSlots <- struct{}{}:
+	case <-ctx.Done():
+		return domain_errors.FromContext(ctx)
+	}
+
+	if err := domain_errors.FromContext(ctx); err != nil {
+		<-passwordHashSlots
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-passwordHashSlots }()
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return domain_errors.FromContext(ctx)
+	}
+}
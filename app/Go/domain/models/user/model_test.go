@@ -0,0 +1,68 @@
+package user
+
+import (
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"time"
+)
+
+var _ = Describe("Running the password hashing", func() {
+	Specify("the abandoned function holds its slot until it returns", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		release := make(chan struct{})
+		started := make(chan struct{})
+
+		go func() {
+			defer GinkgoRecover()
+
+			err := withContext(ctx, func() error {
+				close(started)
+				<-release
+				return nil
+			})
+			Expect(errors.As(err, &domain_errors.Canceled{})).To(BeTrue())
+		}()
+
+		<-started
+		cancel()
+		Consistently(func() int { return len(passwordHashSlots) }, 50*time.Millisecond).Should(Equal(1))
+
+		close(release)
+		Eventually(func() int { return len(passwordHashSlots) }).Should(Equal(0))
+	})
+
+	Specify("the callers beyond the limit wait for a slot until their context is done", func() {
+		for i := 0; i < cap(passwordHashSlots); i++ {
+			passwordHashSlots <- struct{}{}
+		}
+		defer func() {
+			for len(passwordHashSlots) > 0 {
+				<-passwordHashSlots
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		called := false
+		err := withContext(ctx, func() error {
+			called = true
+			return nil
+		})
+
+		Expect(errors.As(err, &domain_errors.Timeout{})).To(BeTrue())
+		Expect(called).To(BeFalse())
+
+		<-passwordHashSlots
+		err = withContext(context.Background(), func() error {
+			called = true
+			return nil
+		})
+
+		Expect(err).To(BeNil())
+		Expect(called).To(BeTrue())
+	})
+})
@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jinzhu/gorm"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// ContextConn is implemented by both *sql.DB and *sql.Tx.
+type ContextConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tracer of the queries and the event publishes.
+var tracer = otel.Tracer("go-ddd-cqrs-example/domain/models/user/postgres")
+
+// Conn returns the connection or transaction underlying gorm.
+// gorm v1 doesn't support contexts, so the queries which need to be cancellable go through database/sql directly.
+// Every query is traced with a span of the trace in the context.
+func Conn(db *gorm.DB) (ContextConn, error) {
+	conn, ok := db.CommonDB().(ContextConn)
+	if !ok {
+		return nil, errors.New("Database handle does not support contexts")
+	}
+
+	return tracedConn{conn: conn}, nil
+}
+
+// tracedConn starts a span for every query.
+type tracedConn struct {
+	conn ContextConn
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	result, err := c.conn.ExecContext(ctx, query, args...)
+	endQuerySpan(span, err)
+
+	return result, err
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	rows, err := c.conn.QueryContext(ctx, query, args...)
+	endQuerySpan(span, err)
+
+	return rows, err
+}
+
+func (c tracedConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	row := c.conn.QueryRowContext(ctx, query, args...)
+	endQuerySpan(span, row.Err())
+
+	return row
+}
+
+// startQuerySpan named after the SQL operation, e.g. SELECT, the arguments aren't recorded as they may hold personal data.
+// The queries outside of a trace, e.g. the outbox scans, don't start new traces.
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	query = strings.TrimSpace(query)
+
+	operation := query
+	if i := strings.IndexAny(query, " \n\t("); i > 0 {
+		operation = query[:i]
+	}
+	operation = strings.ToUpper(operation)
+
+	return tracer.Start(ctx, "postgres "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", query),
+		),
+	)
+}
+
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// ContextError replaces the query error with Timeout error if the query has been interrupted by the context.
+func ContextError(ctx context.Context, err error) error {
+	if ctxErr := domain_errors.FromContext(ctx); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
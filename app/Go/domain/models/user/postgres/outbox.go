@@ -0,0 +1,273 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"go-ddd-cqrs-example/domain/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// Relay defaults.
+const (
+	DefaultRelayInterval  = time.Second
+	DefaultRelayBatchSize = 100
+)
+
+// userEventCondition matches the outbox events of the user passed as the first argument.
+const userEventCondition = "user_id = $1"
+
+// userEvent carries the ID of its user, stored along with the event so that the events of the user are found by index.
+type userEvent interface {
+	GetUserID() string
+}
+
+// StoredEvent of the outbox without its envelope.
+type StoredEvent struct {
+	Topic       string          `json:"topic"`
+	Event       json.RawMessage `json:"event"`
+	CreatedAt   time.Time       `json:"created_at"`
+	PublishedAt *time.Time      `json:"published_at"`
+}
+
+// UserEvents stored in the outbox for the user whether published or not, in the order they were stored.
+func UserEvents(ctx context.Context, db *gorm.DB, userID uuid.UUID) ([]StoredEvent, error) {
+	conn, err := Conn(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx,
+		"SELECT topic, payload, created_at, published_at FROM outbox WHERE "+userEventCondition+" ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading user events: %w", ContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	stored := []StoredEvent{}
+	for rows.Next() {
+		var (
+			e        StoredEvent
+			payload  []byte
+			envelope events.Envelope
+		)
+		if err := rows.Scan(&e.Topic, &payload, &e.CreatedAt, &e.PublishedAt); err != nil {
+			return nil, fmt.Errorf("Error reading user events: %w", err)
+		}
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			return nil, fmt.Errorf("Error decoding user event: %w", err)
+		}
+		e.Event = envelope.Event
+		stored = append(stored, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading user events: %w", ContextError(ctx, err))
+	}
+
+	return stored, nil
+}
+
+// storeEvents in the outbox within the transaction of the command, the relay publishes them after the commit.
+func storeEvents(ctx context.Context, db *gorm.DB, recorded []events.Event) error {
+	if len(recorded) == 0 {
+		return nil
+	}
+
+	conn, err := Conn(db)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range recorded {
+		payload, err := events.Marshal(ctx, event)
+		if err != nil {
+			return err
+		}
+
+		var userID *uuid.UUID
+		if e, ok := event.(userEvent); ok {
+			if id, err := uuid.FromString(e.GetUserID()); err == nil {
+				userID = &id
+			}
+		}
+
+		_, err = conn.ExecContext(ctx, `INSERT INTO outbox (topic, payload, user_id) VALUES ($1, $2, $3)`, event.Topic(), payload, userID)
+		if err != nil {
+			return fmt.Errorf("Error storing event: %w", ContextError(ctx, err))
+		}
+	}
+
+	return nil
+}
+
+// Relay publishes the events stored in the outbox in the order they were stored.
+// An event is published at least once, it is marked as published only after the publisher accepts it.
+type Relay struct {
+	db        *gorm.DB
+	publisher events.Publisher
+	wake      chan struct{}
+
+	// Interval between the outbox scans when the relay is not notified.
+	Interval time.Duration
+	// BatchSize of the events published per transaction.
+	BatchSize int
+	// OnError is called when the outbox scan or an event publish fails, the events are retried on the next scan.
+	OnError func(err error)
+}
+
+// NewRelay of the outbox stored in the given database.
+func NewRelay(db *gorm.DB, publisher events.Publisher) *Relay {
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		wake:      make(chan struct{}, 1),
+		Interval:  DefaultRelayInterval,
+		BatchSize: DefaultRelayBatchSize,
+	}
+}
+
+// Notify the relay about the newly committed events to publish them without waiting for the next scan.
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes the events until the context is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+
+		if err := r.Flush(ctx); err != nil && ctx.Err() == nil && r.OnError != nil {
+			r.OnError(err)
+		}
+	}
+}
+
+// Flush publishes all the pending events, it stops at the first event failed to be published to keep the order.
+func (r *Relay) Flush(ctx context.Context) error {
+	for {
+		published, err := r.publishBatch(ctx)
+		if err != nil {
+			return err
+		}
+
+		if published < r.BatchSize {
+			return nil
+		}
+	}
+}
+
+// publishBatch of the pending events, the batch is locked so that the concurrent relays skip it.
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	// If the connection is already a transaction, the batch joins it and the caller is responsible for the commit.
+	tx := r.db
+	_, joined := r.db.CommonDB().(*sql.Tx)
+	if !joined {
+		tx = r.db.BeginTx(ctx, &sql.TxOptions{})
+		if tx.Error != nil {
+			return 0, fmt.Errorf("Error starting transaction: %w", ContextError(ctx, tx.Error))
+		}
+		defer tx.Rollback()
+	}
+
+	conn, err := Conn(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, topic, payload FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, r.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading outbox: %w", ContextError(ctx, err))
+	}
+
+	type message struct {
+		id      int64
+		topic   string
+		payload []byte
+	}
+
+	var messages []message
+	for rows.Next() {
+		var m message
+		if err := rows.Scan(&m.id, &m.topic, &m.payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("Error reading outbox: %w", ContextError(ctx, err))
+	}
+
+	var (
+		published  []int64
+		publishErr error
+	)
+	for _, m := range messages {
+		if err := r.publish(ctx, m.topic, m.payload); err != nil {
+			publishErr = fmt.Errorf("Error publishing event to %s: %w", m.topic, err)
+			break
+		}
+		published = append(published, m.id)
+	}
+
+	if len(published) > 0 {
+		_, err = conn.ExecContext(ctx, `UPDATE outbox SET published_at = now() WHERE id = ANY($1)`, pq.Array(published))
+		if err != nil {
+			return 0, fmt.Errorf("Error marking events as published: %w", ContextError(ctx, err))
+		}
+	}
+
+	if !joined {
+		if err := tx.Commit().Error; err != nil {
+			return 0, fmt.Errorf("Error committing transaction: %w", ContextError(ctx, err))
+		}
+	}
+
+	return len(published), publishErr
+}
+
+// publish the payload within the span continuing the trace of the command which stored the event.
+func (r *Relay) publish(ctx context.Context, topic string, payload []byte) error {
+	_, span := tracer.Start(events.ContextFromPayload(ctx, payload), "publish "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "nsq"),
+			attribute.String("messaging.destination", topic),
+		),
+	)
+	defer span.End()
+
+	err := r.publisher.Publish(topic, payload)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/utils"
+	"path"
+	"runtime"
+)
+
+// failingPublisher rejects every message.
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(topic string, body []byte) error {
+	return errors.New("broker unavailable")
+}
+
+var _ = Describe("PostgreSQL outbox", func() {
+	var (
+		ctx       = bus.WithActor(context.Background(), bus.SystemActor)
+		db        *gorm.DB
+		publisher *memory.Publisher
+		commands  *bus.Bus
+		notified  int
+	)
+
+	// Set up database connection using the test configuration profile.
+	_, filename, _, _ := runtime.Caller(0)
+	cfg, err := config.Load(path.Join(path.Dir(filename), "../../../../usersapi/cmd/config/configuration.yaml"), config.ProfileTest)
+	Expect(err).To(BeNil())
+	conn, err := utils.GetDB(
+		cfg.DBDriver,
+		cfg.DBUsername,
+		cfg.DBPassword.Value(),
+		cfg.DBPort,
+		cfg.DBHost,
+		cfg.DBName,
+	)
+	Expect(err).To(BeNil())
+
+	BeforeEach(func() {
+		db = conn.Begin()
+		publisher = &memory.Publisher{}
+		notified = 0
+
+		unitOfWork := postgres.NewUnitOfWork(db)
+		unitOfWork.OnCommit = func() { notified++ }
+		commands = user.NewCommandBus(unitOfWork)
+
+		// Start from an empty outbox, the transaction is rolled back after every spec.
+		Expect(db.Exec("UPDATE outbox SET published_at = now() WHERE published_at IS NULL").Error).To(BeNil())
+	})
+
+	AfterEach(func() {
+		_ = db.Rollback()
+	})
+
+	register := func() uuid.UUID {
+		id := uuid.Must(uuid.NewV4())
+		_, err := commands.Dispatch(ctx, user.RegisterUser{
+			ID:           id,
+			EmailAddress: id.String() + "@example.com",
+			Password:     "password",
+		})
+		Expect(err).To(BeNil())
+
+		return id
+	}
+
+	Specify("the events are stored in the transaction and published by the relay in order", func() {
+		first := register()
+		_, err := commands.Dispatch(ctx, user.DeactivateUser{UserID: first})
+		Expect(err).To(BeNil())
+		Expect(notified).To(Equal(2))
+		Expect(publisher.Messages()).To(BeEmpty())
+
+		relay := postgres.NewRelay(db, publisher)
+		Expect(relay.Flush(ctx)).To(BeNil())
+
+		messages := publisher.Messages()
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].Topic).To(Equal("new_user"))
+		Expect(messages[1].Topic).To(Equal("deactivated_user"))
+
+		Expect(relay.Flush(ctx)).To(BeNil())
+		Expect(publisher.Messages()).To(HaveLen(2))
+	})
+
+	Specify("the events failed to be published stay in the outbox", func() {
+		register()
+
+		err := postgres.NewRelay(db, failingPublisher{}).Flush(ctx)
+		Expect(err).To(MatchError("Error publishing event to new_user: broker unavailable"))
+
+		relay := postgres.NewRelay(db, publisher)
+		relay.BatchSize = 1
+		Expect(relay.Flush(ctx)).To(BeNil())
+		Expect(publisher.Messages()).To(HaveLen(1))
+	})
+
+	Specify("the events of a user are read without their envelope until the user is erased", func() {
+		first := register()
+		other := register()
+		_, err := commands.Dispatch(ctx, user.DeactivateUser{UserID: first})
+		Expect(err).To(BeNil())
+		Expect(postgres.NewRelay(db, publisher).Flush(ctx)).To(BeNil())
+
+		stored, err := postgres.UserEvents(ctx, db, first)
+
+		Expect(err).To(BeNil())
+		Expect(stored).To(HaveLen(2))
+		Expect(stored[0].Topic).To(Equal("new_user"))
+		Expect(string(stored[0].Event)).To(ContainSubstring(first.String() + "@example.com"))
+		Expect(stored[0].PublishedAt).NotTo(BeNil())
+		Expect(stored[1].Topic).To(Equal("deactivated_user"))
+
+		var indexed int
+		Expect(db.Raw("SELECT count(*) FROM outbox WHERE user_id = ?", first).Row().Scan(&indexed)).To(BeNil())
+		Expect(indexed).To(Equal(2))
+
+		_, err = commands.Dispatch(ctx, user.EraseUser{UserID: first, Reason: user.ErasureReasonOperator})
+		Expect(err).To(BeNil())
+
+		stored, err = postgres.UserEvents(ctx, db, first)
+
+		Expect(err).To(BeNil())
+		Expect(stored).To(HaveLen(1))
+		Expect(stored[0].Topic).To(Equal("erased_user"))
+
+		stored, err = postgres.UserEvents(ctx, db, other)
+
+		Expect(err).To(BeNil())
+		Expect(stored).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,368 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"strings"
+	"time"
+)
+
+// uniqueViolation is the PostgreSQL error code for unique constraint violations.
+const uniqueViolation = "23505"
+
+const userColumns = "id, email_address, password, is_active, created_at, version, display_name, locale, timezone, avatar_url, deletion_requested_at"
+
+// versionColumns of the users table recorded in the history as historyColumns of the user_versions table.
+const (
+	versionColumns = "id, version, email_address, is_active, display_name, locale, timezone, avatar_url"
+	historyColumns = "user_id, version, email_address, is_active, display_name, locale, timezone, avatar_url"
+)
+
+// UserRepository stores users in PostgreSQL.
+type UserRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository on top of the given connection or transaction.
+func NewUserRepository(db *gorm.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// FindByID fetches a user by primary key.
+func (r *UserRepository) FindByID(ctx context.Context, pk uuid.UUID) (*user.User, error) {
+	return r.findBy(ctx, "id", pk)
+}
+
+// FindByEmail fetches a user by email address.
+func (r *UserRepository) FindByEmail(ctx context.Context, emailAddress string) (*user.User, error) {
+	return r.findBy(ctx, "email_address", emailAddress)
+}
+
+func (r *UserRepository) findBy(ctx context.Context, column string, value interface{}) (*user.User, error) {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var u user.User
+
+	err = conn.QueryRowContext(ctx,
+		"SELECT "+userColumns+" FROM users WHERE "+column+" = $1",
+		value,
+	).Scan(&u.ID, &u.EmailAddress, &u.Password, &u.IsActive, &u.CreatedAt, &u.Version, &u.DisplayName, &u.Locale, &u.Timezone, &u.AvatarURL, &u.DeletionRequestedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.UserNotFound{}
+	} else if err != nil {
+		return nil, ContextError(ctx, err)
+	}
+
+	return &u, nil
+}
+
+// Search the users matching the filter.
+func (r *UserRepository) Search(ctx context.Context, filter user.UserFilter) ([]user.User, error) {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE email_address ILIKE $1"
+	args := []interface{}{"%" + escapeLike(filter.EmailContains) + "%"}
+
+	if filter.IsActive != nil {
+		args = append(args, *filter.IsActive)
+		query += fmt.Sprintf(" AND is_active = $%d", len(args))
+	}
+
+	if filter.DeletionRequestedBefore != nil {
+		args = append(args, *filter.DeletionRequestedBefore)
+		query += fmt.Sprintf(" AND deletion_requested_at < $%d", len(args))
+	}
+
+	query += " ORDER BY created_at, id"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	args = append(args, filter.Offset)
+	query += fmt.Sprintf(" OFFSET $%d", len(args))
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error searching users: %w", ContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	users := []user.User{}
+	for rows.Next() {
+		var u user.User
+		if err := rows.Scan(&u.ID, &u.EmailAddress, &u.Password, &u.IsActive, &u.CreatedAt, &u.Version, &u.DisplayName, &u.Locale, &u.Timezone, &u.AvatarURL, &u.DeletionRequestedAt); err != nil {
+			return nil, fmt.Errorf("Error searching users: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error searching users: %w", ContextError(ctx, err))
+	}
+
+	return users, nil
+}
+
+// History of the user versions.
+func (r *UserRepository) History(ctx context.Context, pk uuid.UUID) ([]user.UserVersion, error) {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx,
+		"SELECT "+historyColumns+", recorded_at FROM user_versions WHERE user_id = $1 ORDER BY version",
+		pk,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading user history: %w", ContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	history := []user.UserVersion{}
+	for rows.Next() {
+		var v user.UserVersion
+		if err := rows.Scan(&v.UserID, &v.Version, &v.EmailAddress, &v.IsActive, &v.DisplayName, &v.Locale, &v.Timezone, &v.AvatarURL, &v.RecordedAt); err != nil {
+			return nil, fmt.Errorf("Error loading user history: %w", err)
+		}
+		history = append(history, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error loading user history: %w", ContextError(ctx, err))
+	}
+
+	return history, nil
+}
+
+// Insert a new user.
+func (r *UserRepository) Insert(ctx context.Context, u user.User) error {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx,
+		"WITH inserted AS ("+
+			"INSERT INTO users (id, email_address, password, is_active, version, display_name, locale, timezone, avatar_url, deletion_requested_at) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) "+
+			"RETURNING "+versionColumns+
+			") INSERT INTO user_versions ("+historyColumns+") SELECT "+versionColumns+" FROM inserted",
+		u.ID,
+		u.EmailAddress,
+		u.Password,
+		u.IsActive,
+		u.Version,
+		u.DisplayName,
+		u.Locale,
+		u.Timezone,
+		u.AvatarURL,
+		u.DeletionRequestedAt,
+	)
+	if isEmailAddressTaken(err) {
+		return user.AlreadyExists{}
+	} else if err != nil {
+		return fmt.Errorf("Error inserting user: %w", ContextError(ctx, err))
+	}
+
+	return nil
+}
+
+// Update the user if the stored version matches the given one.
+func (r *UserRepository) Update(ctx context.Context, u user.User, version uint32) error {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return err
+	}
+
+	result, err := conn.ExecContext(ctx,
+		"WITH updated AS ("+
+			"UPDATE users SET email_address = $1, password = $2, is_active = $3, version = $4, "+
+			"display_name = $5, locale = $6, timezone = $7, avatar_url = $8, deletion_requested_at = $9 "+
+			"WHERE id = $10 AND version = $11 "+
+			"RETURNING "+versionColumns+
+			") INSERT INTO user_versions ("+historyColumns+") SELECT "+versionColumns+" FROM updated",
+		u.EmailAddress,
+		u.Password,
+		u.IsActive,
+		u.Version,
+		u.DisplayName,
+		u.Locale,
+		u.Timezone,
+		u.AvatarURL,
+		u.DeletionRequestedAt,
+		u.ID,
+		version,
+	)
+	if isEmailAddressTaken(err) {
+		return user.AlreadyExists{}
+	} else if err != nil {
+		return fmt.Errorf("Error updating user: %w", ContextError(ctx, err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Error updating user: %w", err)
+	} else if rowsAffected != 1 {
+		return domain_errors.StateConflict{}
+	}
+
+	return nil
+}
+
+// Logins of the user.
+func (r *UserRepository) Logins(ctx context.Context, pk uuid.UUID) ([]user.Login, error) {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx,
+		"SELECT user_id, method, logged_in_at FROM user_logins WHERE user_id = $1 ORDER BY logged_in_at, id",
+		pk,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading user logins: %w", ContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	logins := []user.Login{}
+	for rows.Next() {
+		var l user.Login
+		if err := rows.Scan(&l.UserID, &l.Method, &l.LoggedInAt); err != nil {
+			return nil, fmt.Errorf("Error loading user logins: %w", err)
+		}
+		logins = append(logins, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error loading user logins: %w", ContextError(ctx, err))
+	}
+
+	return logins, nil
+}
+
+// InsertLogin of an existing user.
+func (r *UserRepository) InsertLogin(ctx context.Context, login user.Login) error {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return err
+	}
+
+	result, err := conn.ExecContext(ctx,
+		"INSERT INTO user_logins (user_id, method, logged_in_at) SELECT id, $2, COALESCE($3, now()) FROM users WHERE id = $1",
+		login.UserID,
+		login.Method,
+		nullTime(login.LoggedInAt),
+	)
+	if err != nil {
+		return fmt.Errorf("Error inserting user login: %w", ContextError(ctx, err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Error inserting user login: %w", err)
+	} else if rowsAffected != 1 {
+		return user.UserNotFound{}
+	}
+
+	return nil
+}
+
+// FindTombstone of an erased user.
+func (r *UserRepository) FindTombstone(ctx context.Context, pk uuid.UUID) (*user.Tombstone, error) {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var t user.Tombstone
+
+	err = conn.QueryRowContext(ctx,
+		"SELECT user_id, version, reason, deletion_requested_at, erased_at FROM user_tombstones WHERE user_id = $1",
+		pk,
+	).Scan(&t.UserID, &t.Version, &t.Reason, &t.DeletionRequestedAt, &t.ErasedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.UserNotFound{}
+	} else if err != nil {
+		return nil, fmt.Errorf("Error loading user tombstone: %w", ContextError(ctx, err))
+	}
+
+	return &t, nil
+}
+
+// Erase the user, its history, logins and login links are removed by the foreign keys,
+// while its events are removed from the outbox whether published or not.
+func (r *UserRepository) Erase(ctx context.Context, pk uuid.UUID, tombstone user.Tombstone) error {
+	conn, err := Conn(r.db)
+	if err != nil {
+		return err
+	}
+
+	result, err := conn.ExecContext(ctx, "DELETE FROM users WHERE id = $1", pk)
+	if err != nil {
+		return fmt.Errorf("Error erasing user: %w", ContextError(ctx, err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("Error erasing user: %w", err)
+	} else if rowsAffected != 1 {
+		return user.UserNotFound{}
+	}
+
+	_, err = conn.ExecContext(ctx,
+		"DELETE FROM outbox WHERE "+userEventCondition,
+		pk,
+	)
+	if err != nil {
+		return fmt.Errorf("Error erasing user events: %w", ContextError(ctx, err))
+	}
+
+	_, err = conn.ExecContext(ctx,
+		"INSERT INTO user_tombstones (user_id, version, reason, deletion_requested_at, erased_at) "+
+			"VALUES ($1, $2, $3, $4, COALESCE($5, now()))",
+		pk,
+		tombstone.Version,
+		tombstone.Reason,
+		tombstone.DeletionRequestedAt,
+		nullTime(tombstone.ErasedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("Error storing user tombstone: %w", ContextError(ctx, err))
+	}
+
+	return nil
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// escapeLike escapes the LIKE pattern wildcards in the text.
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
+
+// isEmailAddressTaken checks whether the error is caused by the unique email address constraint.
+func isEmailAddressTaken(err error) bool {
+	var pqErr *pq.Error
+
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == "users_email_address_key"
+}
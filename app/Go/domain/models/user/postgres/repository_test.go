@@ -0,0 +1,47 @@
+package postgres_test
+
+import (
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/domain/models/user/usertest"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/utils"
+	"path"
+	"runtime"
+)
+
+var _ = Describe("PostgreSQL user repository", func() {
+	var (
+		db *gorm.DB
+	)
+
+	// Set up database connection using the test configuration profile.
+	_, filename, _, _ := runtime.Caller(0)
+	cfg, err := config.Load(path.Join(path.Dir(filename), "../../../../usersapi/cmd/config/configuration.yaml"), config.ProfileTest)
+	Expect(err).To(BeNil())
+	conn, err := utils.GetDB(
+		cfg.DBDriver,
+		cfg.DBUsername,
+		cfg.DBPassword.Value(),
+		cfg.DBPort,
+		cfg.DBHost,
+		cfg.DBName,
+	)
+	Expect(err).To(BeNil())
+
+	BeforeEach(func() {
+		db = conn.Begin()
+	})
+
+	AfterEach(func() {
+		_ = db.Rollback()
+	})
+
+	usertest.RepositoryContract(func() user.Repository {
+		return postgres.NewUserRepository(db)
+	})
+})
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"strings"
+)
+
+// PostgreSQL error codes of the transactions which can be safely retried.
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// UnitOfWork runs the command handlers in PostgreSQL transactions.
+// The recorded events are stored in the outbox within the same transaction and published by the Relay.
+type UnitOfWork struct {
+	db *gorm.DB
+
+	// Isolation level of the transactions.
+	Isolation sql.IsolationLevel
+	// MaxRetries of the transactions failed due to serialization failures.
+	MaxRetries int
+	// OnCommit is called once the recorded events are stored, e.g. to notify the relay.
+	// When the unit of work joins the transaction of the caller, the events are visible only after its commit.
+	OnCommit func()
+}
+
+// NewUnitOfWork on top of the given connection.
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{
+		db:         db,
+		Isolation:  sql.LevelSerializable,
+		MaxRetries: 3,
+	}
+}
+
+// Do runs the command handler in a transaction storing the recorded events in the outbox.
+// If the connection is already a transaction, the handler joins it and the caller is responsible for the commit.
+func (u *UnitOfWork) Do(ctx context.Context, fn user.CommandFunc) error {
+	var (
+		recorder *events.Recorder
+		err      error
+	)
+
+	for attempt := 0; ; attempt++ {
+		recorder = &events.Recorder{}
+
+		err = u.run(ctx, fn, recorder)
+		if err == nil || !isRetryable(err) || attempt >= u.MaxRetries {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(recorder.Events()) > 0 && u.OnCommit != nil {
+		u.OnCommit()
+	}
+
+	return nil
+}
+
+func (u *UnitOfWork) run(ctx context.Context, fn user.CommandFunc, recorder *events.Recorder) error {
+	if _, ok := u.db.CommonDB().(*sql.Tx); ok {
+		if err := fn(ctx, NewUserRepository(u.db), recorder); err != nil {
+			return err
+		}
+
+		return storeEvents(ctx, u.db, recorder.Events())
+	}
+
+	tx := u.db.BeginTx(ctx, &sql.TxOptions{Isolation: u.Isolation})
+	if tx.Error != nil {
+		return fmt.Errorf("Error starting transaction: %w", ContextError(ctx, tx.Error))
+	}
+
+	if err := fn(ctx, NewUserRepository(tx), recorder); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := storeEvents(ctx, tx, recorder.Events()); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("Error committing transaction: %w", ContextError(ctx, err))
+	}
+
+	return nil
+}
+
+// ParseIsolationLevel from its SQL name, e.g. "read committed", "repeatable read" or "serializable".
+func ParseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	switch strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(name)) {
+	case "", "default":
+		return sql.LevelDefault, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+
+	return sql.LevelDefault, fmt.Errorf("Unsupported isolation level: %s", name)
+}
+
+// isRetryable checks whether the transaction failed due to the concurrent transactions.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
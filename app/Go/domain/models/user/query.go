@@ -1,25 +1,24 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
 	domain_errors "go-ddd-cqrs-example/domain/errors"
 )
 
 // GetActive fetches an active user.
-func GetActive(db gorm.DB, pk uuid.UUID, version *uint32) (*ActiveUser, error) {
-	var user User
-
-	err := db.Model(&user).Where("id = ?", pk).Take(&user).Error
-	if gorm.IsRecordNotFoundError(err) {
+func GetActive(ctx context.Context, repo UserReader, pk uuid.UUID, version *uint32) (*ActiveUser, error) {
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
 		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error loading user: %w", err)
 	} else if user.IsActive == false {
 		return nil, fmt.Errorf("Invariant failed: %w", IsInactive{})
 	} else if version != nil && user.Version != *version {
 		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
-	} else if err != nil {
-		return nil, fmt.Errorf("Error loading active user: %w", err)
 	}
 
 	return &ActiveUser{
@@ -30,40 +29,36 @@ func GetActive(db gorm.DB, pk uuid.UUID, version *uint32) (*ActiveUser, error) {
 }
 
 // GetInactive fetches an inactive user.
-func GetInactive(db gorm.DB, pk uuid.UUID, version *uint32) (*InactiveUser, error) {
-	var user User
-
-	err := db.Model(&user).Where("id = ?", pk).Take(&user).Error
-	if gorm.IsRecordNotFoundError(err) {
+func GetInactive(ctx context.Context, repo UserReader, pk uuid.UUID, version *uint32) (*InactiveUser, error) {
+	user, err := repo.FindByID(ctx, pk)
+	if errors.As(err, &UserNotFound{}) {
 		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error loading user: %w", err)
 	} else if user.IsActive == true {
 		return nil, fmt.Errorf("Invariant failed: %w", IsActive{})
 	} else if version != nil && user.Version != *version {
 		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
-	} else if err != nil {
-		return nil, fmt.Errorf("Error loading inactive user: %w", err)
 	}
 
 	return &InactiveUser{
 		ID:           user.ID,
 		EmailAddress: user.EmailAddress,
 		Version:      user.Version,
-	}, err
+	}, nil
 }
 
 // GetActiveByEmail fetches an active user by email for authentication when there's no token to extract user id from claims.
-func GetActiveByEmail(db gorm.DB, emailAddress string, version *uint32) (*ActiveUser, error) {
-	var user User
-
-	err := db.Model(&user).Where("email_address = ?", emailAddress).Take(&user).Error
-	if gorm.IsRecordNotFoundError(err) {
+func GetActiveByEmail(ctx context.Context, repo UserReader, emailAddress string, version *uint32) (*ActiveUser, error) {
+	user, err := repo.FindByEmail(ctx, emailAddress)
+	if errors.As(err, &UserNotFound{}) {
 		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
+	} else if err != nil {
+		return nil, fmt.Errorf("Error loading user: %w", err)
 	} else if version != nil && user.Version != *version {
 		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
 	} else if user.IsActive == false {
 		return nil, fmt.Errorf("Invariant failed: %w", IsInactive{})
-	} else if err != nil {
-		return nil, fmt.Errorf("Error loading active user: %w", err)
 	}
 
 	return &ActiveUser{
@@ -74,17 +69,15 @@ func GetActiveByEmail(db gorm.DB, emailAddress string, version *uint32) (*Active
 }
 
 // GetUserPasswordHash to compare hashed with entered password.
-func GetUserPasswordHash(db gorm.DB, email string, version *uint32) (*string, error) {
-	var user User
-
-	err := db.Model(user).Select("password").Where("email_address = ?", email).Take(&user).Error
-	if gorm.IsRecordNotFoundError(err) {
+func GetUserPasswordHash(ctx context.Context, repo UserReader, email string, version *uint32) (*string, error) {
+	user, err := repo.FindByEmail(ctx, email)
+	if errors.As(err, &UserNotFound{}) {
 		return nil, fmt.Errorf("User not found: %w", UserNotFound{})
-	} else if version != nil && user.Version != *version {
-		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
 	} else if err != nil {
 		return nil, fmt.Errorf("Error loading user password hash: %w", err)
+	} else if version != nil && user.Version != *version {
+		return nil, fmt.Errorf("Invalid version tag: %w", domain_errors.InvalidVersion{})
 	}
 
-	return &user.Password, err
+	return &user.Password, nil
 }
@@ -1,58 +1,24 @@
 package user_test
 
 import (
+	"context"
 	"errors"
 	"github.com/gofrs/uuid"
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/postgres"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"github.com/spf13/viper"
 	domain_errors "go-ddd-cqrs-example/domain/errors"
 	"go-ddd-cqrs-example/domain/models/user"
-	"go-ddd-cqrs-example/usersapi/cmd/config"
-	"go-ddd-cqrs-example/usersapi/utils"
-	"os"
-	"path"
-	"runtime"
+	"go-ddd-cqrs-example/domain/models/user/memory"
 )
 
 var _ = Describe("User loading", func() {
 	var (
-		db *gorm.DB
+		ctx  = context.Background()
+		repo *memory.UserRepository
 	)
 
-	// Hotfix, fix inconsistent current directory to get configuration file.
-	// TODO find better way to handle this.
-	_, filename, _, _ := runtime.Caller(0)
-	dir := path.Join(path.Dir(filename), "../../..")
-	err := os.Chdir(dir)
-	if err != nil {
-		panic(err)
-	}
-
-	// Set up database connection using configuration details.
-	cfg := config.Config{}
-	viper.AddConfigPath(dir + "/usersapi/cmd/config")
-	viper.SetConfigName("configuration")
-	viper.ReadInConfig()
-	viper.Unmarshal(&cfg)
-	conn, err := utils.GetDB(
-		cfg.DBDriver,
-		cfg.DBUsername,
-		cfg.DBPassword,
-		cfg.DBPort,
-		cfg.DBHost,
-		cfg.DBName,
-	)
-	Expect(err).To(BeNil())
-
 	BeforeEach(func() {
-		db = conn.Begin()
-	})
-
-	AfterEach(func() {
-		_ = db.Rollback()
+		repo = memory.NewUserRepository()
 	})
 
 	Describe("Getting active users", func() {
@@ -62,19 +28,19 @@ var _ = Describe("User loading", func() {
 			BeforeEach(func() {
 				userID = uuid.Must(uuid.NewV4())
 
-				err := db.Create(&user.User{
+				err := repo.Insert(ctx, user.User{
 					ID:           userID,
 					EmailAddress: "user@example.com",
 					Password:     "someHashedPassword",
 					IsActive:     false,
 					Version:      1,
-				}).Error
+				})
 
 				Expect(err).To(BeNil())
 			})
 
 			Specify("a user inactive error is returned", func() {
-				activeUser, err := user.GetActive(*db, userID, nil)
+				activeUser, err := user.GetActive(ctx, repo, userID, nil)
 
 				Expect(activeUser).To(BeNil())
 				Expect(errors.As(err, &user.IsInactive{})).To(BeTrue())
@@ -85,20 +51,20 @@ var _ = Describe("User loading", func() {
 			BeforeEach(func() {
 				userID = uuid.Must(uuid.NewV4())
 
-				err := db.Create(&user.User{
+				err := repo.Insert(ctx, user.User{
 					ID:           userID,
 					EmailAddress: "user@example.com",
 					Password:     "someHashedPassword",
 					IsActive:     true,
 					Version:      1,
-				}).Error
+				})
 
 				Expect(err).To(BeNil())
 			})
 
 			Specify("an invalid version error is returned", func() {
 				v := uint32(3)
-				activeUser, err := user.GetActive(*db, userID, &v)
+				activeUser, err := user.GetActive(ctx, repo, userID, &v)
 
 				Expect(activeUser).To(BeNil())
 				Expect(errors.As(err, &domain_errors.InvalidVersion{})).To(BeTrue())
@@ -113,19 +79,19 @@ var _ = Describe("User loading", func() {
 			BeforeEach(func() {
 				userID = uuid.Must(uuid.NewV4())
 
-				err := db.Create(&user.User{
+				err := repo.Insert(ctx, user.User{
 					ID:           userID,
 					EmailAddress: "user@example.com",
 					Password:     "someHashedPassword",
 					IsActive:     true,
 					Version:      1,
-				}).Error
+				})
 
 				Expect(err).To(BeNil())
 			})
 
 			Specify("a user active error is returned", func() {
-				inactiveUser, err := user.GetInactive(*db, userID, nil)
+				inactiveUser, err := user.GetInactive(ctx, repo, userID, nil)
 
 				Expect(inactiveUser).To(BeNil())
 				Expect(errors.As(err, &user.IsActive{})).To(BeTrue())
@@ -136,20 +102,20 @@ var _ = Describe("User loading", func() {
 			BeforeEach(func() {
 				userID = uuid.Must(uuid.NewV4())
 
-				err := db.Create(&user.User{
+				err := repo.Insert(ctx, user.User{
 					ID:           userID,
 					EmailAddress: "user@example.com",
 					Password:     "someHashedPassword",
 					IsActive:     false,
 					Version:      1,
-				}).Error
+				})
 
 				Expect(err).To(BeNil())
 			})
 
 			Specify("an invalid version error is returned", func() {
 				v := uint32(3)
-				inactiveUser, err := user.GetInactive(*db, userID, &v)
+				inactiveUser, err := user.GetInactive(ctx, repo, userID, &v)
 
 				Expect(inactiveUser).To(BeNil())
 				Expect(errors.As(err, &domain_errors.InvalidVersion{})).To(BeTrue())
@@ -0,0 +1,61 @@
+package user
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"time"
+)
+
+// UserReader loads users from the persistence layer.
+// Implementations return Timeout error when the context is done before the query completes.
+type UserReader interface {
+	// FindByID returns UserNotFound error if there is no user with the given ID.
+	FindByID(ctx context.Context, pk uuid.UUID) (*User, error)
+	// FindByEmail returns UserNotFound error if there is no user with the given email address.
+	FindByEmail(ctx context.Context, emailAddress string) (*User, error)
+	// Search returns the users matching the filter ordered by creation time.
+	Search(ctx context.Context, filter UserFilter) ([]User, error)
+	// History returns the stored versions of the user ordered from the oldest one,
+	// empty if there is no user with the given ID.
+	History(ctx context.Context, pk uuid.UUID) ([]UserVersion, error)
+	// Logins returns the recorded logins of the user ordered from the oldest one,
+	// empty if there is no user with the given ID.
+	Logins(ctx context.Context, pk uuid.UUID) ([]Login, error)
+	// FindTombstone returns UserNotFound error if the user with the given ID was never erased.
+	FindTombstone(ctx context.Context, pk uuid.UUID) (*Tombstone, error)
+}
+
+// UserFilter narrows down the user search.
+type UserFilter struct {
+	// EmailContains matches the email addresses containing the given text, case-insensitive.
+	EmailContains string
+	// IsActive matches the users in the given state if set.
+	IsActive *bool
+	// DeletionRequestedBefore matches the users who requested their deletion before the given time if set.
+	DeletionRequestedBefore *time.Time
+	// Limit of the returned users, zero means no limit.
+	Limit  int
+	Offset int
+}
+
+// UserWriter stores users in the persistence layer.
+// Every stored state is recorded as a new entry in the user history.
+type UserWriter interface {
+	// Insert returns AlreadyExists error if the email address is already taken.
+	Insert(ctx context.Context, user User) error
+	// Update overwrites the user stored with the given version,
+	// returns StateConflict error if the stored version differs.
+	Update(ctx context.Context, user User, version uint32) error
+	// InsertLogin records the login in the login history of the user,
+	// returns UserNotFound error if there is no user with the given ID.
+	InsertLogin(ctx context.Context, login Login) error
+	// Erase removes the user along with its history, its logins and the personal data stored with it, e.g. its events waiting
+	// in the outbox, and stores the tombstone instead. Returns UserNotFound error if there is no user with the given ID.
+	Erase(ctx context.Context, pk uuid.UUID, tombstone Tombstone) error
+}
+
+// Repository combines the read and write sides of the user persistence.
+type Repository interface {
+	UserReader
+	UserWriter
+}
@@ -0,0 +1,15 @@
+package user
+
+import (
+	"context"
+	"go-ddd-cqrs-example/domain/events"
+)
+
+// CommandFunc is a command handler executed within a unit of work.
+// The events recorded by the handler are published only after the unit of work is committed.
+type CommandFunc func(ctx context.Context, repo Repository, recorder *events.Recorder) error
+
+// UnitOfWork runs the command handler atomically, either all of its changes are stored or none of them.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn CommandFunc) error
+}
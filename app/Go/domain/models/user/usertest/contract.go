@@ -0,0 +1,376 @@
+// Package usertest provides the shared contract test suite for the user repository implementations.
+package usertest
+
+import (
+	"context"
+	"errors"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"time"
+)
+
+// RepositoryContract declares the specs every user.Repository implementation has to pass.
+// The getter is called inside each spec to fetch the repository prepared by the caller's BeforeEach.
+func RepositoryContract(getRepository func() user.Repository) {
+	var (
+		ctx    = context.Background()
+		repo   user.Repository
+		stored user.User
+	)
+
+	BeforeEach(func() {
+		repo = getRepository()
+
+		stored = user.User{
+			ID:           uuid.Must(uuid.NewV4()),
+			EmailAddress: "user@example.com",
+			Password:     "someHashedPassword",
+			IsActive:     true,
+			Version:      1,
+		}
+
+		err := repo.Insert(ctx, stored)
+		Expect(err).To(BeNil())
+	})
+
+	Describe("Finding users", func() {
+		Specify("a stored user is found by ID", func() {
+			u, err := repo.FindByID(ctx, stored.ID)
+
+			Expect(err).To(BeNil())
+			Expect(u.ID).To(Equal(stored.ID))
+			Expect(u.EmailAddress).To(Equal(stored.EmailAddress))
+			Expect(u.Password).To(Equal(stored.Password))
+			Expect(u.IsActive).To(BeTrue())
+			Expect(u.Version).To(Equal(uint32(1)))
+		})
+
+		Specify("a stored user is found by email address", func() {
+			u, err := repo.FindByEmail(ctx, stored.EmailAddress)
+
+			Expect(err).To(BeNil())
+			Expect(u.ID).To(Equal(stored.ID))
+		})
+
+		Specify("a user not found error is returned for unknown ID", func() {
+			u, err := repo.FindByID(ctx, uuid.Must(uuid.NewV4()))
+
+			Expect(u).To(BeNil())
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+
+		Specify("a user not found error is returned for unknown email address", func() {
+			u, err := repo.FindByEmail(ctx, "unknown@example.com")
+
+			Expect(u).To(BeNil())
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+	})
+
+	Describe("Querying with a cancelled context", func() {
+		Specify("a cancellation error is returned", func() {
+			cancelledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+
+			u, err := repo.FindByID(cancelledCtx, stored.ID)
+
+			Expect(u).To(BeNil())
+			Expect(errors.As(err, &domain_errors.Canceled{})).To(BeTrue())
+		})
+	})
+
+	Describe("Querying with an expired context", func() {
+		Specify("a timeout error is returned", func() {
+			expiredCtx, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+			defer cancel()
+
+			u, err := repo.FindByID(expiredCtx, stored.ID)
+
+			Expect(u).To(BeNil())
+			Expect(errors.As(err, &domain_errors.Timeout{})).To(BeTrue())
+		})
+	})
+
+	Describe("Inserting users", func() {
+		Specify("a user already exists error is returned for a taken email address", func() {
+			err := repo.Insert(ctx, user.User{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: stored.EmailAddress,
+				Password:     "otherHashedPassword",
+				IsActive:     true,
+				Version:      1,
+			})
+
+			Expect(errors.As(err, &user.AlreadyExists{})).To(BeTrue())
+		})
+	})
+
+	Describe("Updating users", func() {
+		Specify("the user is updated when the version matches", func() {
+			stored.IsActive = false
+			stored.Version = 2
+
+			err := repo.Update(ctx, stored, 1)
+			Expect(err).To(BeNil())
+
+			u, err := repo.FindByID(ctx, stored.ID)
+			Expect(err).To(BeNil())
+			Expect(u.IsActive).To(BeFalse())
+			Expect(u.Version).To(Equal(uint32(2)))
+		})
+
+		Specify("the profile is stored and recorded in the history", func() {
+			stored.DisplayName = "Jane Doe"
+			stored.Locale = "en-GB"
+			stored.Timezone = "Europe/London"
+			stored.AvatarURL = "https://example.com/avatar.png"
+			stored.Version = 2
+
+			err := repo.Update(ctx, stored, 1)
+			Expect(err).To(BeNil())
+
+			u, err := repo.FindByID(ctx, stored.ID)
+			Expect(err).To(BeNil())
+			Expect(u.DisplayName).To(Equal("Jane Doe"))
+			Expect(u.Locale).To(Equal("en-GB"))
+			Expect(u.Timezone).To(Equal("Europe/London"))
+			Expect(u.AvatarURL).To(Equal("https://example.com/avatar.png"))
+
+			history, err := repo.History(ctx, stored.ID)
+			Expect(err).To(BeNil())
+			Expect(history[1].DisplayName).To(Equal("Jane Doe"))
+		})
+
+		Specify("a state conflict error is returned when the version differs", func() {
+			stored.Version = 3
+
+			err := repo.Update(ctx, stored, 2)
+			Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
+
+			u, err := repo.FindByID(ctx, stored.ID)
+			Expect(err).To(BeNil())
+			Expect(u.Version).To(Equal(uint32(1)))
+		})
+
+		Specify("a user already exists error is returned for a taken email address", func() {
+			other := user.User{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: "other@example.com",
+				Password:     "otherHashedPassword",
+				IsActive:     true,
+				Version:      1,
+			}
+			err := repo.Insert(ctx, other)
+			Expect(err).To(BeNil())
+
+			other.EmailAddress = stored.EmailAddress
+			other.Version = 2
+
+			err = repo.Update(ctx, other, 1)
+			Expect(errors.As(err, &user.AlreadyExists{})).To(BeTrue())
+		})
+	})
+
+	Describe("Searching users", func() {
+		var inactive user.User
+
+		BeforeEach(func() {
+			inactive = user.User{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: "inactive@example.org",
+				Password:     "inactiveHashedPassword",
+				IsActive:     false,
+				Version:      1,
+			}
+
+			err := repo.Insert(ctx, inactive)
+			Expect(err).To(BeNil())
+		})
+
+		Specify("the users are matched by a part of the email address regardless of its case", func() {
+			users, err := repo.Search(ctx, user.UserFilter{EmailContains: "EXAMPLE.ORG"})
+
+			Expect(err).To(BeNil())
+			Expect(users).To(HaveLen(1))
+			Expect(users[0].ID).To(Equal(inactive.ID))
+		})
+
+		Specify("the users are matched by the state", func() {
+			isActive := true
+
+			users, err := repo.Search(ctx, user.UserFilter{IsActive: &isActive})
+
+			Expect(err).To(BeNil())
+			Expect(users).To(HaveLen(1))
+			Expect(users[0].ID).To(Equal(stored.ID))
+		})
+
+		Specify("the LIKE wildcards are matched literally", func() {
+			users, err := repo.Search(ctx, user.UserFilter{EmailContains: "%"})
+
+			Expect(err).To(BeNil())
+			Expect(users).To(BeEmpty())
+		})
+
+		Specify("the users are matched by the time of the deletion request", func() {
+			requestedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+			inactive.DeletionRequestedAt = &requestedAt
+			inactive.Version = 2
+
+			err := repo.Update(ctx, inactive, 1)
+			Expect(err).To(BeNil())
+
+			before := requestedAt.Add(time.Minute)
+			users, err := repo.Search(ctx, user.UserFilter{DeletionRequestedBefore: &before})
+
+			Expect(err).To(BeNil())
+			Expect(users).To(HaveLen(1))
+			Expect(users[0].ID).To(Equal(inactive.ID))
+			Expect(users[0].DeletionRequestedAt.Equal(requestedAt)).To(BeTrue())
+
+			before = requestedAt
+			users, err = repo.Search(ctx, user.UserFilter{DeletionRequestedBefore: &before})
+
+			Expect(err).To(BeNil())
+			Expect(users).To(BeEmpty())
+		})
+
+		Specify("the users are paginated", func() {
+			all, err := repo.Search(ctx, user.UserFilter{})
+			Expect(err).To(BeNil())
+			Expect(len(all)).To(BeNumerically(">=", 2))
+
+			page, err := repo.Search(ctx, user.UserFilter{Limit: 1, Offset: 1})
+
+			Expect(err).To(BeNil())
+			Expect(page).To(HaveLen(1))
+			Expect(page[0].ID).To(Equal(all[1].ID))
+		})
+	})
+
+	Describe("Loading the user history", func() {
+		Specify("every stored version is recorded", func() {
+			stored.IsActive = false
+			stored.Version = 2
+
+			err := repo.Update(ctx, stored, 1)
+			Expect(err).To(BeNil())
+
+			history, err := repo.History(ctx, stored.ID)
+
+			Expect(err).To(BeNil())
+			Expect(history).To(HaveLen(2))
+			Expect(history[0].Version).To(Equal(uint32(1)))
+			Expect(history[0].IsActive).To(BeTrue())
+			Expect(history[1].Version).To(Equal(uint32(2)))
+			Expect(history[1].IsActive).To(BeFalse())
+			Expect(history[1].EmailAddress).To(Equal(stored.EmailAddress))
+		})
+
+		Specify("a rejected update is not recorded", func() {
+			stored.Version = 3
+
+			err := repo.Update(ctx, stored, 2)
+			Expect(errors.As(err, &domain_errors.StateConflict{})).To(BeTrue())
+
+			history, err := repo.History(ctx, stored.ID)
+
+			Expect(err).To(BeNil())
+			Expect(history).To(HaveLen(1))
+		})
+
+		Specify("the history of an unknown user is empty", func() {
+			history, err := repo.History(ctx, uuid.Must(uuid.NewV4()))
+
+			Expect(err).To(BeNil())
+			Expect(history).To(BeEmpty())
+		})
+	})
+	Describe("Recording logins", func() {
+		Specify("the logins are returned from the oldest one", func() {
+			loggedInAt := time.Now().UTC().Truncate(time.Microsecond)
+
+			err := repo.InsertLogin(ctx, user.Login{UserID: stored.ID, Method: user.LoginMethodPassword, LoggedInAt: loggedInAt})
+			Expect(err).To(BeNil())
+			err = repo.InsertLogin(ctx, user.Login{UserID: stored.ID, Method: user.LoginMethodMagicLink, LoggedInAt: loggedInAt.Add(time.Minute)})
+			Expect(err).To(BeNil())
+
+			logins, err := repo.Logins(ctx, stored.ID)
+
+			Expect(err).To(BeNil())
+			Expect(logins).To(HaveLen(2))
+			Expect(logins[0].UserID).To(Equal(stored.ID))
+			Expect(logins[0].Method).To(Equal(user.LoginMethodPassword))
+			Expect(logins[0].LoggedInAt.Equal(loggedInAt)).To(BeTrue())
+			Expect(logins[1].Method).To(Equal(user.LoginMethodMagicLink))
+		})
+
+		Specify("a user not found error is returned for an unknown user", func() {
+			err := repo.InsertLogin(ctx, user.Login{UserID: uuid.Must(uuid.NewV4()), Method: user.LoginMethodPassword})
+
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+
+		Specify("the logins of an unknown user are empty", func() {
+			logins, err := repo.Logins(ctx, uuid.Must(uuid.NewV4()))
+
+			Expect(err).To(BeNil())
+			Expect(logins).To(BeEmpty())
+		})
+	})
+
+	Describe("Erasing users", func() {
+		Specify("the user, its history and its logins are replaced with the tombstone", func() {
+			erasedAt := time.Now().UTC().Truncate(time.Microsecond)
+
+			err := repo.InsertLogin(ctx, user.Login{UserID: stored.ID, Method: user.LoginMethodPassword})
+			Expect(err).To(BeNil())
+
+			err = repo.Erase(ctx, stored.ID, user.Tombstone{
+				UserID:   stored.ID,
+				Version:  stored.Version,
+				Reason:   user.ErasureReasonOperator,
+				ErasedAt: erasedAt,
+			})
+			Expect(err).To(BeNil())
+
+			_, err = repo.FindByID(ctx, stored.ID)
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+
+			history, err := repo.History(ctx, stored.ID)
+			Expect(err).To(BeNil())
+			Expect(history).To(BeEmpty())
+
+			logins, err := repo.Logins(ctx, stored.ID)
+			Expect(err).To(BeNil())
+			Expect(logins).To(BeEmpty())
+
+			tombstone, err := repo.FindTombstone(ctx, stored.ID)
+
+			Expect(err).To(BeNil())
+			Expect(tombstone.UserID).To(Equal(stored.ID))
+			Expect(tombstone.Version).To(Equal(uint32(1)))
+			Expect(tombstone.Reason).To(Equal(user.ErasureReasonOperator))
+			Expect(tombstone.DeletionRequestedAt).To(BeNil())
+			Expect(tombstone.ErasedAt.Equal(erasedAt)).To(BeTrue())
+		})
+
+		Specify("a user not found error is returned for an unknown user", func() {
+			pk := uuid.Must(uuid.NewV4())
+
+			err := repo.Erase(ctx, pk, user.Tombstone{UserID: pk, Reason: user.ErasureReasonOperator})
+
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+
+		Specify("a user not found error is returned for a user never erased", func() {
+			tombstone, err := repo.FindTombstone(ctx, stored.ID)
+
+			Expect(tombstone).To(BeNil())
+			Expect(errors.As(err, &user.UserNotFound{})).To(BeTrue())
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/nsqio/go-nsq"
+	"sync"
+)
+
+// NSQSubscriber subscribes to the NSQ topics through ephemeral channels,
+// so that every subscription receives all the messages published from now on and leaves nothing behind.
+type NSQSubscriber struct {
+	// Address of the nsqd instance, e.g. localhost:4150.
+	Address string
+	// Config of the consumers, the default one if nil.
+	Config *nsq.Config
+}
+
+// Subscribe to the topics with a consumer per topic, the handler calls are serialized.
+func (s NSQSubscriber) Subscribe(topics []string, handle func(topic string, body []byte)) (func(), error) {
+	config := s.Config
+	if config == nil {
+		config = nsq.NewConfig()
+	}
+
+	channel := fmt.Sprintf("usersapi-watch-%s#ephemeral", uuid.Must(uuid.NewV4()))
+
+	var (
+		mu        sync.Mutex
+		consumers []*nsq.Consumer
+	)
+
+	unsubscribe := func() {
+		for _, consumer := range consumers {
+			consumer.Stop()
+			<-consumer.StopChan
+		}
+	}
+
+	for _, topic := range topics {
+		topic := topic
+
+		consumer, err := nsq.NewConsumer(topic, channel, config)
+		if err != nil {
+			unsubscribe()
+			return nil, err
+		}
+		consumer.SetLogger(nil, nsq.LogLevelError)
+
+		consumer.AddHandler(nsq.HandlerFunc(func(message *nsq.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			handle(topic, message.Body)
+
+			return nil
+		}))
+		consumers = append(consumers, consumer)
+
+		if err := consumer.ConnectToNSQD(s.Address); err != nil {
+			unsubscribe()
+			return nil, fmt.Errorf("Error subscribing to %s: %w", topic, err)
+		}
+	}
+
+	return unsubscribe, nil
+}
@@ -0,0 +1,23 @@
+package broker_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/platform/broker"
+	"net"
+)
+
+var _ = Describe("NSQ subscriber", func() {
+	Specify("subscribing fails when nsqd is unreachable", func() {
+		// Reserve a free port and release it so that nothing listens on it.
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		address := listener.Addr().String()
+		Expect(listener.Close()).To(Succeed())
+
+		subscriber := broker.NSQSubscriber{Address: address}
+		unsubscribe, err := subscriber.Subscribe([]string{"new_user"}, func(topic string, body []byte) {})
+		Expect(err).To(MatchError(ContainSubstring("Error subscribing to new_user")))
+		Expect(unsubscribe).To(BeNil())
+	})
+})
@@ -0,0 +1,218 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Statuses of the checks and the reports.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+)
+
+// Defaults of the checker.
+const (
+	DefaultTimeout  = 2 * time.Second
+	DefaultCacheTTL = time.Second
+)
+
+// Check of a dependency the service needs to serve the requests.
+type Check struct {
+	Name string
+	// Timeout of the check, the checker timeout is used if zero.
+	Timeout time.Duration
+	// Optional checks degrade the report when failed but keep the service ready, e.g. the downstream services.
+	Optional bool
+	Run      func(ctx context.Context) error
+}
+
+// Result of a check.
+type Result struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report of all the checks.
+type Report struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Checks    map[string]Result `json:"checks,omitempty"`
+}
+
+// Ready unless a required check failed.
+func (r Report) Ready() bool {
+	return r.Status != StatusFail
+}
+
+// Checker runs the checks concurrently and caches the report to protect the dependencies from frequent probes.
+type Checker struct {
+	mu     sync.Mutex
+	checks []Check
+	report *Report
+
+	// Timeout of the checks without their own timeout.
+	Timeout time.Duration
+	// CacheTTL of the report, zero disables caching.
+	CacheTTL time.Duration
+}
+
+// NewChecker with the default timeout and cache TTL.
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{
+		checks:   checks,
+		Timeout:  DefaultTimeout,
+		CacheTTL: DefaultCacheTTL,
+	}
+}
+
+// Add the check.
+func (c *Checker) Add(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, check)
+	c.report = nil
+}
+
+// Check the dependencies, the cached report is returned if it hasn't expired.
+// The probes arriving while the checks run wait for the same report.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.CacheTTL {
+		return *c.report
+	}
+
+	report := Report{
+		Status:    StatusOK,
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]Result, len(c.checks)),
+	}
+
+	var (
+		wg        sync.WaitGroup
+		resultsMu sync.Mutex
+	)
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			result := c.run(ctx, check)
+
+			resultsMu.Lock()
+			defer resultsMu.Unlock()
+
+			report.Checks[check.Name] = result
+			switch {
+			case result.Status == StatusOK:
+			case check.Optional:
+				if report.Status == StatusOK {
+					report.Status = StatusDegraded
+				}
+			default:
+				report.Status = StatusFail
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	c.report = &report
+
+	return report
+}
+
+// run the check within its timeout, the check is abandoned if it ignores the context.
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = c.Timeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("Timed out after %s", timeout)
+	}
+
+	result := Result{Status: StatusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// LivenessHandler reports the process is alive, it doesn't check the dependencies.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	}
+}
+
+// ReadinessHandler reports whether the service is ready to serve the requests with the details of every check.
+func ReadinessHandler(checker *Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, status, report)
+	}
+}
+
+// HTTPCheck of the downstream service, any response other than 2xx fails the check.
+func HTTPCheck(client *http.Client, url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("Unexpected status %d", res.StatusCode)
+		}
+
+		return nil
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,124 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/platform/health"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Health checker", func() {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	Specify("the service is ready when every check passes", func() {
+		checker := health.NewChecker(
+			health.Check{Name: "postgres", Run: ok},
+			health.Check{Name: "nsq", Run: ok},
+		)
+
+		report := checker.Check(context.Background())
+
+		Expect(report.Ready()).To(BeTrue())
+		Expect(report.Status).To(Equal(health.StatusOK))
+		Expect(report.Checks).To(HaveLen(2))
+	})
+
+	Specify("a failed required check makes the service not ready", func() {
+		checker := health.NewChecker(
+			health.Check{Name: "postgres", Run: failing},
+			health.Check{Name: "nsq", Run: ok},
+		)
+
+		report := checker.Check(context.Background())
+
+		Expect(report.Ready()).To(BeFalse())
+		Expect(report.Checks["postgres"].Error).To(Equal("connection refused"))
+		Expect(report.Checks["nsq"].Status).To(Equal(health.StatusOK))
+	})
+
+	Specify("a failed optional check degrades the report", func() {
+		checker := health.NewChecker(
+			health.Check{Name: "postgres", Run: ok},
+			health.Check{Name: "test service", Optional: true, Run: failing},
+		)
+
+		report := checker.Check(context.Background())
+
+		Expect(report.Ready()).To(BeTrue())
+		Expect(report.Status).To(Equal(health.StatusDegraded))
+	})
+
+	Specify("a check exceeding its timeout fails", func() {
+		checker := health.NewChecker(health.Check{
+			Name:    "postgres",
+			Timeout: 10 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			},
+		})
+
+		start := time.Now()
+		report := checker.Check(context.Background())
+
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(report.Checks["postgres"].Error).To(Equal("Timed out after 10ms"))
+	})
+
+	Specify("the report is cached", func() {
+		calls := 0
+		checker := health.NewChecker(health.Check{Name: "postgres", Run: func(ctx context.Context) error {
+			calls++
+			return nil
+		}})
+		checker.CacheTTL = time.Minute
+
+		checker.Check(context.Background())
+		checker.Check(context.Background())
+
+		Expect(calls).To(Equal(1))
+	})
+
+	Describe("Handlers", func() {
+		Specify("the readiness handler responds with the report", func() {
+			checker := health.NewChecker(health.Check{Name: "postgres", Run: failing})
+			recorder := httptest.NewRecorder()
+
+			health.ReadinessHandler(checker)(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			report := health.Report{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &report)).To(Succeed())
+			Expect(report.Status).To(Equal(health.StatusFail))
+			Expect(report.Checks["postgres"].Status).To(Equal(health.StatusFail))
+		})
+
+		Specify("the liveness handler responds without checking the dependencies", func() {
+			recorder := httptest.NewRecorder()
+
+			health.LivenessHandler()(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"status": "ok"}`))
+		})
+
+		Specify("the HTTP check fails on error responses", func() {
+			downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer downstream.Close()
+
+			err := health.HTTPCheck(downstream.Client(), downstream.URL)(context.Background())
+
+			Expect(err).To(MatchError("Unexpected status 503"))
+		})
+	})
+})
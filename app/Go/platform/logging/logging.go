@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+)
+
+// RequestIDHeader carries the request ID between the services and back to the clients.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength of the incoming request IDs, the longer ones are replaced.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// scope holds the request-scoped logger, it is enriched in place so that the outer middlewares,
+// e.g. the access log, see the fields added by the inner ones, e.g. the authenticated user ID.
+type scope struct {
+	mu     sync.Mutex
+	logger *zap.SugaredLogger
+}
+
+// WithRequestID returns the context carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID of the context, empty outside of a request.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// NewRequestID generates a random request ID.
+func NewRequestID() string {
+	return uuid.Must(uuid.NewV4()).String()
+}
+
+// ValidRequestID checks the incoming request ID is short and printable before it is logged and echoed back.
+func ValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithLogger returns the context carrying the request-scoped logger.
+func WithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, &scope{logger: logger})
+}
+
+// FromContext returns the request-scoped logger, the global logger outside of a request.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if s, ok := ctx.Value(loggerKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return s.logger
+	}
+
+	return zap.S()
+}
+
+// With adds the fields to the request-scoped logger for the rest of the request, it is a no-op outside of a request.
+func With(ctx context.Context, keysAndValues ...interface{}) {
+	if s, ok := ctx.Value(loggerKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.logger = s.logger.With(keysAndValues...)
+	}
+}
+
+// Transport propagating the request ID of the request context to the called services.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(r *http.Request) (*http.Response, error) {
+		requestID := RequestIDFromContext(r.Context())
+		if requestID == "" || r.Header.Get(RequestIDHeader) != "" {
+			return base.RoundTrip(r)
+		}
+
+		// The round trippers must not modify the request.
+		r = r.Clone(r.Context())
+		r.Header.Set(RequestIDHeader, requestID)
+
+		return base.RoundTrip(r)
+	})
+}
+
+type roundTripper func(r *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,99 @@
+package logging_test
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/platform/logging"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Request-scoped logging", func() {
+	var (
+		ctx  context.Context
+		logs *observer.ObservedLogs
+	)
+
+	BeforeEach(func() {
+		var core zap.Option
+		core, logs = observedCore()
+		ctx = logging.WithLogger(context.Background(), zap.NewNop().WithOptions(core).Sugar().With("request_id", "request-1"))
+	})
+
+	Specify("the logger of the context carries the request fields", func() {
+		logging.FromContext(ctx).Info("Handled")
+
+		Expect(logs.All()).To(HaveLen(1))
+		Expect(logs.All()[0].ContextMap()).To(HaveKeyWithValue("request_id", "request-1"))
+	})
+
+	Specify("the fields added later are seen by every holder of the context", func() {
+		logging.With(ctx, "user_id", "user-1")
+		logging.FromContext(ctx).Info("Handled")
+
+		Expect(logs.All()[0].ContextMap()).To(HaveKeyWithValue("request_id", "request-1"))
+		Expect(logs.All()[0].ContextMap()).To(HaveKeyWithValue("user_id", "user-1"))
+	})
+
+	Specify("the global logger is used outside of a request", func() {
+		Expect(logging.FromContext(context.Background())).To(Equal(zap.S()))
+
+		// Nothing to enrich.
+		logging.With(context.Background(), "user_id", "user-1")
+	})
+})
+
+var _ = Describe("Request IDs", func() {
+	Specify("the request ID is carried by the context", func() {
+		ctx := logging.WithRequestID(context.Background(), "request-1")
+
+		Expect(logging.RequestIDFromContext(ctx)).To(Equal("request-1"))
+		Expect(logging.RequestIDFromContext(context.Background())).To(BeEmpty())
+	})
+
+	Specify("the generated request IDs are valid and unique", func() {
+		first, second := logging.NewRequestID(), logging.NewRequestID()
+
+		Expect(logging.ValidRequestID(first)).To(BeTrue())
+		Expect(first).NotTo(Equal(second))
+	})
+
+	Specify("the empty, long and unprintable request IDs are rejected", func() {
+		Expect(logging.ValidRequestID("")).To(BeFalse())
+		Expect(logging.ValidRequestID(strings.Repeat("a", 129))).To(BeFalse())
+		Expect(logging.ValidRequestID("request 1")).To(BeFalse())
+		Expect(logging.ValidRequestID("request-1\nforged")).To(BeFalse())
+		Expect(logging.ValidRequestID("request-1")).To(BeTrue())
+	})
+
+	Specify("the request ID is propagated to the called services", func() {
+		var received string
+		service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Get(logging.RequestIDHeader)
+		}))
+		defer service.Close()
+
+		client := &http.Client{Transport: logging.Transport(http.DefaultTransport)}
+		req, err := http.NewRequestWithContext(logging.WithRequestID(context.Background(), "request-1"), "GET", service.URL, nil)
+		Expect(err).To(BeNil())
+
+		res, err := client.Do(req)
+		Expect(err).To(BeNil())
+		res.Body.Close()
+
+		Expect(received).To(Equal("request-1"))
+		Expect(req.Header.Get(logging.RequestIDHeader)).To(BeEmpty())
+	})
+})
+
+// observedCore replaces the core of the logger with the one recording the entries.
+func observedCore() (zap.Option, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.DebugLevel)
+
+	return zap.WrapCore(func(zapcore.Core) zapcore.Core { return core }), logs
+}
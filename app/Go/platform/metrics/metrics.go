@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// unmatchedRoute labels the requests not matching any route to keep the label cardinality bounded.
+const unmatchedRoute = "unmatched"
+
+// RouteFunc returns the route template of the request, e.g. /api/users/{id}, used as the route label.
+type RouteFunc func(r *http.Request) string
+
+// Metrics of a service collected in its own registry, including the Go runtime and the process metrics.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// New metrics with the names prefixed with the namespace, e.g. usersapi_http_requests_total.
+func New(namespace string) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of the HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of the HTTP requests by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of the HTTP requests being served.",
+		}),
+	}
+
+	m.Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.inFlight,
+	)
+
+	return m
+}
+
+// MustRegister the service specific collectors, it panics if a collector is already registered.
+func (m *Metrics) MustRegister(collectors ...prometheus.Collector) {
+	m.Registry.MustRegister(collectors...)
+}
+
+// Handler serving the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counting the requests and observing their duration by route.
+func (m *Metrics) Middleware(route RouteFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return promhttp.InstrumentHandlerInFlight(m.inFlight, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			labels := prometheus.Labels{"route": route(r)}
+
+			handler := promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels),
+				promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels), next),
+			)
+			handler.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// MuxRoute returns the path template of the route matched by the gorilla router,
+// the middleware has to be added with Router.Use to run after the route is matched.
+func MuxRoute(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unmatchedRoute
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+
+	return template
+}
+
+// ServeMuxRoute returns the pattern of the handler registered in the mux for the request.
+func ServeMuxRoute(serveMux *http.ServeMux) RouteFunc {
+	return func(r *http.Request) string {
+		if _, pattern := serveMux.Handler(r); pattern != "" {
+			return pattern
+		}
+
+		return unmatchedRoute
+	}
+}
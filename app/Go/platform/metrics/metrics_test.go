@@ -0,0 +1,55 @@
+package metrics_test
+
+import (
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/platform/metrics"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("HTTP metrics", func() {
+	scrape := func(m *metrics.Metrics) string {
+		recorder := httptest.NewRecorder()
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		return recorder.Body.String()
+	}
+
+	Specify("the requests are counted by the route template of the gorilla router", func() {
+		m := metrics.New("test")
+		router := mux.NewRouter()
+		router.Use(m.Middleware(metrics.MuxRoute))
+		router.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}).Methods("GET")
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/users/1", nil))
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/users/2", nil))
+
+		body := scrape(m)
+		Expect(body).To(ContainSubstring(`test_http_requests_total{code="404",method="get",route="/api/users/{id}"} 2`))
+		Expect(body).To(ContainSubstring(`test_http_request_duration_seconds_count{method="get",route="/api/users/{id}"} 2`))
+		Expect(body).To(ContainSubstring(`test_http_requests_in_flight 0`))
+	})
+
+	Specify("the requests are counted by the pattern of the serve mux", func() {
+		m := metrics.New("test")
+		serveMux := http.NewServeMux()
+		serveMux.HandleFunc("/api/get/testvalue", func(w http.ResponseWriter, r *http.Request) {})
+		handler := m.Middleware(metrics.ServeMuxRoute(serveMux))(serveMux)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/get/testvalue", nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown/path", nil))
+
+		body := scrape(m)
+		Expect(body).To(ContainSubstring(`test_http_requests_total{code="200",method="get",route="/api/get/testvalue"} 1`))
+		Expect(body).To(ContainSubstring(`test_http_requests_total{code="404",method="get",route="unmatched"} 1`))
+	})
+
+	Specify("the runtime metrics are exported", func() {
+		Expect(scrape(metrics.New("test"))).To(ContainSubstring("go_goroutines"))
+	})
+})
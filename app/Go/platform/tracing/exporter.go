@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// exportedSpan is the JSON line written for every span.
+type exportedSpan struct {
+	Name       string                 `json:"name"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Kind       string                 `json:"kind"`
+	Start      time.Time              `json:"start"`
+	Duration   string                 `json:"duration"`
+	Status     string                 `json:"status,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Events     []string               `json:"events,omitempty"`
+}
+
+// WriterExporter writes the spans as JSON lines, e.g. to stdout or a file for the local use.
+type WriterExporter struct {
+	mu      sync.Mutex
+	writer  io.Writer
+	encoder *json.Encoder
+}
+
+// NewWriterExporter of the spans to the writer, the writer is closed on shutdown unless it is stdout or stderr.
+func NewWriterExporter(writer io.Writer) *WriterExporter {
+	return &WriterExporter{
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+// ExportSpans writes the spans.
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, span := range spans {
+		exported := exportedSpan{
+			Name:     span.Name(),
+			TraceID:  span.SpanContext().TraceID().String(),
+			SpanID:   span.SpanContext().SpanID().String(),
+			Kind:     span.SpanKind().String(),
+			Start:    span.StartTime(),
+			Duration: span.EndTime().Sub(span.StartTime()).String(),
+		}
+
+		if span.Parent().IsValid() {
+			exported.ParentID = span.Parent().SpanID().String()
+		}
+
+		if span.Status().Code != 0 {
+			exported.Status = span.Status().Code.String() + " " + span.Status().Description
+		}
+
+		if attributes := span.Attributes(); len(attributes) > 0 {
+			exported.Attributes = make(map[string]interface{}, len(attributes))
+			for _, attribute := range attributes {
+				exported.Attributes[string(attribute.Key)] = attribute.Value.AsInterface()
+			}
+		}
+
+		for _, event := range span.Events() {
+			exported.Events = append(exported.Events, event.Name)
+		}
+
+		if err := e.encoder.Encode(exported); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Shutdown closes the writer.
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.writer == os.Stdout || e.writer == os.Stderr {
+		return nil
+	}
+
+	if closer, ok := e.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
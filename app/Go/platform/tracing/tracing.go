@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+// Exporters of the spans.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// Exporters lists the supported exporters.
+var Exporters = []interface{}{ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP}
+
+// Config of the tracing.
+type Config struct {
+	ServiceName string
+	// Exporter of the spans, the spans are not recorded with the none exporter.
+	Exporter string
+	// File the file exporter appends the spans to as JSON lines.
+	File string
+	// OTLPEndpoint of the collector receiving the spans over HTTP, e.g. localhost:4318.
+	// The OTEL_EXPORTER_OTLP_* environment variables are used if empty.
+	OTLPEndpoint string
+	// SampleRatio of the traces started by the service, the sampling decision of the caller is respected.
+	SampleRatio float64
+}
+
+// Setup the global tracer provider and the W3C trace context propagator.
+// The returned function flushes the buffered spans and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(ctx context.Context) error, error) {
+	// The trace context is propagated even if the service doesn't record its spans.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(ctx context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.New(ctx, resource.WithAttributes(semconv.ServiceNameKey.String(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// newExporter of the configuration, nil for the none exporter.
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return NewWriterExporter(os.Stdout), nil
+	case ExporterFile:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening traces file: %w", err)
+		}
+		return NewWriterExporter(file), nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if cfg.OTLPEndpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint), otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	}
+
+	return nil, fmt.Errorf("Unsupported traces exporter: %s", cfg.Exporter)
+}
+
+// Handler starting a span for every incoming request, continuing the trace of the caller.
+func Handler(next http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(next, operation)
+}
+
+// RouteMiddleware names the request span after its route template to keep the span names bounded,
+// e.g. "GET /api/users/{id}" instead of the path.
+func RouteMiddleware(route func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			template := route(r)
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + template)
+			span.SetAttributes(semconv.HTTPRouteKey.String(template))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Transport starting a span for every outgoing request and propagating the trace context in the headers.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,112 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/platform/tracing"
+	"go.opentelemetry.io/otel"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		dir      string
+		file     string
+		shutdown func(ctx context.Context) error
+	)
+
+	spans := func() []map[string]interface{} {
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		f, err := os.Open(file)
+		Expect(err).To(BeNil())
+		defer f.Close()
+
+		var spans []map[string]interface{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			span := map[string]interface{}{}
+			Expect(json.Unmarshal(scanner.Bytes(), &span)).To(Succeed())
+			spans = append(spans, span)
+		}
+
+		return spans
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		dir, err = os.MkdirTemp("", "tracing")
+		Expect(err).To(BeNil())
+		file = filepath.Join(dir, "traces.json")
+
+		shutdown, err = tracing.Setup(context.Background(), tracing.Config{
+			ServiceName: "test",
+			Exporter:    tracing.ExporterFile,
+			File:        file,
+			SampleRatio: 1,
+		})
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	Specify("the trace context is propagated to the downstream services", func() {
+		var traceparent string
+		downstream := httptest.NewServer(tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparent = r.Header.Get("traceparent")
+		}), "downstream"))
+		defer downstream.Close()
+
+		client := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+		handler := tracing.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, downstream.URL, nil)
+			Expect(err).To(BeNil())
+
+			res, err := client.Do(req)
+			Expect(err).To(BeNil())
+			res.Body.Close()
+		}), "upstream")
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/get/testvalue", nil))
+
+		Expect(traceparent).NotTo(BeEmpty())
+
+		exported := spans()
+		Expect(exported).To(HaveLen(3))
+		for _, span := range exported {
+			Expect(span["trace_id"]).To(Equal(exported[0]["trace_id"]))
+		}
+	})
+
+	Specify("the request span is named after the route", func() {
+		handler := tracing.Handler(tracing.RouteMiddleware(func(r *http.Request) string {
+			return "/api/users/{id}"
+		})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), "api")
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/users/1", nil))
+
+		exported := spans()
+		Expect(exported).To(HaveLen(1))
+		Expect(exported[0]["name"]).To(Equal("GET /api/users/{id}"))
+		Expect(exported[0]["attributes"]).To(HaveKeyWithValue("http.route", "/api/users/{id}"))
+	})
+
+	Specify("the unsupported exporters are rejected", func() {
+		_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "zipkin"})
+
+		Expect(err).To(MatchError("Unsupported traces exporter: zipkin"))
+	})
+
+	Specify("the W3C propagator is installed", func() {
+		Expect(otel.GetTextMapPropagator().Fields()).To(ContainElement("traceparent"))
+	})
+})
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"go-ddd-cqrs-example/platform/health"
+	"go-ddd-cqrs-example/platform/metrics"
+	"go-ddd-cqrs-example/platform/tracing"
 	"log"
 	"net/http"
+	"os"
 )
 
 type testResponse struct {
@@ -18,5 +23,25 @@ func main() {
 	port := ":10000"
 	log.Printf("Starting test service, Listening to: %s", port)
 	http.HandleFunc("/api/get/testvalue", returnTestValue)
-	log.Fatal(http.ListenAndServe(port, nil))
+	// The service has no dependencies, it is ready as soon as it is alive.
+	http.HandleFunc("/healthz", health.LivenessHandler())
+	http.HandleFunc("/readyz", health.ReadinessHandler(health.NewChecker()))
+
+	m := metrics.New("testresponseapi")
+	http.Handle("/metrics", m.Handler())
+
+	// The traces are exported as configured with TESTRESPONSEAPI_TRACING_EXPORTER, none by default.
+	_, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName:  "testresponseapi",
+		Exporter:     os.Getenv("TESTRESPONSEAPI_TRACING_EXPORTER"),
+		File:         os.Getenv("TESTRESPONSEAPI_TRACING_FILE"),
+		OTLPEndpoint: os.Getenv("TESTRESPONSEAPI_TRACING_OTLP_ENDPOINT"),
+		SampleRatio:  1,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler := m.Middleware(metrics.ServeMuxRoute(http.DefaultServeMux))(http.DefaultServeMux)
+	log.Fatal(http.ListenAndServe(port, tracing.Handler(handler, "testresponseapi")))
 }
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"fmt"
+	"go-ddd-cqrs-example/usersapi/server"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+)
+
+// Lifetimes of the email change links, the revert link outlives the verification one to let the owner of the old
+// email address notice an unwanted change.
+const (
+	EmailChangeTTL = time.Hour * 24
+	EmailRevertTTL = time.Hour * 24 * 7
+)
+
+// Purposes of the email change tokens.
+const (
+	EmailChangePurpose = "email_change"
+	EmailRevertPurpose = "email_revert"
+)
+
+// InvalidEmailChangeLink signifies an email change token is malformed, expired or issued for another purpose.
+type InvalidEmailChangeLink struct{}
+
+func (err InvalidEmailChangeLink) Error() string {
+	return "Invalid email change link"
+}
+
+// EmailChange of a user from the old email address to the new one carried by the email change tokens.
+type EmailChange struct {
+	UserID          uuid.UUID
+	OldEmailAddress string
+	NewEmailAddress string
+	// Version of the user the verification token was issued at, nil for the revert tokens.
+	Version *uint32
+}
+
+// CreateEmailChangeToken signs the email change for the given purpose, either the verification or the revert.
+// The tokens are not stored. The verification token applies only to the user at the version it was issued at,
+// so it cannot be replayed once the user has changed in any way, e.g. after a revert back to the old email address.
+// The revert token applies as long as the user has the new email address, so that the later changes of the user,
+// e.g. of its profile, cannot keep the owner of the old email address from recovering the account.
+func CreateEmailChangeToken(keys *server.SigningKeys, purpose string, change EmailChange) (*string, error) {
+	ttl := EmailChangeTTL
+	if purpose == EmailRevertPurpose {
+		ttl = EmailRevertTTL
+	}
+
+	// The user is the subject rather than the user_id claim, so the token is never accepted as a bearer token.
+	claims := jwt.MapClaims{}
+	claims["sub"] = change.UserID.String()
+	claims["purpose"] = purpose
+	claims["old_email_address"] = change.OldEmailAddress
+	claims["new_email_address"] = change.NewEmailAddress
+	if change.Version != nil {
+		claims["version"] = *change.Version
+	}
+	claims["exp"] = time.Now().Add(ttl).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenSigned, err := token.SignedString([]byte(keys.Current()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenSigned, nil
+}
+
+// ParseEmailChangeToken of the given purpose.
+func ParseEmailChangeToken(keys *server.SigningKeys, purpose string, tokenString string) (*EmailChange, error) {
+	token, err := parseToken(keys, tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing email change token: %w", InvalidEmailChangeLink{})
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != purpose {
+		return nil, InvalidEmailChangeLink{}
+	}
+
+	userID, err := uuid.FromString(fmt.Sprintf("%v", claims["sub"]))
+	if err != nil {
+		return nil, InvalidEmailChangeLink{}
+	}
+
+	oldEmailAddress, _ := claims["old_email_address"].(string)
+	newEmailAddress, _ := claims["new_email_address"].(string)
+	if oldEmailAddress == "" || newEmailAddress == "" {
+		return nil, InvalidEmailChangeLink{}
+	}
+
+	change := &EmailChange{
+		UserID:          userID,
+		OldEmailAddress: oldEmailAddress,
+		NewEmailAddress: newEmailAddress,
+	}
+
+	if purpose == EmailChangePurpose {
+		version, ok := claims["version"].(float64)
+		if !ok {
+			return nil, InvalidEmailChangeLink{}
+		}
+		v := uint32(version)
+		change.Version = &v
+	}
+
+	return change, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"fmt"
+	"go-ddd-cqrs-example/usersapi/server"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+)
+
+// ExportDownloadTTL is the lifetime of a download link of a personal data export, the link never outlives the export.
+const ExportDownloadTTL = time.Minute * 15
+
+const exportDownloadPurpose = "export_download"
+
+// InvalidDownloadLink signifies an export download token is malformed, expired or issued for another purpose.
+type InvalidDownloadLink struct{}
+
+func (err InvalidDownloadLink) Error() string {
+	return "Invalid download link"
+}
+
+// CreateExportDownloadToken signs the download of the export of the user, it expires at the earliest of
+// the ExportDownloadTTL and the given expiration of the export.
+func CreateExportDownloadToken(keys *server.SigningKeys, exportID, userID uuid.UUID, expiresAt time.Time) (*string, error) {
+	exp := time.Now().Add(ExportDownloadTTL)
+	if expiresAt.Before(exp) {
+		exp = expiresAt
+	}
+
+	// The user is the subject rather than the user_id claim, so the token is never accepted as a bearer token.
+	claims := jwt.MapClaims{}
+	claims["jti"] = exportID.String()
+	claims["sub"] = userID.String()
+	claims["purpose"] = exportDownloadPurpose
+	claims["exp"] = exp.Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenSigned, err := token.SignedString([]byte(keys.Current()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenSigned, nil
+}
+
+// ParseExportDownloadToken returns the export and the user IDs of the download token.
+func ParseExportDownloadToken(keys *server.SigningKeys, tokenString string) (uuid.UUID, uuid.UUID, error) {
+	token, err := parseToken(keys, tokenString)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, fmt.Errorf("Error parsing export download token: %w", InvalidDownloadLink{})
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != exportDownloadPurpose {
+		return uuid.Nil, uuid.Nil, InvalidDownloadLink{}
+	}
+
+	exportID, err := uuid.FromString(fmt.Sprintf("%v", claims["jti"]))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, InvalidDownloadLink{}
+	}
+
+	userID, err := uuid.FromString(fmt.Sprintf("%v", claims["sub"]))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, InvalidDownloadLink{}
+	}
+
+	return exportID, userID, nil
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/usersapi/server"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+)
+
+// MagicLinkTTL is the lifetime of a magic-link login token.
+const MagicLinkTTL = time.Minute * 15
+
+const magicLinkPurpose = "magic_link"
+
+// InvalidMagicLink signifies a magic-link token is malformed, expired or has already been used.
+type InvalidMagicLink struct{}
+
+func (err InvalidMagicLink) Error() string {
+	return "Invalid login link"
+}
+
+// MagicLinkToken represents a persistence model for the issued magic-link tokens.
+type MagicLinkToken struct {
+	ID        uuid.UUID  `gorm:"primary_key" json:"id"`
+	UserID    uuid.UUID  `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"default:now();not null" json:"created_at"`
+}
+
+// CreateMagicLinkToken issues a signed single-use login token for an active user.
+func CreateMagicLinkToken(ctx context.Context, server *server.Server, email string) (*string, error) {
+	activeUser, err := user.GetActiveByEmail(ctx, server.Users, email, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	record := MagicLinkToken{
+		ID:        uuid.Must(uuid.NewV4()),
+		UserID:    activeUser.ID,
+		ExpiresAt: time.Now().Add(MagicLinkTTL),
+	}
+	conn, err := postgres.Conn(server.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.ExecContext(ctx,
+		"INSERT INTO magic_link_tokens (id, user_id, expires_at) VALUES ($1, $2, $3)",
+		record.ID,
+		record.UserID,
+		record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error storing magic link token: %w", postgres.ContextError(ctx, err))
+	}
+
+	claims := jwt.MapClaims{}
+	claims["jti"] = record.ID.String()
+	claims["user_id"] = record.UserID.String()
+	claims["purpose"] = magicLinkPurpose
+	claims["exp"] = record.ExpiresAt.Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	tokenSigned, err := token.SignedString([]byte(server.Keys.Current()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenSigned, nil
+}
+
+// MagicLinkTokens issued to the user ordered from the oldest one, e.g. to export the login links of the user.
+func MagicLinkTokens(ctx context.Context, server *server.Server, userID uuid.UUID) ([]MagicLinkToken, error) {
+	conn, err := postgres.Conn(server.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx,
+		"SELECT id, user_id, expires_at, used_at, created_at FROM magic_link_tokens WHERE user_id = $1 ORDER BY created_at, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading magic link tokens: %w", postgres.ContextError(ctx, err))
+	}
+	defer rows.Close()
+
+	tokens := []MagicLinkToken{}
+	for rows.Next() {
+		var t MagicLinkToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("Error loading magic link tokens: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error loading magic link tokens: %w", postgres.ContextError(ctx, err))
+	}
+
+	return tokens, nil
+}
+
+// SignInWithMagicLink consumes a magic-link token and returns a regular token.
+func SignInWithMagicLink(ctx context.Context, server *server.Server, tokenString string) (*string, *string, error) {
+	token, err := parseToken(server.Keys, tokenString)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing magic link token: %w", InvalidMagicLink{})
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != magicLinkPurpose {
+		return nil, nil, InvalidMagicLink{}
+	}
+
+	tokenID, err := uuid.FromString(fmt.Sprintf("%v", claims["jti"]))
+	if err != nil {
+		return nil, nil, InvalidMagicLink{}
+	}
+
+	userID, err := uuid.FromString(fmt.Sprintf("%v", claims["user_id"]))
+	if err != nil {
+		return nil, nil, InvalidMagicLink{}
+	}
+
+	// Mark the token as used, only one of the concurrent requests is able to do that.
+	conn, err := postgres.Conn(server.DB)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	result, err := conn.ExecContext(ctx,
+		"UPDATE magic_link_tokens SET used_at = $1 WHERE id = $2 AND user_id = $3 AND used_at IS NULL AND expires_at > $1",
+		now,
+		tokenID,
+		userID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error consuming magic link token: %w", postgres.ContextError(ctx, err))
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error consuming magic link token: %w", err)
+	} else if rowsAffected != 1 {
+		return nil, nil, InvalidMagicLink{}
+	}
+
+	activeUser, err := user.GetActive(ctx, server.Users, userID, nil)
+	if err != nil {
+		if errors.As(err, &user.IsInactive{}) || errors.As(err, &domain_errors.Timeout{}) || errors.As(err, &domain_errors.Canceled{}) {
+			return nil, nil, err
+		}
+		return nil, nil, InvalidMagicLink{}
+	}
+
+	jwtToken, err := CreateJWTToken(server.Keys.Current(), activeUser.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := recordLogin(ctx, server, activeUser.ID, LoginMethodMagicLink); err != nil {
+		return nil, nil, err
+	}
+
+	id := activeUser.ID.String()
+
+	return jwtToken, &id, nil
+}
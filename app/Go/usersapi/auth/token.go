@@ -1,12 +1,14 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"go-ddd-cqrs-example/domain/bus"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
 	"go-ddd-cqrs-example/domain/models/user"
 	"go-ddd-cqrs-example/usersapi/server"
 	"golang.org/x/crypto/bcrypt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -39,7 +41,7 @@ func CreateJWTToken(secretKey string, uid uuid.UUID) (*string, error) {
 // CheckJWTTokenValidity to ensure that every request passes only with the valid token.
 func CheckJWTTokenValidity(server server.Server, r *http.Request) (bool, error) {
 	tokenString := extractJWTToken(r)
-	token, err := jwt.Parse(tokenString, getTokenKeyFunc(server.SecretKey))
+	token, err := parseToken(server.Keys, tokenString)
 	if err != nil {
 		return false, err
 	}
@@ -63,14 +65,23 @@ func CheckJWTTokenValidity(server server.Server, r *http.Request) (bool, error)
 
 // ExtractUserID from the valid token claims.
 func ExtractUserID(server server.Server, r *http.Request) (uuid.UUID, error) {
-	tokenString := extractJWTToken(r)
-	token, err := jwt.Parse(tokenString, getTokenKeyFunc(server.SecretKey))
+	return ParseUserID(server.Keys, extractJWTToken(r))
+}
+
+// ParseUserID from the claims of the valid token string.
+func ParseUserID(keys *server.SigningKeys, tokenString string) (uuid.UUID, error) {
+	token, err := parseToken(keys, tokenString)
 	if err != nil {
 		return uuid.Nil, err
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if ok && token.Valid {
+		// The tokens issued for a purpose, e.g. the login links, are not bearer tokens.
+		if _, ok := claims["purpose"]; ok {
+			return uuid.Nil, errors.New("Invalid token")
+		}
+
 		uid := claims["user_id"]
 		id, err := uuid.FromString(fmt.Sprintf("%v", uid))
 		if err != nil {
@@ -82,6 +93,44 @@ func ExtractUserID(server server.Server, r *http.Request) (uuid.UUID, error) {
 	return uuid.Nil, nil
 }
 
+// ParseSessionUserID from the claims of the valid session token string, e.g. the one passed in the gRPC metadata.
+// Unlike ParseUserID, the unauthorized tokens and the tokens issued for a purpose, e.g. the login links, are rejected.
+func ParseSessionUserID(keys *server.SigningKeys, tokenString string) (uuid.UUID, error) {
+	token, err := parseToken(keys, tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["authorized"] != true {
+		return uuid.Nil, errors.New("Invalid token")
+	}
+	if _, ok := claims["purpose"]; ok {
+		return uuid.Nil, errors.New("Invalid token")
+	}
+
+	return uuid.FromString(fmt.Sprintf("%v", claims["user_id"]))
+}
+
+// parseToken verifying the signature with the current key and then with the previous ones.
+func parseToken(keys *server.SigningKeys, tokenString string) (*jwt.Token, error) {
+	var (
+		token *jwt.Token
+		err   error
+	)
+
+	for _, key := range keys.Verification() {
+		token, err = jwt.Parse(tokenString, getTokenKeyFunc(key))
+
+		var validationErr *jwt.ValidationError
+		if err == nil || !errors.As(err, &validationErr) || validationErr.Errors&jwt.ValidationErrorSignatureInvalid == 0 {
+			return token, err
+		}
+	}
+
+	return token, err
+}
+
 // Passed inside the jwt.Parse function which internally validates the token.
 // If token signed correctly then it uses the key to verify the signature.
 func getTokenKeyFunc(secretKey string) jwt.Keyfunc {
@@ -109,27 +158,30 @@ func extractJWTToken(r *http.Request) string {
 }
 
 // SignIn if password is correct and return a token.
-func SignIn(server *server.Server, email, password string) (*string, *string, error) {
+func SignIn(ctx context.Context, server *server.Server, email, password string) (*string, *string, error) {
 	var err error
 
-	userReceived, err := user.GetActiveByEmail(*server.DB, email, nil)
+	userReceived, err := user.GetActiveByEmail(ctx, server.Users, email, nil)
 	if err != nil {
-		if errors.As(err, &user.IsInactive{}) {
+		if errors.As(err, &user.IsInactive{}) || errors.As(err, &domain_errors.Timeout{}) || errors.As(err, &domain_errors.Canceled{}) {
 			return nil, nil, err
 		}
-		return nil, nil, errors.New("Incorrect details")
+		return nil, nil, fmt.Errorf("Incorrect details: %w", err)
 	}
 
-	err = user.VerifyUserPassword(server.DB, email, password)
+	err = user.VerifyUserPassword(ctx, server.Users, email, password)
 	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
 		return nil, nil, err
 	} else if err != nil {
 		return nil, nil, err
 	}
 
-	token, err := CreateJWTToken(server.SecretKey, userReceived.ID)
+	token, err := CreateJWTToken(server.Keys.Current(), userReceived.ID)
 	if err != nil {
-		log.Panic(err)
+		return nil, nil, fmt.Errorf("Error signing the token: %w", err)
+	}
+
+	if err := recordLogin(ctx, server, userReceived.ID, LoginMethodPassword); err != nil {
 		return nil, nil, err
 	}
 
@@ -137,3 +189,44 @@ func SignIn(server *server.Server, email, password string) (*string, *string, er
 
 	return token, &userID, nil
 }
+
+// Login methods reported to the metrics and recorded in the login history.
+const (
+	LoginMethodPassword  = user.LoginMethodPassword
+	LoginMethodMagicLink = user.LoginMethodMagicLink
+)
+
+// recordLogin of the user in its login history on behalf of the user.
+func recordLogin(ctx context.Context, server *server.Server, userID uuid.UUID, method string) error {
+	_, err := server.Commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RecordUserLogin{UserID: userID, Method: method})
+	if err != nil {
+		return fmt.Errorf("Error recording the login: %w", err)
+	}
+
+	return nil
+}
+
+// LoginReasonInvalidRequest is reported to the metrics for the login attempts rejected before signing in.
+const LoginReasonInvalidRequest = "invalid_request"
+
+// LoginFailureReason of the failed login attempt reported to the metrics, empty on success.
+func LoginFailureReason(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &domain_errors.Timeout{}):
+		return "timeout"
+	case errors.As(err, &domain_errors.Canceled{}):
+		return "cancelled"
+	case errors.As(err, &user.IsInactive{}):
+		return "inactive"
+	case errors.As(err, &user.UserNotFound{}):
+		return "unknown_user"
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return "invalid_password"
+	case errors.As(err, &InvalidMagicLink{}):
+		return "invalid_token"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,286 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the retries of the idempotent calls.
+const (
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = 100 * time.Millisecond
+)
+
+// Session of the logged in user, its token is used by the following calls of the client.
+type Session struct {
+	Token  string `json:"token"`
+	UserID string `json:"user_id"`
+}
+
+// Error of the failed call decoded from the problem details of the response.
+type Error struct {
+	responses.Problem
+}
+
+func (err *Error) Error() string {
+	if err.Detail == "" {
+		return fmt.Sprintf("%s (%s)", err.Title, err.Code)
+	}
+
+	return fmt.Sprintf("%s (%s): %s", err.Title, err.Code, err.Detail)
+}
+
+// HasCode checks the error is a failed call with the given problem code, e.g. responses.CodeUserInactive.
+func HasCode(err error, code string) bool {
+	clientErr := &Error{}
+
+	return errors.As(err, &clientErr) && clientErr.Code == code
+}
+
+// Client of the users API, safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient server.HTTPClient
+
+	mu    sync.RWMutex
+	token string
+
+	// MaxRetries of the idempotent calls failing with a network error or an unavailable server,
+	// every call is retried when it's rate limited.
+	MaxRetries int
+	// RetryBackoff before the first retry, it doubles with every retry.
+	RetryBackoff time.Duration
+}
+
+// Option of the client.
+type Option func(c *Client)
+
+// WithHTTPClient sends the requests with the given client, http.DefaultClient by default.
+func WithHTTPClient(httpClient server.HTTPClient) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken authenticates the calls with the token of a previous session.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New client of the users API at the base URL, e.g. https://localhost:8000.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		MaxRetries:   DefaultMaxRetries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// Token of the current session, empty if not logged in.
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.token
+}
+
+// SetToken of the current session, the empty token logs out.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+// Register a new user and start its session.
+func (c *Client) Register(ctx context.Context, emailAddress, password string) (*Session, error) {
+	return c.session(ctx, "/v1/register", credentials{emailAddress, password}, false)
+}
+
+// Login with the email address and the password and start the session.
+func (c *Client) Login(ctx context.Context, emailAddress, password string) (*Session, error) {
+	return c.session(ctx, "/v1/login", credentials{emailAddress, password}, true)
+}
+
+// RequestMagicLink emails a single-use login link, it succeeds for the unknown and inactive email addresses too.
+func (c *Client) RequestMagicLink(ctx context.Context, emailAddress string) error {
+	return c.call(ctx, http.MethodPost, "/v1/login/magic-link", map[string]string{"email_address": emailAddress}, nil, false)
+}
+
+// VerifyMagicLink exchanges the token of the login link for a session.
+func (c *Client) VerifyMagicLink(ctx context.Context, token string) (*Session, error) {
+	return c.session(ctx, "/v1/login/magic-link/verify", map[string]string{"token": token}, false)
+}
+
+// RefreshToken of the current session.
+func (c *Client) RefreshToken(ctx context.Context) (*Session, error) {
+	return c.session(ctx, "/v1/token/refresh", nil, true)
+}
+
+// Activate the current user.
+func (c *Client) Activate(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/v1/activate/current", nil, nil, false)
+}
+
+// Deactivate the current user.
+func (c *Client) Deactivate(ctx context.Context) error {
+	return c.call(ctx, http.MethodPost, "/v1/deactivate/current", nil, nil, false)
+}
+
+// CheckTestService checks the users API reaches the test service.
+func (c *Client) CheckTestService(ctx context.Context) error {
+	return c.call(ctx, http.MethodGet, "/v1/get/testvalue", nil, nil, true)
+}
+
+type credentials struct {
+	EmailAddress string `json:"email_address"`
+	Password     string `json:"password"`
+}
+
+// session calls the endpoint returning a session and keeps its token.
+func (c *Client) session(ctx context.Context, path string, body interface{}, idempotent bool) (*Session, error) {
+	session := &Session{}
+	if err := c.call(ctx, http.MethodPost, path, body, session, idempotent); err != nil {
+		return nil, err
+	}
+
+	c.SetToken(session.Token)
+
+	return session, nil
+}
+
+// call the endpoint and decode the response into the result unless nil.
+func (c *Client) call(ctx context.Context, method, path string, body, result interface{}, idempotent bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		res, err := c.do(ctx, method, path, payload)
+		if err == nil && res.StatusCode < http.StatusBadRequest {
+			defer res.Body.Close()
+
+			if result == nil {
+				return nil
+			}
+
+			return json.NewDecoder(res.Body).Decode(result)
+		}
+
+		if err == nil {
+			err = decodeError(res)
+		}
+
+		if attempt >= c.MaxRetries || !retryable(err, idempotent) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// decodeError of the failed response, the responses without problem details get a code derived from their status.
+func decodeError(res *http.Response) error {
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	clientErr := &Error{}
+	if err := json.Unmarshal(body, &clientErr.Problem); err != nil || clientErr.Code == "" {
+		clientErr.Problem = responses.NewProblem(statusCode(res.StatusCode), strings.TrimSpace(string(body)))
+	}
+	clientErr.Status = res.StatusCode
+
+	return clientErr
+}
+
+// statusCode is the problem code of the responses without problem details, e.g. from a proxy.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return responses.CodeUnauthorized
+	case http.StatusForbidden:
+		return responses.CodeForbidden
+	case http.StatusTooManyRequests:
+		return responses.CodeRateLimited
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return responses.CodeUpstreamFailed
+	case http.StatusGatewayTimeout:
+		return responses.CodeTimeout
+	}
+
+	return responses.CodeInternal
+}
+
+// retryable errors, the requests rejected by the rate limiter were not processed so they are always retried.
+func retryable(err error, idempotent bool) bool {
+	clientErr := &Error{}
+	if !errors.As(err, &clientErr) {
+		// Network errors, the request may have been processed.
+		return idempotent && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	switch clientErr.Status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package client_test
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/usersapi/client"
+	"go-ddd-cqrs-example/usersapi/monitoring"
+	"go-ddd-cqrs-example/usersapi/openapi"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/routes"
+	"go-ddd-cqrs-example/usersapi/server"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+)
+
+var _ = Describe("Users API client", func() {
+	var ctx = context.Background()
+
+	Describe("Calling the users API", func() {
+		var (
+			api *httptest.Server
+			c   *client.Client
+		)
+
+		BeforeEach(func() {
+			doc, err := openapi.Load()
+			Expect(err).To(BeNil())
+			validator, err := openapi.NewValidator(doc)
+			Expect(err).To(BeNil())
+			validator.ValidateResponses = true
+
+			repo := memory.NewUserRepository()
+			srv := &server.Server{
+				Router:     mux.NewRouter(),
+				Users:      repo,
+				UnitOfWork: memory.NewUnitOfWork(repo, &memory.Publisher{}),
+				Keys:       server.NewSigningKeys("secret"),
+				Metrics:    monitoring.New(),
+				Validator:  validator,
+			}
+			srv.Commands = user.NewCommandBus(srv.UnitOfWork)
+			srv.Queries = user.NewQueryBus(srv.Users)
+			routes.InitializeRoutes(srv)
+
+			api = httptest.NewServer(srv.Router)
+			c = client.New(api.URL+"/", client.WithHTTPClient(api.Client()))
+		})
+
+		AfterEach(func() {
+			api.Close()
+		})
+
+		Specify("the session token is kept and sent with the following calls", func() {
+			session, err := c.Register(ctx, "user@example.com", "password")
+			Expect(err).To(BeNil())
+			Expect(session.UserID).NotTo(BeEmpty())
+			Expect(c.Token()).To(Equal(session.Token))
+
+			Expect(c.Deactivate(ctx)).To(Succeed())
+			Expect(c.Activate(ctx)).To(Succeed())
+
+			refreshed, err := c.RefreshToken(ctx)
+			Expect(err).To(BeNil())
+			Expect(refreshed.UserID).To(Equal(session.UserID))
+
+			c.SetToken("")
+			loggedIn, err := c.Login(ctx, "user@example.com", "password")
+			Expect(err).To(BeNil())
+			Expect(loggedIn.UserID).To(Equal(session.UserID))
+		})
+
+		Specify("the error responses are decoded into typed errors", func() {
+			samples := []struct {
+				call func() error
+				code string
+			}{
+				{
+					call: func() error {
+						_, err := c.Login(ctx, "unknown@example.com", "password")
+						return err
+					},
+					code: responses.CodeInvalidCredentials,
+				},
+				{
+					call: func() error {
+						_, err := c.Register(ctx, "not an email address", "password")
+						return err
+					},
+					code: responses.CodeValidationFailed,
+				},
+				{
+					call: func() error {
+						return c.Deactivate(ctx)
+					},
+					code: responses.CodeUnauthorized,
+				},
+			}
+
+			for _, sample := range samples {
+				err := sample.call()
+				Expect(client.HasCode(err, sample.code)).To(BeTrue(), "%v", err)
+			}
+		})
+
+		Specify("the user cannot be activated twice", func() {
+			_, err := c.Register(ctx, "user@example.com", "password")
+			Expect(err).To(BeNil())
+
+			err = c.Activate(ctx)
+			Expect(client.HasCode(err, responses.CodeUserActive)).To(BeTrue(), "%v", err)
+
+			Expect(err).To(BeAssignableToTypeOf(&client.Error{}))
+			Expect(err.(*client.Error).Status).To(Equal(http.StatusUnprocessableEntity))
+			Expect(err.(*client.Error).RequestID).NotTo(BeEmpty())
+		})
+	})
+
+	Describe("Retrying the failed calls", func() {
+		var (
+			api      *httptest.Server
+			attempts int32
+			status   int
+			c        *client.Client
+		)
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&attempts, 0)
+			api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					w.WriteHeader(status)
+					return
+				}
+
+				responses.JSON(w, http.StatusOK, map[string]string{"token": "token", "user_id": "id"})
+			}))
+			c = client.New(api.URL, client.WithHTTPClient(api.Client()))
+			c.RetryBackoff = 0
+		})
+
+		AfterEach(func() {
+			api.Close()
+		})
+
+		Specify("the idempotent calls are retried when the server is unavailable", func() {
+			status = http.StatusServiceUnavailable
+
+			_, err := c.Login(ctx, "user@example.com", "password")
+			Expect(err).To(BeNil())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+		})
+
+		Specify("the other calls are not retried when the server is unavailable", func() {
+			status = http.StatusServiceUnavailable
+
+			_, err := c.Register(ctx, "user@example.com", "password")
+			Expect(client.HasCode(err, responses.CodeUpstreamFailed)).To(BeTrue(), "%v", err)
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+		})
+
+		Specify("every call is retried when it is rate limited", func() {
+			status = http.StatusTooManyRequests
+
+			_, err := c.Register(ctx, "user@example.com", "password")
+			Expect(err).To(BeNil())
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(2)))
+		})
+
+		Specify("no call is retried once the retries are disabled", func() {
+			status = http.StatusTooManyRequests
+			c.MaxRetries = 0
+
+			_, err := c.Login(ctx, "user@example.com", "password")
+			Expect(client.HasCode(err, responses.CodeRateLimited)).To(BeTrue(), "%v", err)
+			Expect(atomic.LoadInt32(&attempts)).To(Equal(int32(1)))
+		})
+	})
+})
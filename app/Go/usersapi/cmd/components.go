@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gofrs/uuid"
+	"github.com/nsqio/go-nsq"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/platform/tracing"
+	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/erasure"
+	"go-ddd-cqrs-example/usersapi/export"
+	"go-ddd-cqrs-example/usersapi/grpcapi"
+	"go-ddd-cqrs-example/usersapi/lifecycle"
+	"go-ddd-cqrs-example/usersapi/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"net/http"
+)
+
+// tracingComponent sets the tracer provider up, it is stopped last to export the spans of the other components.
+func tracingComponent(cfg config.Config) lifecycle.Component {
+	var shutdown func(ctx context.Context) error
+
+	return lifecycle.Component{
+		Name: "tracing",
+		Start: func(ctx context.Context) error {
+			var err error
+
+			shutdown, err = tracing.Setup(ctx, tracing.Config{
+				ServiceName:  "usersapi",
+				Exporter:     cfg.TracingExporter,
+				File:         cfg.TracingFile,
+				OTLPEndpoint: cfg.TracingOTLPEndpoint,
+				SampleRatio:  cfg.TracingSampleRatio,
+			})
+
+			return err
+		},
+		Stop: func(ctx context.Context) error {
+			return shutdown(ctx)
+		},
+	}
+}
+
+// databaseComponent connects to the database, it is closed once every other component is stopped.
+func databaseComponent(srv *server.Server, cfg config.Config) lifecycle.Component {
+	return lifecycle.Component{
+		Name: "database",
+		Start: func(ctx context.Context) error {
+			if err := openDatabase(ctx, srv, cfg); err != nil {
+				return err
+			}
+			srv.Metrics.RegisterDB(srv.DB.DB(), cfg.DBName)
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			return srv.DB.Close()
+		},
+	}
+}
+
+// publisherComponent creates the NSQ producer the events are published with.
+func publisherComponent(srv *server.Server, cfg config.Config) lifecycle.Component {
+	var producer *nsq.Producer
+
+	return lifecycle.Component{
+		Name: "publisher",
+		Start: func(ctx context.Context) error {
+			var err error
+
+			producer, err = nsq.NewProducer(cfg.NSQAddress, nsq.NewConfig())
+			if err != nil {
+				return err
+			}
+			srv.EventEmitter = srv.Metrics.Publisher(producer)
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			// Stop waits for the publishes in progress to complete.
+			producer.Stop()
+			return nil
+		},
+	}
+}
+
+// relayComponent publishes the events stored in the outbox,
+// the pending events are flushed on stop once the HTTP server no longer accepts commands.
+func relayComponent(srv *server.Server) lifecycle.Component {
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	return lifecycle.Component{
+		Name: "outbox relay",
+		Start: func(ctx context.Context) error {
+			srv.Relay = postgres.NewRelay(srv.DB, srv.EventEmitter)
+			srv.Relay.OnError = func(err error) {
+				zap.S().Errorw("Error relaying events", "error", err)
+			}
+
+			return nil
+		},
+		Run: func() error {
+			defer close(done)
+
+			srv.Relay.Run(runCtx)
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			<-done
+
+			return srv.Relay.Flush(ctx)
+		},
+	}
+}
+
+// exportsComponent assembles the personal data exports and purges the expired ones,
+// the exports of the erased users are removed as soon as their erasure is published.
+func exportsComponent(srv *server.Server, cfg config.Config) lifecycle.Component {
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	unsubscribe := func() {}
+
+	return lifecycle.Component{
+		Name: "exports",
+		Start: func(ctx context.Context) error {
+			var err error
+
+			srv.Exports, err = export.New(cfg.ExportDir, exportSections(srv)...)
+			if err != nil {
+				return err
+			}
+			srv.Exports.TTL = cfg.ExportTTL
+			srv.Exports.OnError = func(err error) {
+				zap.S().Errorw("Error exporting user data", "error", err)
+			}
+
+			// The exports left behind by a missed erasure are purged once expired.
+			if srv.Subscriber != nil {
+				unsubscribe, err = srv.Subscriber.Subscribe([]string{(&user.UserErased{}).Topic()}, removeErasedExports(srv.Exports))
+				if err != nil {
+					zap.S().Warnw("Error subscribing to the user erasures", "error", err)
+					unsubscribe = func() {}
+				}
+			}
+
+			return nil
+		},
+		Run: func() error {
+			defer close(done)
+
+			srv.Exports.Run(runCtx)
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			<-done
+			unsubscribe()
+
+			return srv.Exports.Close(ctx)
+		},
+	}
+}
+
+// erasureComponent erases the users whose deletion grace period is over every erasure interval.
+func erasureComponent(srv *server.Server, cfg config.Config) lifecycle.Component {
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var eraser *erasure.Eraser
+
+	return lifecycle.Component{
+		Name: "erasure",
+		Start: func(ctx context.Context) error {
+			eraser = erasure.New(srv.Commands, srv.Queries)
+			eraser.Interval = cfg.ErasureInterval
+			eraser.OnError = func(err error) {
+				zap.S().Errorw("Error erasing the users due for erasure", "error", err)
+			}
+
+			return nil
+		},
+		Run: func() error {
+			defer close(done)
+
+			eraser.Run(runCtx)
+
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			<-done
+
+			return nil
+		},
+	}
+}
+
+// exportSections of the personal data held on a user, the sessions are stateless tokens so none is stored.
+func exportSections(srv *server.Server) []export.Section {
+	return []export.Section{
+		export.ProfileSection(srv.Queries),
+		export.HistorySection(srv.Queries),
+		export.LoginHistorySection(srv.Queries),
+		{
+			Name: "login_links.json",
+			Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+				return auth.MagicLinkTokens(ctx, srv, userID)
+			},
+		},
+		{
+			Name: "events.json",
+			Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+				return postgres.UserEvents(ctx, srv.DB, userID)
+			},
+		},
+	}
+}
+
+// removeErasedExports handles the published erasures by removing the exports of the erased users.
+func removeErasedExports(exports *export.Exporter) func(topic string, body []byte) {
+	return func(topic string, body []byte) {
+		envelope := events.Envelope{}
+		erased := user.UserErased{}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			zap.S().Warnw("Error decoding event", "topic", topic, "error", err)
+			return
+		} else if err := json.Unmarshal(envelope.Event, &erased); err != nil {
+			zap.S().Warnw("Error decoding event", "topic", topic, "error", err)
+			return
+		}
+
+		userID, err := uuid.FromString(erased.UserID)
+		if err != nil {
+			zap.S().Warnw("Error decoding event", "topic", topic, "error", err)
+			return
+		}
+
+		if err := exports.RemoveUser(userID); err != nil {
+			zap.S().Errorw("Error removing exports of erased user", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// reloaderComponent applies the configuration changes without a restart,
+// the changes to the fields not tagged with reload are rejected.
+func reloaderComponent(srv *server.Server, path string, cfg config.Config, handler *swappableHandler) lifecycle.Component {
+	runCtx, cancel := context.WithCancel(context.Background())
+
+	return lifecycle.Component{
+		Name: "configuration reloader",
+		Run: func() error {
+			reloader := config.NewReloader(path, cfg, applyConfig(srv, handler))
+
+			return reloader.Run(runCtx, func(err error) {
+				zap.S().Errorw("Error reloading configuration", "error", err)
+			})
+		},
+		Stop: func(ctx context.Context) error {
+			cancel()
+			return nil
+		},
+	}
+}
+
+// httpComponent serves the API, on stop it stops accepting connections and drains the in-flight requests.
+func httpComponent(srv *server.Server, cfg config.Config, handler *swappableHandler) lifecycle.Component {
+	var (
+		httpServer *http.Server
+		listener   net.Listener
+	)
+
+	return lifecycle.Component{
+		Name: "http server",
+		Start: func(ctx context.Context) error {
+			handler.Store(corsHandler(cfg, srv.Router))
+
+			var err error
+			listener, err = net.Listen("tcp", srv.Port)
+			if err != nil {
+				return err
+			}
+
+			httpServer = &http.Server{Handler: tracing.Handler(handler, "usersapi")}
+
+			return nil
+		},
+		Run: func() error {
+			zap.S().Infow("Listening", "address", srv.Port)
+
+			err := httpServer.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+
+			return err
+		},
+		Stop: func(ctx context.Context) error {
+			return httpServer.Shutdown(ctx)
+		},
+	}
+}
+
+// grpcComponent serves the gRPC API, on stop it drains the in-flight calls and cancels the remaining streams on timeout.
+func grpcComponent(srv *server.Server, cfg config.Config) lifecycle.Component {
+	var (
+		grpcServer *grpc.Server
+		listener   net.Listener
+	)
+
+	return lifecycle.Component{
+		Name: "grpc server",
+		Start: func(ctx context.Context) error {
+			creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
+			if err != nil {
+				return err
+			}
+
+			listener, err = net.Listen("tcp", cfg.GRPCAddress)
+			if err != nil {
+				return err
+			}
+
+			grpcServer = grpcapi.NewServer(srv, cfg.GRPCReflection, grpc.Creds(creds))
+
+			return nil
+		},
+		Run: func() error {
+			zap.S().Infow("Listening", "address", cfg.GRPCAddress, "protocol", "grpc", "reflection", cfg.GRPCReflection)
+
+			return grpcServer.Serve(listener)
+		},
+		Stop: func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				// The watch streams never complete on their own.
+				grpcServer.Stop()
+				return nil
+			}
+		},
+	}
+}
@@ -1,16 +1,280 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/spf13/viper"
+	"go-ddd-cqrs-example/platform/tracing"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DefaultPath of the configuration file relative to the Go root directory.
+const DefaultPath = "./usersapi/cmd/config/configuration.yaml"
+
+// EnvPrefix of the environment variables overriding the configuration, e.g. USERSAPI_DB_HOST.
+const EnvPrefix = "USERSAPI"
+
+// Profiles select the environment specific configuration file layered on top of the base one,
+// e.g. configuration.docker.yaml next to configuration.yaml.
+const (
+	ProfileLocal  = "local"
+	ProfileDocker = "docker"
+	ProfileTest   = "test"
+)
+
+// Mailers delivering the emails, the log one writes the emails along with their links to the log.
+const (
+	MailerLog  = "log"
+	MailerSMTP = "smtp"
+)
+
+// isolationLevels supported by the unit of work.
+var isolationLevels = []interface{}{"default", "read committed", "repeatable read", "serializable"}
+
+// logLevels accepted by the logger.
+var logLevels = []interface{}{"debug", "info", "warn", "error"}
+
 // config declares connection details.
+// The fields tagged with reload are applied on configuration reloads, changes to the other ones are rejected.
 type Config struct {
+	Profile string `mapstructure:"profile"`
+
+	LogLevel string `mapstructure:"log_level" reload:"true"`
+
 	DBHost     string `mapstructure:"db_host"`
 	DBDriver   string `mapstructure:"db_driver"`
 	DBUsername string `mapstructure:"db_username"`
-	DBPassword string `mapstructure:"db_password"`
+	DBPassword Secret `mapstructure:"db_password"`
 	DBName     string `mapstructure:"db_name"`
 	DBPort     string `mapstructure:"db_port"`
 
-	SecretKey string `mapstructure:"secret_key"`
+	DBIsolationLevel string `mapstructure:"db_isolation_level"`
+	DBMaxRetries     int    `mapstructure:"db_max_retries"`
+
+	// SecretKey signs the JWT tokens, the tokens signed with the PreviousSecretKeys are still accepted to allow key rotation.
+	SecretKey          Secret   `mapstructure:"secret_key" reload:"true"`
+	PreviousSecretKeys []Secret `mapstructure:"previous_secret_keys" reload:"true"`
 
 	APIAddress     string `mapstructure:"api_address"`
 	TestAPIAddress string `mapstructure:"test_api_address"`
+
+	// GRPCAddress of the gRPC API sharing the TLS certificate of the HTTP API, empty disables it.
+	// GRPCReflection registers the reflection service for the tools like grpcurl, meant for local development.
+	GRPCAddress    string `mapstructure:"grpc_address"`
+	GRPCReflection bool   `mapstructure:"grpc_reflection"`
+
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// HealthCheckTimeout of every readiness check, the readiness report is cached for HealthCacheTTL.
+	HealthCheckTimeout time.Duration `mapstructure:"health_check_timeout"`
+	HealthCacheTTL     time.Duration `mapstructure:"health_cache_ttl"`
+
+	// TracingExporter of the spans, none, stdout, file or otlp, see the tracing package.
+	TracingExporter     string  `mapstructure:"tracing_exporter"`
+	TracingFile         string  `mapstructure:"tracing_file"`
+	TracingOTLPEndpoint string  `mapstructure:"tracing_otlp_endpoint"`
+	TracingSampleRatio  float64 `mapstructure:"tracing_sample_ratio"`
+
+	// ValidateRequests against the OpenAPI document, ValidateResponses is meant for the tests as it buffers the responses.
+	ValidateRequests  bool `mapstructure:"validate_requests"`
+	ValidateResponses bool `mapstructure:"validate_responses"`
+
+	// ShutdownTimeout to drain the in-flight requests and flush the pending events on shutdown.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+
+	MagicLinkURL string `mapstructure:"magic_link_url"`
+	// EmailChangeURL of the page verifying the new email address, EmailRevertURL of the page restoring the old one.
+	EmailChangeURL string `mapstructure:"email_change_url"`
+	EmailRevertURL string `mapstructure:"email_revert_url"`
+
+	NSQAddress string `mapstructure:"nsq_address"`
+
+	// Mailer of the emails, log or smtp, the log one is allowed in the local profile only.
+	// The smtp one delivers them from MailFrom through SMTPAddress, authenticated if SMTPUsername is set.
+	Mailer       string `mapstructure:"mailer"`
+	MailFrom     string `mapstructure:"mail_from"`
+	SMTPAddress  string `mapstructure:"smtp_address"`
+	SMTPUsername string `mapstructure:"smtp_username"`
+	SMTPPassword Secret `mapstructure:"smtp_password"`
+
+	// ExportDir stores the personal data exports of the users, they are removed ExportTTL after their completion.
+	ExportDir string        `mapstructure:"export_dir"`
+	ExportTTL time.Duration `mapstructure:"export_ttl"`
+
+	// ErasureInterval between the erasures of the users whose deletion grace period is over, zero disables them.
+	ErasureInterval time.Duration `mapstructure:"erasure_interval"`
+
+	TLSCertFile string `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `mapstructure:"tls_key_file"`
+
+	CORSAllowedOrigins []string `mapstructure:"cors_allowed_origins" reload:"true"`
+	CORSAllowedMethods []string `mapstructure:"cors_allowed_methods" reload:"true"`
+	CORSAllowedHeaders []string `mapstructure:"cors_allowed_headers" reload:"true"`
+
+	// RateLimit of the requests per second per client address, zero disables the limit.
+	RateLimit      float64 `mapstructure:"rate_limit" reload:"true"`
+	RateLimitBurst int     `mapstructure:"rate_limit_burst" reload:"true"`
+}
+
+// Load the configuration from the file at the given path layered with the profile file and the environment variables.
+// The profile defaults to the USERSAPI_PROFILE environment variable and then to the local one.
+// Every Secret field can be read from the file set in the field with the _file suffix, e.g. USERSAPI_SECRET_KEY_FILE.
+func Load(path, profile string) (*Config, error) {
+	if profile == "" {
+		profile = os.Getenv(EnvPrefix + "_PROFILE")
+	}
+	if profile == "" {
+		profile = ProfileLocal
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading configuration file: %w", err)
+	}
+
+	ext := filepath.Ext(path)
+	profilePath := strings.TrimSuffix(path, ext) + "." + profile + ext
+	if _, err := os.Stat(profilePath); err == nil {
+		v.SetConfigFile(profilePath)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("Error reading %s profile configuration file: %w", profile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// Every field is bound to the environment, including the ones missing in the files.
+	v.SetEnvPrefix(EnvPrefix)
+	for _, key := range keys() {
+		if err := v.BindEnv(key); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range secretKeys() {
+		if err := v.BindEnv(key + "_file"); err != nil {
+			return nil, err
+		}
+
+		if path := v.GetString(key + "_file"); path != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading %s: %w", key, err)
+			}
+
+			v.Set(key, strings.TrimRight(string(content), "\r\n"))
+		}
+	}
+
+	cfg := Config{}
+	err = v.Unmarshal(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding configuration: %w", err)
+	}
+
+	// The profile selected by the caller wins over the one set in the files.
+	cfg.Profile = profile
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate the configuration, all the invalid fields are reported at once.
+func (c Config) Validate() error {
+	errs := validation.Errors{
+		"profile":              validation.Validate(c.Profile, validation.Required, validation.In(ProfileLocal, ProfileDocker, ProfileTest)),
+		"log_level":            validation.Validate(strings.ToLower(c.LogLevel), validation.In(logLevels...)),
+		"db_host":              validation.Validate(c.DBHost, validation.Required, is.Host),
+		"db_driver":            validation.Validate(c.DBDriver, validation.Required, validation.In("postgres")),
+		"db_username":          validation.Validate(c.DBUsername, validation.Required),
+		"db_name":              validation.Validate(c.DBName, validation.Required),
+		"db_port":              validation.Validate(c.DBPort, validation.Required, is.Port),
+		"db_isolation_level":   validation.Validate(normalizeIsolationLevel(c.DBIsolationLevel), validation.In(isolationLevels...)),
+		"db_max_retries":       validation.Validate(c.DBMaxRetries, validation.Min(0)),
+		"secret_key":           validation.Validate(c.SecretKey, validation.Required),
+		"api_address":          validation.Validate(c.APIAddress, validation.Required),
+		"test_api_address":     validation.Validate(c.TestAPIAddress, validation.Required, is.DialString),
+		"request_timeout":      validation.Validate(c.RequestTimeout, validation.Min(time.Duration(0))),
+		"health_check_timeout": validation.Validate(c.HealthCheckTimeout, validation.Required, validation.Min(time.Duration(0))),
+		"health_cache_ttl":     validation.Validate(c.HealthCacheTTL, validation.Min(time.Duration(0))),
+		"tracing_exporter":     validation.Validate(c.TracingExporter, validation.In(tracing.Exporters...)),
+		"tracing_sample_ratio": validation.Validate(c.TracingSampleRatio, validation.Min(0.0), validation.Max(1.0)),
+		"shutdown_timeout":     validation.Validate(c.ShutdownTimeout, validation.Required, validation.Min(time.Duration(0))),
+		"magic_link_url":       validation.Validate(c.MagicLinkURL, validation.Required, is.URL),
+		"email_change_url":     validation.Validate(c.EmailChangeURL, validation.Required, is.URL),
+		"email_revert_url":     validation.Validate(c.EmailRevertURL, validation.Required, is.URL),
+		"nsq_address":          validation.Validate(c.NSQAddress, validation.Required, is.DialString),
+		"mailer":               validation.Validate(c.Mailer, validation.Required, validation.In(MailerLog, MailerSMTP)),
+		"export_dir":           validation.Validate(c.ExportDir, validation.Required),
+		"export_ttl":           validation.Validate(c.ExportTTL, validation.Required, validation.Min(time.Duration(0))),
+		"erasure_interval":     validation.Validate(c.ErasureInterval, validation.Min(time.Duration(0))),
+		"tls_cert_file":        validation.Validate(c.TLSCertFile, validation.Required),
+		"tls_key_file":         validation.Validate(c.TLSKeyFile, validation.Required),
+		"cors_allowed_origins": validation.Validate(c.CORSAllowedOrigins, validation.Required),
+		"cors_allowed_methods": validation.Validate(c.CORSAllowedMethods, validation.Required),
+		"rate_limit":           validation.Validate(c.RateLimit, validation.Min(0.0)),
+		"rate_limit_burst":     validation.Validate(c.RateLimitBurst, validation.Min(0)),
+	}
+
+	if c.TracingExporter == tracing.ExporterFile && c.TracingFile == "" {
+		errs["tracing_file"] = errors.New("cannot be blank when the traces are exported to a file")
+	}
+
+	// The log mailer would leak the login links to the logs.
+	if c.Mailer == MailerLog && c.Profile != ProfileLocal {
+		errs["mailer"] = errors.New("cannot be log outside the local profile")
+	}
+
+	if c.Mailer == MailerSMTP {
+		errs["mail_from"] = validation.Validate(c.MailFrom, validation.Required, is.Email)
+		errs["smtp_address"] = validation.Validate(c.SMTPAddress, validation.Required, is.DialString)
+	}
+
+	if c.RateLimit > 0 && c.RateLimitBurst < 1 {
+		errs["rate_limit_burst"] = errors.New("must be at least 1 when the rate limit is set")
+	}
+
+	return errs.Filter()
+}
+
+// normalizeIsolationLevel to its SQL name, e.g. "read_committed" becomes "read committed".
+func normalizeIsolationLevel(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(name))
+}
+
+// keys of the configuration fields.
+func keys() []string {
+	t := reflect.TypeOf(Config{})
+
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, t.Field(i).Tag.Get("mapstructure"))
+	}
+
+	return keys
+}
+
+// secretKeys of the Secret configuration fields.
+func secretKeys() []string {
+	t := reflect.TypeOf(Config{})
+
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type == reflect.TypeOf(Secret("")) {
+			keys = append(keys, t.Field(i).Tag.Get("mapstructure"))
+		}
+	}
+
+	return keys
 }
@@ -0,0 +1,222 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"path"
+	"runtime"
+	"time"
+)
+
+var _ = Describe("Loading configuration", func() {
+	_, filename, _, _ := runtime.Caller(0)
+	configPath := path.Join(path.Dir(filename), "configuration.yaml")
+
+	AfterEach(func() {
+		os.Unsetenv("USERSAPI_PROFILE")
+		os.Unsetenv("USERSAPI_DB_HOST")
+		os.Unsetenv("USERSAPI_REQUEST_TIMEOUT")
+		os.Unsetenv("USERSAPI_CORS_ALLOWED_ORIGINS")
+		os.Unsetenv("USERSAPI_DB_PORT")
+		os.Unsetenv("USERSAPI_NSQ_ADDRESS")
+		os.Unsetenv("USERSAPI_MAILER")
+		os.Unsetenv("USERSAPI_SMTP_ADDRESS")
+	})
+
+	Specify("the profile file is layered on top of the base file", func() {
+		cfg, err := config.Load(configPath, config.ProfileDocker)
+
+		Expect(err).To(BeNil())
+		Expect(cfg.Profile).To(Equal(config.ProfileDocker))
+		Expect(cfg.DBHost).To(Equal("live-postgres"))
+		Expect(cfg.NSQAddress).To(Equal("nsqd:4150"))
+		Expect(cfg.DBName).To(Equal("users_db"))
+		Expect(cfg.CORSAllowedMethods).To(Equal([]string{"GET", "POST", "PATCH", "DELETE"}))
+		Expect(cfg.GRPCReflection).To(BeFalse())
+		Expect(cfg.ExportDir).To(Equal("/var/lib/usersapi/exports"))
+		Expect(cfg.TLSKeyFile).To(Equal("/run/secrets/tls_key"))
+		Expect(cfg.ExportTTL).To(Equal(24 * time.Hour))
+		Expect(cfg.ErasureInterval).To(Equal(time.Hour))
+		Expect(cfg.Mailer).To(Equal(config.MailerSMTP))
+		Expect(cfg.SMTPAddress).To(Equal("mailhog:1025"))
+	})
+
+	Specify("the profile is taken from the environment by default", func() {
+		os.Setenv("USERSAPI_PROFILE", config.ProfileTest)
+
+		cfg, err := config.Load(configPath, "")
+
+		Expect(err).To(BeNil())
+		Expect(cfg.Profile).To(Equal(config.ProfileTest))
+		Expect(cfg.RequestTimeout).To(Equal(5 * time.Second))
+	})
+
+	Specify("the local profile is used when none is selected", func() {
+		cfg, err := config.Load(configPath, "")
+
+		Expect(err).To(BeNil())
+		Expect(cfg.Profile).To(Equal(config.ProfileLocal))
+		Expect(cfg.DBHost).To(Equal("localhost"))
+		Expect(cfg.GRPCAddress).To(Equal(":9000"))
+		Expect(cfg.GRPCReflection).To(BeTrue())
+		Expect(cfg.TLSKeyFile).To(Equal("./usersapi/golangbackend.key"))
+		Expect(cfg.Mailer).To(Equal(config.MailerLog))
+	})
+
+	Specify("the environment variables override the files", func() {
+		os.Setenv("USERSAPI_DB_HOST", "db.internal")
+		os.Setenv("USERSAPI_REQUEST_TIMEOUT", "30s")
+		os.Setenv("USERSAPI_CORS_ALLOWED_ORIGINS", "https://a.example.com,https://b.example.com")
+
+		cfg, err := config.Load(configPath, config.ProfileDocker)
+
+		Expect(err).To(BeNil())
+		Expect(cfg.DBHost).To(Equal("db.internal"))
+		Expect(cfg.RequestTimeout).To(Equal(30 * time.Second))
+		Expect(cfg.CORSAllowedOrigins).To(Equal([]string{"https://a.example.com", "https://b.example.com"}))
+	})
+
+	Specify("all the invalid fields are reported at once", func() {
+		os.Setenv("USERSAPI_DB_PORT", "not-a-port")
+		os.Setenv("USERSAPI_NSQ_ADDRESS", "nsqd")
+
+		_, err := config.Load(configPath, config.ProfileLocal)
+
+		var validationErrors validation.Errors
+		Expect(errors.As(err, &validationErrors)).To(BeTrue())
+		Expect(validationErrors).To(HaveLen(2))
+		Expect(validationErrors).To(HaveKey("db_port"))
+		Expect(validationErrors).To(HaveKey("nsq_address"))
+	})
+
+	Specify("the log mailer is rejected outside the local profile", func() {
+		os.Setenv("USERSAPI_MAILER", config.MailerLog)
+
+		_, err := config.Load(configPath, config.ProfileDocker)
+
+		Expect(err).To(MatchError(ContainSubstring("mailer: cannot be log outside the local profile")))
+	})
+
+	Specify("the smtp mailer requires an address", func() {
+		os.Setenv("USERSAPI_MAILER", config.MailerSMTP)
+		os.Setenv("USERSAPI_SMTP_ADDRESS", "")
+
+		_, err := config.Load(configPath, config.ProfileLocal)
+
+		Expect(err).To(MatchError(ContainSubstring("smtp_address: cannot be blank")))
+	})
+
+	Specify("an unknown profile is rejected", func() {
+		_, err := config.Load(configPath, "production")
+
+		Expect(err).To(MatchError(ContainSubstring("profile: must be a valid value")))
+	})
+
+	Specify("a missing file is reported", func() {
+		_, err := config.Load(path.Join(path.Dir(filename), "missing.yaml"), config.ProfileLocal)
+
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Loading secrets", func() {
+	_, filename, _, _ := runtime.Caller(0)
+	configPath := path.Join(path.Dir(filename), "configuration.yaml")
+
+	var tempDir string
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+		os.Unsetenv("USERSAPI_SECRET_KEY")
+		os.Unsetenv("USERSAPI_SECRET_KEY_FILE")
+		os.Unsetenv("USERSAPI_DB_PASSWORD")
+		os.Unsetenv("USERSAPI_TLS_KEY_FILE")
+	})
+
+	Specify("a secret is read from the file set in the _file field", func() {
+		secretFile := path.Join(tempDir, "secret_key")
+		err := os.WriteFile(secretFile, []byte("fromfile\n"), 0600)
+		Expect(err).To(BeNil())
+		os.Setenv("USERSAPI_SECRET_KEY_FILE", secretFile)
+
+		cfg, err := config.Load(configPath, config.ProfileLocal)
+
+		Expect(err).To(BeNil())
+		Expect(cfg.SecretKey.Value()).To(Equal("fromfile"))
+	})
+
+	Specify("a missing secret file is reported", func() {
+		os.Setenv("USERSAPI_SECRET_KEY_FILE", path.Join(tempDir, "missing"))
+
+		_, err := config.Load(configPath, config.ProfileLocal)
+
+		Expect(err).To(MatchError(ContainSubstring("Error reading secret_key")))
+	})
+
+	Specify("the secrets are redacted in the output", func() {
+		secret := config.Secret("supersecret")
+
+		Expect(fmt.Sprintf("%v %s %+v %#v %q", secret, secret, secret, secret, secret)).NotTo(ContainSubstring("supersecret"))
+
+		content, err := json.Marshal(config.Config{SecretKey: secret})
+		Expect(err).To(BeNil())
+		Expect(string(content)).NotTo(ContainSubstring("supersecret"))
+
+		buffer := &bytes.Buffer{}
+		logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buffer), zap.InfoLevel))
+		logger.Sugar().Infow("Configuration", "secret", secret, "config", config.Config{SecretKey: secret})
+		Expect(buffer.String()).To(ContainSubstring("[REDACTED]"))
+		Expect(buffer.String()).NotTo(ContainSubstring("supersecret"))
+	})
+
+	Specify("the default secrets are accepted by the local profile", func() {
+		cfg, err := config.Load(configPath, config.ProfileLocal)
+		Expect(err).To(BeNil())
+
+		Expect(cfg.CheckSecrets()).To(BeNil())
+	})
+
+	Specify("the default secrets are refused outside the local profile", func() {
+		os.Setenv("USERSAPI_TLS_KEY_FILE", path.Join(path.Dir(filename), "../../golangbackend.key"))
+
+		cfg, err := config.Load(configPath, config.ProfileDocker)
+		Expect(err).To(BeNil())
+
+		err = cfg.CheckSecrets()
+
+		var validationErrors validation.Errors
+		Expect(errors.As(err, &validationErrors)).To(BeTrue())
+		Expect(validationErrors).To(HaveKey("secret_key"))
+		Expect(validationErrors).To(HaveKey("db_password"))
+		Expect(validationErrors).To(HaveKey("tls_key_file"))
+	})
+
+	Specify("the custom secrets are accepted outside the local profile", func() {
+		tlsKeyFile := path.Join(tempDir, "tls.key")
+		err := os.WriteFile(tlsKeyFile, []byte("custom key"), 0600)
+		Expect(err).To(BeNil())
+		os.Setenv("USERSAPI_SECRET_KEY", "custom-secret-key")
+		os.Setenv("USERSAPI_DB_PASSWORD", "custom-password")
+		os.Setenv("USERSAPI_TLS_KEY_FILE", tlsKeyFile)
+
+		cfg, err := config.Load(configPath, config.ProfileDocker)
+		Expect(err).To(BeNil())
+
+		Expect(cfg.CheckSecrets()).To(BeNil())
+	})
+})
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloadDelay lets the editors finish writing the file before it is read.
+const reloadDelay = 100 * time.Millisecond
+
+// Change of a configuration field, the secrets are redacted.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Key, c.Old, c.New)
+}
+
+// NotReloadable signifies the reloaded configuration changes the fields applied at startup only.
+type NotReloadable struct {
+	Keys []string
+}
+
+func (err NotReloadable) Error() string {
+	return fmt.Sprintf("Fields %s require a restart", strings.Join(err.Keys, ", "))
+}
+
+// Diff of the configurations by field.
+func Diff(old, new Config) []Change {
+	var changes []Change
+
+	oldValue, newValue := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		if reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Key: oldValue.Type().Field(i).Tag.Get("mapstructure"),
+			Old: fmt.Sprint(oldValue.Field(i).Interface()),
+			New: fmt.Sprint(newValue.Field(i).Interface()),
+		})
+	}
+
+	return changes
+}
+
+// Reloader reloads the configuration when the files change or the process receives SIGHUP.
+type Reloader struct {
+	path    string
+	profile string
+	apply   func(cfg Config, changes []Change)
+
+	mu      sync.Mutex
+	current Config
+}
+
+// NewReloader of the current configuration loaded from the given path,
+// apply is called with the reloaded configuration once it passes the checks.
+func NewReloader(path string, current Config, apply func(cfg Config, changes []Change)) *Reloader {
+	return &Reloader{
+		path:    path,
+		profile: current.Profile,
+		apply:   apply,
+		current: current,
+	}
+}
+
+// Current configuration.
+func (r *Reloader) Current() Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+// Reload the configuration and apply it if only the reloadable fields are changed.
+// The current configuration is kept if the reloaded one is invalid.
+func (r *Reloader) Reload() ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := Load(r.path, r.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.CheckSecrets(); err != nil {
+		return nil, err
+	}
+
+	changes := Diff(r.current, *cfg)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	reloadable := reloadableKeys()
+
+	var rejected []string
+	for _, change := range changes {
+		if !reloadable[change.Key] {
+			rejected = append(rejected, change.Key)
+		}
+	}
+	if len(rejected) > 0 {
+		return nil, NotReloadable{Keys: rejected}
+	}
+
+	r.current = *cfg
+	r.apply(*cfg, changes)
+
+	return changes, nil
+}
+
+// Run reloads the configuration on changes until the context is done, the errors are passed to onError.
+func (r *Reloader) Run(ctx context.Context, onError func(err error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// The directory is watched as the editors and the Kubernetes mounts replace the files instead of writing them,
+	// any change triggers a reload which is a no-op when the configuration stays the same.
+	if err := watcher.Add(filepath.Dir(r.path)); err != nil {
+		return err
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-watcher.Events:
+			timer.Reset(reloadDelay)
+		case err := <-watcher.Errors:
+			onError(err)
+		case <-hangup:
+			timer.Reset(0)
+		case <-timer.C:
+			if _, err := r.Reload(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// reloadableKeys of the configuration fields tagged with reload.
+func reloadableKeys() map[string]bool {
+	t := reflect.TypeOf(Config{})
+
+	keys := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("reload") == "true" {
+			keys[t.Field(i).Tag.Get("mapstructure")] = true
+		}
+	}
+
+	return keys
+}
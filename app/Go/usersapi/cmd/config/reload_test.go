@@ -0,0 +1,135 @@
+package config_test
+
+import (
+	"context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+var _ = Describe("Reloading configuration", func() {
+	_, filename, _, _ := runtime.Caller(0)
+
+	var (
+		tempDir    string
+		configPath string
+		base       string
+		reloader   *config.Reloader
+		applied    []config.Config
+	)
+
+	// write the base configuration file with the given replacements.
+	write := func(replacements ...string) {
+		content := strings.NewReplacer(replacements...).Replace(base)
+		err := ioutil.WriteFile(configPath, []byte(content), 0600)
+		Expect(err).To(BeNil())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "config")
+		Expect(err).To(BeNil())
+
+		content, err := ioutil.ReadFile(path.Join(path.Dir(filename), "configuration.yaml"))
+		Expect(err).To(BeNil())
+		base = string(content)
+
+		profile, err := ioutil.ReadFile(path.Join(path.Dir(filename), "configuration.local.yaml"))
+		Expect(err).To(BeNil())
+
+		configPath = path.Join(tempDir, "configuration.yaml")
+		write()
+		err = ioutil.WriteFile(path.Join(tempDir, "configuration.local.yaml"), profile, 0600)
+		Expect(err).To(BeNil())
+
+		cfg, err := config.Load(configPath, config.ProfileLocal)
+		Expect(err).To(BeNil())
+
+		applied = nil
+		reloader = config.NewReloader(configPath, *cfg, func(cfg config.Config, changes []config.Change) {
+			applied = append(applied, cfg)
+		})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	Specify("the reloadable fields are applied and reported", func() {
+		write("log_level: info", "log_level: debug", "rate_limit: 10", "rate_limit: 5")
+
+		changes, err := reloader.Reload()
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(ConsistOf(
+			config.Change{Key: "log_level", Old: "info", New: "debug"},
+			config.Change{Key: "rate_limit", Old: "10", New: "5"},
+		))
+		Expect(applied).To(HaveLen(1))
+		Expect(applied[0].LogLevel).To(Equal("debug"))
+		Expect(reloader.Current().RateLimit).To(Equal(5.0))
+	})
+
+	Specify("the secrets are redacted in the changes", func() {
+		write("secret_key: supersecret", "secret_key: rotated")
+
+		changes, err := reloader.Reload()
+
+		Expect(err).To(BeNil())
+		Expect(changes).To(Equal([]config.Change{{Key: "secret_key", Old: "[REDACTED]", New: "[REDACTED]"}}))
+	})
+
+	Specify("the changes to the non-reloadable fields are rejected", func() {
+		write("log_level: info", "log_level: debug", "db_name: users_db", "db_name: other_db")
+
+		changes, err := reloader.Reload()
+
+		Expect(changes).To(BeEmpty())
+		Expect(err).To(Equal(config.NotReloadable{Keys: []string{"db_name"}}))
+		Expect(applied).To(BeEmpty())
+		Expect(reloader.Current().LogLevel).To(Equal("info"))
+	})
+
+	Specify("an invalid configuration is rejected", func() {
+		write("log_level: info", "log_level: verbose")
+
+		_, err := reloader.Reload()
+
+		Expect(err).To(MatchError(ContainSubstring("log_level")))
+		Expect(applied).To(BeEmpty())
+	})
+
+	Specify("the configuration is reloaded when the file changes and on SIGHUP", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			// The partially written files fail to reload, the next change is picked up anyway.
+			done <- reloader.Run(ctx, func(err error) {
+				GinkgoWriter.Write([]byte(err.Error() + "\n"))
+			})
+		}()
+
+		// The file is rewritten until the watcher, started concurrently, picks up the change.
+		Eventually(func() string {
+			write("log_level: info", "log_level: warn")
+			return reloader.Current().LogLevel
+		}, "2s", "250ms").Should(Equal("warn"))
+
+		write("log_level: info", "log_level: error")
+		err := syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		Expect(err).To(BeNil())
+		Eventually(func() string { return reloader.Current().LogLevel }).Should(Equal("error"))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+})
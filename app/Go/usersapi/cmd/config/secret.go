@@ -0,0 +1,88 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"os"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret string redacts itself in fmt, zap and JSON output, Value returns the actual secret.
+type Secret string
+
+// Value of the secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `config.Secret("` + s.String() + `")`
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// CheckSecrets refuses the secrets committed to the repository outside the local profile,
+// the services call it at startup before touching any secret.
+func (c Config) CheckSecrets() error {
+	if c.Profile == ProfileLocal {
+		return nil
+	}
+
+	errs := validation.Errors{
+		"secret_key":  validation.Validate(c.SecretKey, validation.NotIn(defaultSecrets["secret_key"]...).Error(defaultSecretMessage)),
+		"db_password": validation.Validate(c.DBPassword, validation.NotIn(defaultSecrets["db_password"]...).Error(defaultSecretMessage)),
+	}
+
+	if isDefaultTLSKey(c.TLSKeyFile) {
+		errs["tls_key_file"] = errors.New(defaultSecretMessage)
+	}
+
+	if err := errs.Filter(); err != nil {
+		return fmt.Errorf("Default secrets are not allowed in the %s profile: %w", c.Profile, err)
+	}
+
+	return nil
+}
+
+const defaultSecretMessage = "must not be a default secret"
+
+// defaultSecrets committed to the repository by configuration key, refused outside the local profile.
+var defaultSecrets = map[string][]interface{}{
+	"secret_key":  {Secret("supersecret")},
+	"db_password": {Secret("password"), Secret("postgres")},
+}
+
+// defaultTLSKeyChecksum is the SHA-256 checksum of the TLS key committed to the repository.
+const defaultTLSKeyChecksum = "438a4aeee676aa119157e5db2880a174c3d78b0186aa2aa4c2be0681945131ac"
+
+// isDefaultTLSKey checks whether the file holds the TLS key committed to the repository,
+// the missing files are reported by the TLS setup.
+func isDefaultTLSKey(path string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	checksum := sha256.Sum256(content)
+
+	return hex.EncodeToString(checksum[:]) == defaultTLSKeyChecksum
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go-ddd-cqrs-example/platform/health"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/migrations"
+	"go-ddd-cqrs-example/usersapi/server"
+	"net/http"
+)
+
+// pinger is implemented by the publishers able to check the broker connection, e.g. the NSQ producer.
+type pinger interface {
+	Ping() error
+}
+
+// healthChecker of the dependencies the API needs to serve the requests,
+// the test service is optional as only the test value endpoint depends on it.
+func healthChecker(srv *server.Server, cfg config.Config) (*health.Checker, error) {
+	migrator, err := migrations.New(srv.DB.DB())
+	if err != nil {
+		return nil, err
+	}
+
+	checker := health.NewChecker(
+		health.Check{
+			Name: "postgres",
+			Run: func(ctx context.Context) error {
+				return srv.DB.DB().PingContext(ctx)
+			},
+		},
+		health.Check{
+			Name: "migrations",
+			Run:  migrator.EnsureUpToDate,
+		},
+		health.Check{
+			Name: "nsq",
+			Run: func(ctx context.Context) error {
+				publisher, ok := srv.EventEmitter.(pinger)
+				if !ok {
+					return errors.New("Publisher does not support pings")
+				}
+
+				return publisher.Ping()
+			},
+		},
+		health.Check{
+			Name:     "test service",
+			Optional: true,
+			Run:      health.HTTPCheck(&http.Client{}, "http://"+cfg.TestAPIAddress+"/healthz"),
+		},
+	)
+	checker.Timeout = cfg.HealthCheckTimeout
+	checker.CacheTTL = cfg.HealthCacheTTL
+
+	return checker, nil
+}
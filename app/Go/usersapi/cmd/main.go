@@ -1,21 +1,33 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
-	"github.com/gorilla/handlers"
+	"flag"
 	"github.com/gorilla/mux"
-	"github.com/nsqio/go-nsq"
-	"github.com/spf13/viper"
+	"go-ddd-cqrs-example/domain/bus"
 	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/platform/broker"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/platform/tracing"
 	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/lifecycle"
+	"go-ddd-cqrs-example/usersapi/mailer"
+	"go-ddd-cqrs-example/usersapi/migrations"
+	"go-ddd-cqrs-example/usersapi/monitoring"
+	"go-ddd-cqrs-example/usersapi/openapi"
+	"go-ddd-cqrs-example/usersapi/ratelimit"
 	"go-ddd-cqrs-example/usersapi/routes"
 	"go-ddd-cqrs-example/usersapi/server"
 	"go-ddd-cqrs-example/usersapi/utils"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata" // The profile time zones are validated on images without the zoneinfo database.
 )
 
 var apiServer = server.Server{}
@@ -31,7 +43,7 @@ func initLogger() error {
 
 	// Initialize the logger.
 	logger, err := zap.Config{
-		Level:       zap.NewAtomicLevelAt(zap.InfoLevel),
+		Level:       logLevel,
 		Development: false,
 		Sampling: &zap.SamplingConfig{
 			Initial:    100,
@@ -52,45 +64,91 @@ func initLogger() error {
 	return nil
 }
 
-func loadConfiguration() error {
-	// Load up configuration.
-	viper.AddConfigPath("./usersapi/cmd/config")
-	viper.SetConfigName("configuration")
+// openDatabase connects to the database and checks the schema is up to date.
+func openDatabase(ctx context.Context, server *server.Server, cfg config.Config) error {
+	var err error
 
-	err := viper.ReadInConfig()
+	server.DB, err = utils.GetDB(
+		cfg.DBDriver,
+		cfg.DBUsername,
+		cfg.DBPassword.Value(),
+		cfg.DBPort,
+		cfg.DBHost,
+		cfg.DBName,
+	)
 	if err != nil {
 		return err
 	}
+	zap.S().Infow("Connected to the database", "driver", cfg.DBDriver, "host", cfg.DBHost)
 
-	err = viper.Unmarshal(&cfg)
+	// Refuse to serve with an outdated database schema, the migrations are applied with `migrate up`.
+	migrator, err := migrations.New(server.DB.DB())
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return migrator.EnsureUpToDate(ctx)
 }
 
-// initialize the database connection and the HTTP router.
-func initializeAPI(server *server.Server, driver, username, password, port, host, database string) error {
-	var err error
+// initialize the unit of work, the buses and the HTTP router.
+func initializeAPI(server *server.Server, isolationLevel string, maxRetries int) error {
+	server.Users = postgres.NewUserRepository(server.DB)
 
-	server.DB, err = utils.GetDB(driver, username, password, port, host, database)
+	isolation, err := postgres.ParseIsolationLevel(isolationLevel)
 	if err != nil {
 		return err
 	}
 
-	// Database migration
-	server.DB.AutoMigrate(
-		&user.User{},
-	)
+	unitOfWork := postgres.NewUnitOfWork(server.DB)
+	unitOfWork.Isolation = isolation
+	unitOfWork.MaxRetries = maxRetries
+	unitOfWork.OnCommit = server.Relay.Notify
+	server.UnitOfWork = unitOfWork
+
+	server.Commands = user.NewCommandBus(server.UnitOfWork, bus.ContextLogging(logging.FromContext), bus.Metrics(server.Metrics.ObserveMessage))
+	server.Queries = user.NewQueryBus(server.Users, bus.ContextLogging(logging.FromContext), bus.Metrics(server.Metrics.ObserveMessage))
 
 	server.Router = mux.NewRouter()
 	routes.InitializeRoutes(server)
-	server.HTTPClient = &http.Client{}
+	server.HTTPClient = &http.Client{Transport: tracing.Transport(logging.Transport(http.DefaultTransport))}
 
 	return nil
 }
 
+// requestValidator against the OpenAPI document, nil if the requests are not validated.
+func requestValidator(cfg config.Config) (*openapi.Validator, error) {
+	if !cfg.ValidateRequests {
+		return nil, nil
+	}
+
+	doc, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := openapi.NewValidator(doc)
+	if err != nil {
+		return nil, err
+	}
+	validator.ValidateResponses = cfg.ValidateResponses
+
+	return validator, nil
+}
+
+// mailSender configured for the profile, the log one is restricted to the local profile by the configuration validation.
+func mailSender(cfg config.Config) mailer.Sender {
+	if cfg.Mailer == config.MailerLog {
+		return mailer.LogSender{}
+	}
+
+	return mailer.SMTPSender{
+		Address:  cfg.SMTPAddress,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword.Value(),
+		From:     cfg.MailFrom,
+	}
+}
+
 func main() {
 	// Disable cert verification to use self-signed certificates for internal service needs.
 	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
@@ -104,58 +162,96 @@ func main() {
 		zap.S().Fatal(err)
 	}
 
-	err = loadConfiguration()
+	configPath := flag.String("config", config.DefaultPath, "path to the configuration file")
+	profile := flag.String("profile", "", "configuration profile, local, docker or test (default $"+config.EnvPrefix+"_PROFILE or local)")
+	flag.Parse()
+
+	loadedConfig, err := config.Load(*configPath, *profile)
 	if err != nil {
 		zap.S().Fatal(err)
 	}
+	cfg = *loadedConfig
 
-	nsqConfig := nsq.NewConfig()
+	if err := cfg.CheckSecrets(); err != nil {
+		zap.S().Fatal(err)
+	}
 
-	//Creating the Producer using NSQD Address
-	producer, err := nsq.NewProducer("nsqd:4150", nsqConfig)
-	if err != nil {
-		log.Fatal(err)
+	if err := setLogLevel(cfg.LogLevel); err != nil {
+		zap.S().Fatal(err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			zap.S().Fatal(err)
+		}
+		return
 	}
 
 	srv := server.Server{}
 	srv.Port = cfg.APIAddress
-	srv.SecretKey = cfg.SecretKey
+	currentKey, previousKeys := signingKeys(cfg)
+	srv.Keys = server.NewSigningKeys(currentKey, previousKeys...)
+	srv.RateLimiter = ratelimit.New(cfg.RateLimit, cfg.RateLimitBurst)
 	srv.TestAPIAddress = cfg.TestAPIAddress
-	srv.EventEmitter = *producer
+	srv.Mailer = mailSender(cfg)
+	srv.MagicLinkURL = cfg.MagicLinkURL
+	srv.EmailChangeURL = cfg.EmailChangeURL
+	srv.EmailRevertURL = cfg.EmailRevertURL
+	srv.RequestTimeout = cfg.RequestTimeout
+	srv.Metrics = monitoring.New()
+	srv.Subscriber = broker.NSQSubscriber{Address: cfg.NSQAddress}
+	user.PasswordHashObserver = srv.Metrics.ObservePasswordHashing
 
-	err = initializeAPI(
-		&srv,
-		cfg.DBDriver,
-		cfg.DBUsername,
-		cfg.DBPassword,
-		cfg.DBPort,
-		cfg.DBHost,
-		cfg.DBName,
-	)
-	if err != nil {
-		zap.S().Fatal(err)
+	// Stop on SIGINT or SIGTERM, the components are stopped in reverse order once the in-flight requests are drained.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	manager := lifecycle.Manager{
+		StopTimeout: cfg.ShutdownTimeout,
+		OnStop: func(name string, err error) {
+			if err != nil {
+				zap.S().Errorw("Error stopping component", "component", name, "error", err)
+				return
+			}
+			zap.S().Infow("Component stopped", "component", name)
+		},
 	}
+	manager.Add(tracingComponent(cfg))
+	manager.Add(databaseComponent(&srv, cfg))
+	manager.Add(publisherComponent(&srv, cfg))
+	manager.Add(relayComponent(&srv))
+	manager.Add(lifecycle.Component{
+		Name: "api",
+		Start: func(ctx context.Context) error {
+			var err error
 
-	err = run(&srv, srv.Port)
-	if err != nil {
-		zap.S().Fatal(err)
+			srv.Health, err = healthChecker(&srv, cfg)
+			if err != nil {
+				return err
+			}
+
+			srv.Validator, err = requestValidator(cfg)
+			if err != nil {
+				return err
+			}
+
+			return initializeAPI(&srv, cfg.DBIsolationLevel, cfg.DBMaxRetries)
+		},
+	})
+
+	manager.Add(exportsComponent(&srv, cfg))
+	if cfg.ErasureInterval > 0 {
+		manager.Add(erasureComponent(&srv, cfg))
 	}
-}
 
-func run(server *server.Server, addr string) error {
-	defer server.DB.Close()
-
-	fmt.Println("Listening to " + addr)
-	err := http.ListenAndServeTLS(addr,
-		"./usersapi/golangbackend.crt",
-		"./usersapi/golangbackend.key",
-		handlers.CORS(handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "Accept", "Accept-Language"}),
-			handlers.AllowedMethods([]string{"GET", "POST"}),
-			handlers.AllowedOrigins([]string{"*"}),
-		)(server.Router))
-	if err != nil {
-		return err
+	handler := &swappableHandler{}
+	manager.Add(reloaderComponent(&srv, *configPath, cfg, handler))
+	manager.Add(httpComponent(&srv, cfg, handler))
+	if cfg.GRPCAddress != "" {
+		manager.Add(grpcComponent(&srv, cfg))
 	}
 
-	return nil
+	if err := manager.Run(ctx); err != nil {
+		zap.S().Fatal(err)
+	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/gorilla/handlers"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/server"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// logLevel of the global logger, changed on configuration reloads.
+var logLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
+
+// swappableHandler serves the requests with the handler stored last,
+// it allows to rebuild the handler on configuration reloads without restarting the server.
+type swappableHandler struct {
+	handler atomic.Value
+}
+
+// Store the handler serving the next requests.
+func (h *swappableHandler) Store(handler http.Handler) {
+	h.handler.Store(&handler)
+}
+
+func (h *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.handler.Load().(*http.Handler)).ServeHTTP(w, r)
+}
+
+// corsHandler wraps the router with the CORS policy of the configuration, the ETag of the users and the Location of the exports are exposed to the browsers.
+func corsHandler(cfg config.Config, next http.Handler) http.Handler {
+	return handlers.CORS(
+		handlers.AllowedHeaders(cfg.CORSAllowedHeaders),
+		handlers.ExposedHeaders([]string{"ETag", "Location"}),
+		handlers.AllowedMethods(cfg.CORSAllowedMethods),
+		handlers.AllowedOrigins(cfg.CORSAllowedOrigins),
+	)(next)
+}
+
+// setLogLevel of the global logger, an empty level stands for info.
+func setLogLevel(level string) error {
+	if level == "" {
+		level = "info"
+	}
+
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return err
+	}
+
+	logLevel.SetLevel(l)
+
+	return nil
+}
+
+// signingKeys of the configuration, the current key first.
+func signingKeys(cfg config.Config) (string, []string) {
+	previous := make([]string, 0, len(cfg.PreviousSecretKeys))
+	for _, key := range cfg.PreviousSecretKeys {
+		previous = append(previous, key.Value())
+	}
+
+	return cfg.SecretKey.Value(), previous
+}
+
+// applyConfig returns the function applying the reloaded configuration to the running server.
+func applyConfig(srv *server.Server, handler *swappableHandler) func(cfg config.Config, changes []config.Change) {
+	return func(cfg config.Config, changes []config.Change) {
+		if err := setLogLevel(cfg.LogLevel); err != nil {
+			zap.S().Errorw("Error setting log level", "error", err)
+		}
+
+		current, previous := signingKeys(cfg)
+		srv.Keys.Set(current, previous...)
+		srv.RateLimiter.Set(cfg.RateLimit, cfg.RateLimitBurst)
+		handler.Store(corsHandler(cfg, srv.Router))
+
+		zap.S().Infow("Configuration reloaded", "changes", changes)
+	}
+}
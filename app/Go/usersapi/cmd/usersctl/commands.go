@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/usersapi/erasure"
+	"os"
+	"strings"
+	"time"
+)
+
+// commands of the CLI by name.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"create":         create,
+	"activate":       activate,
+	"deactivate":     deactivate,
+	"reset-password": resetPassword,
+	"list":           list,
+	"history":        history,
+	"erase":          erase,
+	"erase-due":      eraseDue,
+}
+
+func create(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the user")
+	password := passwordFlags(flags)
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	if *email == "" {
+		return usageError{"The -email flag is required"}
+	}
+
+	pass, err := password()
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	userID := uuid.Must(uuid.NewV4())
+
+	_, err = c.commands.Dispatch(ctx, user.RegisterUser{
+		ID:           userID,
+		EmailAddress: *email,
+		Password:     pass,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.printUser(ctx, *output, userID)
+}
+
+func activate(ctx context.Context, args []string) error {
+	return changeState(ctx, "activate", args, func(userID uuid.UUID) bus.Message {
+		return user.ActivateUser{UserID: userID}
+	})
+}
+
+func deactivate(ctx context.Context, args []string) error {
+	return changeState(ctx, "deactivate", args, func(userID uuid.UUID) bus.Message {
+		return user.DeactivateUser{UserID: userID}
+	})
+}
+
+// changeState of the user selected by the flags with the command built for its ID.
+func changeState(ctx context.Context, name string, args []string, command func(userID uuid.UUID) bus.Message) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	selectUser := userFlags(flags)
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	userID, err := selectUser(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.commands.Dispatch(ctx, command(userID)); err != nil {
+		return err
+	}
+
+	return c.printUser(ctx, *output, userID)
+}
+
+func resetPassword(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	selectUser := userFlags(flags)
+	password := passwordFlags(flags)
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	pass, err := password()
+	if err != nil {
+		return err
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	userID, err := selectUser(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.commands.Dispatch(ctx, user.ResetUserPassword{
+		UserID:   userID,
+		Password: pass,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.printUser(ctx, *output, userID)
+}
+
+func list(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	search := flags.String("search", "", "part of the email address to search for")
+	state := flags.String("state", "", "state of the users to list, active or inactive")
+	limit := flags.Int("limit", user.DefaultListLimit, "maximum number of the users to list")
+	offset := flags.Int("offset", 0, "number of the users to skip")
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	query := user.ListUsers{
+		EmailContains: *search,
+		Limit:         *limit,
+		Offset:        *offset,
+	}
+
+	switch *state {
+	case "":
+	case "active", "inactive":
+		isActive := *state == "active"
+		query.IsActive = &isActive
+	default:
+		return usageError{fmt.Sprintf("Invalid state %q, expected active or inactive", *state)}
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	result, err := c.queries.Dispatch(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return printUsers(os.Stdout, *output, result.([]user.UserView))
+}
+
+func history(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	selectUser := userFlags(flags)
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	userID, err := selectUser(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	result, err := c.queries.Dispatch(ctx, user.GetUserHistory{UserID: userID})
+	if err != nil {
+		return err
+	}
+
+	return printHistory(os.Stdout, *output, result.([]user.UserVersion))
+}
+
+func erase(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("erase", flag.ContinueOnError)
+	selectUser := userFlags(flags)
+	reason := reasonFlag(flags, user.ErasureReasonOperator)
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	userID, err := selectUser(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	tombstone, err := c.erase(ctx, userID, *reason)
+	if err != nil {
+		return err
+	}
+
+	return printTombstones(os.Stdout, *output, []user.Tombstone{*tombstone})
+}
+
+func eraseDue(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("erase-due", flag.ContinueOnError)
+	limit := flags.Int("limit", user.MaxListLimit, "maximum number of the users to erase")
+	output := outputFlag(flags)
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	c, closeFn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	eraser := erasure.New(c.commands, c.queries)
+	eraser.Limit = *limit
+	erased, eraseErr := eraser.EraseDue(ctx, time.Now())
+
+	// The users erased so far are reported even when the next one fails, the rerun picks up the rest.
+	tombstones := []user.Tombstone{}
+	for _, userID := range erased {
+		result, err := c.queries.Dispatch(ctx, user.GetUserTombstone{UserID: userID})
+		if err != nil {
+			return err
+		}
+		tombstones = append(tombstones, *result.(*user.Tombstone))
+	}
+
+	if err := printTombstones(os.Stdout, *output, tombstones); err != nil {
+		return err
+	}
+
+	return eraseErr
+}
+
+// erase the user for the given reason and load its tombstone.
+func (c *ctl) erase(ctx context.Context, userID uuid.UUID, reason string) (*user.Tombstone, error) {
+	if _, err := c.commands.Dispatch(ctx, user.EraseUser{UserID: userID, Reason: reason}); err != nil {
+		return nil, err
+	}
+
+	result, err := c.queries.Dispatch(ctx, user.GetUserTombstone{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*user.Tombstone), nil
+}
+
+// parse the command flags, no positional arguments are accepted.
+func parse(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return err
+	} else if err != nil {
+		// The flag set has already reported the error along with the usage.
+		return usageError{}
+	}
+
+	if flags.NArg() > 0 {
+		return usageError{fmt.Sprintf("Unexpected arguments: %s", strings.Join(flags.Args(), " "))}
+	}
+
+	if format := flags.Lookup("output"); format != nil {
+		if value := format.Value.String(); value != formatTable && value != formatJSON {
+			return usageError{fmt.Sprintf("Invalid output format %q, expected table or json", value)}
+		}
+	}
+
+	return nil
+}
+
+// reasonFlag declares the erasure reason flag.
+func reasonFlag(flags *flag.FlagSet, value string) *string {
+	return flags.String("reason", value, fmt.Sprintf("reason of the erasure recorded in the tombstone, %s, %s or %s",
+		user.ErasureReasonOperator, user.ErasureReasonLegalRequest, user.ErasureReasonDeletionRequest))
+}
+
+// outputFlag declares the output format flag.
+func outputFlag(flags *flag.FlagSet) *string {
+	return flags.String("output", formatTable, "output format, table or json")
+}
+
+// userFlags declares the flags selecting a user by ID or email address,
+// the returned function resolves the user ID once the flags are parsed.
+func userFlags(flags *flag.FlagSet) func(ctx context.Context, c *ctl) (uuid.UUID, error) {
+	id := flags.String("id", "", "ID of the user")
+	email := flags.String("email", "", "email address of the user")
+
+	return func(ctx context.Context, c *ctl) (uuid.UUID, error) {
+		if (*id == "") == (*email == "") {
+			return uuid.Nil, usageError{"Exactly one of the -id and -email flags is required"}
+		}
+
+		if *id != "" {
+			userID, err := uuid.FromString(*id)
+			if err != nil {
+				return uuid.Nil, usageError{fmt.Sprintf("Invalid user ID %q", *id)}
+			}
+			return userID, nil
+		}
+
+		result, err := c.queries.Dispatch(ctx, user.GetUserByEmail{EmailAddress: *email})
+		if err != nil {
+			return uuid.Nil, err
+		}
+
+		return result.(*user.UserView).ID, nil
+	}
+}
+
+// passwordFlags declares the flags providing a password,
+// the returned function reads the password once the flags are parsed.
+func passwordFlags(flags *flag.FlagSet) func() (string, error) {
+	password := flags.String("password", "", "new password, prefer -password-stdin to keep it out of the shell history")
+	fromStdin := flags.Bool("password-stdin", false, "read the password from the first line of the standard input")
+
+	return func() (string, error) {
+		if (*password == "") == !*fromStdin {
+			return "", usageError{"Exactly one of the -password and -password-stdin flags is required"}
+		}
+
+		if !*fromStdin {
+			return *password, nil
+		}
+
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("Error reading password: %w", err)
+		}
+
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+}
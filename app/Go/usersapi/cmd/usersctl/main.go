@@ -0,0 +1,165 @@
+// Command usersctl manages the users directly through the domain commands and queries.
+//
+// It loads the API configuration, the -config flag points to the file when run outside of the Go root directory:
+//
+//	go run ./usersapi/cmd/usersctl list -search example.com -output json
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nsqio/go-nsq"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/usersapi/cmd/config"
+	"go-ddd-cqrs-example/usersapi/migrations"
+	"go-ddd-cqrs-example/usersapi/utils"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: usersctl [-config path] [-profile name] <command> [flags]
+
+Commands:
+  create           create an active user
+  activate         activate an inactive user
+  deactivate       deactivate an active user
+  reset-password   replace the password of a user
+  list             list and search users
+  history          show the version history of a user
+  erase            erase a user keeping only its tombstone
+  erase-due        erase the users whose deletion grace period is over
+
+Run "usersctl -h" for the global flags and "usersctl <command> -h" for the command flags.
+`
+
+// usageError signifies the command line arguments are invalid.
+type usageError struct {
+	message string
+}
+
+func (err usageError) Error() string {
+	return err.message
+}
+
+var (
+	configPath = flag.String("config", config.DefaultPath, "path to the configuration file")
+	profile    = flag.String("profile", "", "configuration profile, local, docker or test (default $"+config.EnvPrefix+"_PROFILE or local)")
+)
+
+// ctl holds the buses the commands are dispatched through.
+type ctl struct {
+	commands *bus.Bus
+	queries  *bus.Bus
+}
+
+func main() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	zap.ReplaceGlobals(logger)
+	defer zap.S().Sync()
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage, "\nGlobal flags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", flag.Arg(0), usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The operators act on behalf of the system, any user is allowed to be managed.
+	ctx = bus.WithActor(ctx, bus.SystemActor)
+
+	err = command(ctx, flag.Args()[1:])
+	if errors.As(err, &usageError{}) {
+		if err.Error() != "" {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	} else if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// connect to the database and the event queue the same way the API does, the returned function releases them.
+func connect(ctx context.Context) (*ctl, func(), error) {
+	cfg, err := config.Load(*configPath, *profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.CheckSecrets(); err != nil {
+		return nil, nil, err
+	}
+
+	db, err := utils.GetDB(cfg.DBDriver, cfg.DBUsername, cfg.DBPassword.Value(), cfg.DBPort, cfg.DBHost, cfg.DBName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, err := migrations.New(db.DB())
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	if err := migrator.EnsureUpToDate(ctx); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	isolation, err := postgres.ParseIsolationLevel(cfg.DBIsolationLevel)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	producer, err := nsq.NewProducer(cfg.NSQAddress, nsq.NewConfig())
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	unitOfWork := postgres.NewUnitOfWork(db)
+	unitOfWork.Isolation = isolation
+	unitOfWork.MaxRetries = cfg.DBMaxRetries
+
+	relay := postgres.NewRelay(db, producer)
+
+	c := &ctl{
+		commands: user.NewCommandBus(unitOfWork, bus.Logging(zap.S())),
+		queries:  user.NewQueryBus(postgres.NewUserRepository(db), bus.Logging(zap.S())),
+	}
+
+	return c, func() {
+		// The events stored by the command are published before exiting.
+		if err := relay.Flush(context.Background()); err != nil {
+			zap.S().Errorw("Error publishing events", "error", err)
+		}
+		producer.Stop()
+		db.Close()
+	}, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/models/user"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// printUser loads the current state of the user and prints it.
+func (c *ctl) printUser(ctx context.Context, format string, userID uuid.UUID) error {
+	result, err := c.queries.Dispatch(ctx, user.GetUser{UserID: userID})
+	if err != nil {
+		return err
+	}
+
+	view := result.(*user.UserView)
+
+	if format == formatJSON {
+		return printJSON(os.Stdout, view)
+	}
+
+	return printUsers(os.Stdout, format, []user.UserView{*view})
+}
+
+func printUsers(w io.Writer, format string, users []user.UserView) error {
+	if format == formatJSON {
+		return printJSON(w, users)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL ADDRESS\tSTATE\tVERSION\tCREATED AT")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", u.ID, u.EmailAddress, state(u.IsActive), u.Version, u.CreatedAt.Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+func printHistory(w io.Writer, format string, history []user.UserVersion) error {
+	if format == formatJSON {
+		return printJSON(w, history)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tEMAIL ADDRESS\tSTATE\tRECORDED AT")
+	for _, v := range history {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", v.Version, v.EmailAddress, state(v.IsActive), v.RecordedAt.Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+func printTombstones(w io.Writer, format string, tombstones []user.Tombstone) error {
+	if format == formatJSON {
+		return printJSON(w, tombstones)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER ID\tVERSION\tREASON\tERASED AT")
+	for _, t := range tombstones {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", t.UserID, t.Version, t.Reason, t.ErasedAt.Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+func state(isActive bool) string {
+	if isActive {
+		return "active"
+	}
+
+	return "inactive"
+}
@@ -3,12 +3,15 @@ package login_controller
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
+	"go-ddd-cqrs-example/domain/bus"
 	"go-ddd-cqrs-example/domain/models/user"
 	"go-ddd-cqrs-example/usersapi/auth"
 	"go-ddd-cqrs-example/usersapi/responses"
 	"go-ddd-cqrs-example/usersapi/server"
+	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
 	"net/http"
 )
@@ -18,14 +21,14 @@ func Login(server *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
 			return
 		}
 
 		loginReq := LoginRequest{}
 		err = json.Unmarshal(body, &loginReq)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
 			return
 		}
 
@@ -34,19 +37,116 @@ func Login(server *server.Server) http.HandlerFunc {
 			validation.Field(&loginReq.Password, validation.Required, validation.Length(6, 20)),
 		)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			server.Metrics.ObserveLogin(auth.LoginMethodPassword, auth.LoginReasonInvalidRequest)
+			responses.ERROR(w, r, err)
 			return
 		}
 
-		token, userID, err := auth.SignIn(server, loginReq.EmailAddress, loginReq.Password)
+		token, userID, err := auth.SignIn(r.Context(), server, loginReq.EmailAddress, loginReq.Password)
+		server.Metrics.ObserveLogin(auth.LoginMethodPassword, auth.LoginFailureReason(err))
 		if err != nil {
-			if errors.As(err, &user.IsInactive{}) {
-				responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			// Unknown email addresses and wrong passwords are not told apart to not disclose which accounts exist.
+			if errors.As(err, &user.UserNotFound{}) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidCredentials, "Incorrect details"))
 				return
-			} else {
-				responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Incorrect details"))
+			}
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		response := loginResponse{
+			Token:  *token,
+			UserID: *userID,
+		}
+
+		responses.JSON(w, http.StatusOK, response)
+	}
+}
+
+// RequestMagicLink sends a single-use login link to the user's email address.
+func RequestMagicLink(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
+			return
+		}
+
+		magicLinkReq := MagicLinkRequest{}
+		err = json.Unmarshal(body, &magicLinkReq)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
+			return
+		}
+
+		err = validation.ValidateStruct(&magicLinkReq,
+			validation.Field(&magicLinkReq.EmailAddress, validation.Required, is.Email),
+		)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		// Unknown and inactive email addresses get the same response to not disclose which accounts exist.
+		response := statusResponse{"Login link sent if the account exists"}
+
+		token, err := auth.CreateMagicLinkToken(r.Context(), server, magicLinkReq.EmailAddress)
+		if errors.As(err, &user.UserNotFound{}) || errors.As(err, &user.IsInactive{}) {
+			responses.JSON(w, http.StatusAccepted, response)
+			return
+		} else if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		err = server.Mailer.Send(
+			magicLinkReq.EmailAddress,
+			"Your login link",
+			fmt.Sprintf("Use the following link to log in, it expires in %v: %s?token=%s", auth.MagicLinkTTL, server.MagicLinkURL, *token),
+		)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		responses.JSON(w, http.StatusAccepted, response)
+	}
+}
+
+// VerifyMagicLink exchanges a magic-link token for a regular token.
+func VerifyMagicLink(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
+			return
+		}
+
+		verificationReq := MagicLinkVerificationRequest{}
+		err = json.Unmarshal(body, &verificationReq)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
+			return
+		}
+
+		err = validation.ValidateStruct(&verificationReq,
+			validation.Field(&verificationReq.Token, validation.Required),
+		)
+		if err != nil {
+			server.Metrics.ObserveLogin(auth.LoginMethodMagicLink, auth.LoginReasonInvalidRequest)
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		token, userID, err := auth.SignInWithMagicLink(r.Context(), server, verificationReq.Token)
+		server.Metrics.ObserveLogin(auth.LoginMethodMagicLink, auth.LoginFailureReason(err))
+		if err != nil {
+			if errors.As(err, &auth.InvalidMagicLink{}) {
+				responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidLoginLink, "The login link is malformed, expired or already used"))
 				return
 			}
+			responses.ERROR(w, r, err)
+			return
 		}
 
 		response := loginResponse{
@@ -57,3 +157,38 @@ func Login(server *server.Server) http.HandlerFunc {
 		responses.JSON(w, http.StatusOK, response)
 	}
 }
+
+// RefreshToken exchanges the valid token of an active user for a new one signed with the current key.
+func RefreshToken(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		result, err := server.Queries.Dispatch(bus.WithActor(r.Context(), userID.String()), user.GetUser{UserID: userID})
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		if !result.(*user.UserView).IsActive {
+			responses.ERROR(w, r, user.IsInactive{})
+			return
+		}
+
+		token, err := auth.CreateJWTToken(server.Keys.Current(), userID)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		response := loginResponse{
+			Token:  *token,
+			UserID: userID.String(),
+		}
+
+		responses.JSON(w, http.StatusOK, response)
+	}
+}
@@ -2,6 +2,7 @@ package login_controller_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/gofrs/uuid"
 	"github.com/gorilla/mux"
@@ -9,18 +10,20 @@ import (
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	. "github.com/onsi/gomega"
-	"github.com/spf13/viper"
 	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
 	"go-ddd-cqrs-example/usersapi/cmd/config"
 	"go-ddd-cqrs-example/usersapi/controllers/login_controller"
+	"go-ddd-cqrs-example/usersapi/responses"
 	"go-ddd-cqrs-example/usersapi/routes"
 	"go-ddd-cqrs-example/usersapi/server"
 	"go-ddd-cqrs-example/usersapi/utils"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"path"
 	"runtime"
+	"strings"
 )
 
 var _ = Describe("Login controller", func() {
@@ -28,25 +31,14 @@ var _ = Describe("Login controller", func() {
 		db *gorm.DB
 	)
 
-	// Hotfix, fix inconsistent current directory to get configuration file.
-	// TODO find better way to handle this.
+	// Set up database connection using the test configuration profile.
 	_, filename, _, _ := runtime.Caller(0)
-	dir := path.Join(path.Dir(filename), "../../..")
-	err := os.Chdir(dir)
-	if err != nil {
-		panic(err)
-	}
-
-	// Set up database connection using configuration details.
-	cfg := config.Config{}
-	viper.AddConfigPath(dir + "/usersapi/cmd/config")
-	viper.SetConfigName("configuration")
-	viper.ReadInConfig()
-	viper.Unmarshal(&cfg)
+	cfg, err := config.Load(path.Join(path.Dir(filename), "../../cmd/config/configuration.yaml"), config.ProfileTest)
+	Expect(err).To(BeNil())
 	conn, err := utils.GetDB(
 		cfg.DBDriver,
 		cfg.DBUsername,
-		cfg.DBPassword,
+		cfg.DBPassword.Value(),
 		cfg.DBPort,
 		cfg.DBHost,
 		cfg.DBName,
@@ -54,13 +46,18 @@ var _ = Describe("Login controller", func() {
 	Expect(err).To(BeNil())
 
 	srv := server.Server{}
-	srv.SecretKey = cfg.SecretKey
+	srv.Keys = server.NewSigningKeys(cfg.SecretKey.Value())
 	srv.Router = mux.NewRouter()
 	routes.InitializeRoutes(&srv)
 
 	BeforeEach(func() {
 		db = conn.Begin()
 		srv.DB = db
+		srv.Users = postgres.NewUserRepository(db)
+		srv.EventEmitter = &memory.Publisher{}
+		srv.UnitOfWork = postgres.NewUnitOfWork(db)
+		srv.Commands = user.NewCommandBus(srv.UnitOfWork)
+		srv.Queries = user.NewQueryBus(srv.Users)
 	})
 
 	AfterEach(func() {
@@ -80,7 +77,7 @@ var _ = Describe("Login controller", func() {
 				Password:     "password",
 			}
 
-			_, err := user.Create(*db, usr)
+			_, err := user.Create(context.Background(), srv.Users, usr)
 			Expect(err).To(BeNil())
 
 			User2ID := uuid.Must(uuid.NewV4())
@@ -90,71 +87,76 @@ var _ = Describe("Login controller", func() {
 				Password:     "password",
 			}
 
-			_, err = user.Create(*db, usr2)
+			_, err = user.Create(context.Background(), srv.Users, usr2)
 			Expect(err).To(BeNil())
 
-			usr2Active, err := user.GetActive(*db, usr2.ID, nil)
+			usr2Active, err := user.GetActive(context.Background(), srv.Users, usr2.ID, nil)
 			Expect(err).To(BeNil())
 
-			_, err = user.Deactivate(*db, *usr2Active)
+			_, err = user.Deactivate(context.Background(), srv.Users, *usr2Active)
 			Expect(err).To(BeNil())
 		})
 
 		When("Login request is sent", func() {
 			Specify("The response returned", func() {
 				samples := []struct {
-					email        string
-					password     string
-					statusCode   int
-					errorMessage string
+					email      string
+					password   string
+					statusCode int
+					errorCode  string
+					fields     []string
 				}{
 					{
-						email:        usr.EmailAddress,
-						password:     usr.Password, // Non-hashed password is required to sign in.
-						statusCode:   http.StatusOK,
-						errorMessage: "",
+						email:      usr.EmailAddress,
+						password:   usr.Password, // Non-hashed password is required to sign in.
+						statusCode: http.StatusOK,
+						errorCode:  "",
 					},
 					{
-						email:        usr.EmailAddress,
-						password:     "WrongPassword",
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "Incorrect details",
+						email:      usr.EmailAddress,
+						password:   "WrongPassword",
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeInvalidCredentials,
 					},
 					{
-						email:        "Wrongemail@mail.com",
-						password:     usr.Password,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "Incorrect details",
+						email:      "Wrongemail@mail.com",
+						password:   usr.Password,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeInvalidCredentials,
 					},
 					{
-						email:        "Wrong email",
-						password:     usr.Password,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "email_address: must be a valid email address.",
+						email:      "Wrong email",
+						password:   usr.Password,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"email_address"},
 					},
 					{
-						email:        "",
-						password:     usr.Password,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "email_address: cannot be blank.",
+						email:      "",
+						password:   usr.Password,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"email_address"},
 					},
 					{
-						email:        usr.EmailAddress,
-						password:     "",
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "password: cannot be blank.",
+						email:      usr.EmailAddress,
+						password:   "",
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"password"},
 					},
 					{
-						email:        "Wrong email",
-						password:     "",
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "email_address: must be a valid email address; password: cannot be blank.",
+						email:      "Wrong email",
+						password:   "",
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"email_address", "password"},
 					},
 					{
-						email:        usr2.EmailAddress,
-						password:     usr2.Password, // Non-hashed password is required to sign in.
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "Invariant failed: User is inactive",
+						email:      usr2.EmailAddress,
+						password:   usr2.Password, // Non-hashed password is required to sign in.
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeUserInactive,
 					},
 				}
 
@@ -186,11 +188,127 @@ var _ = Describe("Login controller", func() {
 						Expect(responseMap["token"]).ToNot(Equal(""))
 					}
 
-					if v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
-						Expect(responseMap["error"]).To(Equal(v.errorMessage))
+					if v.errorCode != "" {
+						Expect(rr.Header().Get("Content-Type")).To(Equal(responses.ProblemContentType))
+						Expect(responseMap["code"]).To(Equal(v.errorCode))
+
+						fields := []string{}
+						if fieldErrors, ok := responseMap["errors"].([]interface{}); ok {
+							for _, fieldError := range fieldErrors {
+								fields = append(fields, fieldError.(map[string]interface{})["field"].(string))
+							}
+						}
+						Expect(fields).To(ConsistOf(v.fields))
 					}
 				}
 			})
 		})
 	})
+
+	Describe("Logging in with a magic link", func() {
+		var usr user.PendingUser
+		var sender *recordingSender
+
+		BeforeEach(func() {
+			sender = &recordingSender{}
+			srv.Mailer = sender
+			srv.MagicLinkURL = "https://localhost:8000/login/magic-link"
+
+			usr = user.PendingUser{
+				ID:           uuid.Must(uuid.NewV4()),
+				EmailAddress: "user@example.com",
+				Password:     "password",
+			}
+
+			_, err := user.Create(context.Background(), srv.Users, usr)
+			Expect(err).To(BeNil())
+		})
+
+		When("Magic link is requested and verified", func() {
+			Specify("The link can be used only once", func() {
+				requestBody, err := json.Marshal(login_controller.MagicLinkRequest{EmailAddress: usr.EmailAddress})
+				Expect(err).To(BeNil())
+
+				req, err := http.NewRequest("POST", "/api/login/magic-link", bytes.NewBuffer(requestBody))
+				Expect(err).To(BeNil())
+
+				rr := httptest.NewRecorder()
+				http.HandlerFunc(login_controller.RequestMagicLink(&srv)).ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusAccepted))
+				Expect(sender.to).To(Equal(usr.EmailAddress))
+
+				token := sender.body[strings.Index(sender.body, "token=")+len("token="):]
+
+				for _, statusCode := range []int{http.StatusOK, http.StatusUnprocessableEntity} {
+					requestBody, err := json.Marshal(login_controller.MagicLinkVerificationRequest{Token: token})
+					Expect(err).To(BeNil())
+
+					req, err := http.NewRequest("POST", "/api/login/magic-link/verify", bytes.NewBuffer(requestBody))
+					Expect(err).To(BeNil())
+
+					rr := httptest.NewRecorder()
+					http.HandlerFunc(login_controller.VerifyMagicLink(&srv)).ServeHTTP(rr, req)
+
+					responseMap := make(map[string]interface{})
+					err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+					Expect(err).To(BeNil())
+
+					Expect(rr.Code).To(Equal(statusCode))
+					if statusCode == http.StatusOK {
+						Expect(responseMap["user_id"]).To(Equal(usr.ID.String()))
+						Expect(responseMap["token"]).ToNot(BeEmpty())
+					} else {
+						Expect(responseMap["code"]).To(Equal(responses.CodeInvalidLoginLink))
+					}
+				}
+			})
+		})
+
+		When("Magic link is requested for an inactive user", func() {
+			BeforeEach(func() {
+				activeUser, err := user.GetActive(context.Background(), srv.Users, usr.ID, nil)
+				Expect(err).To(BeNil())
+
+				_, err = user.Deactivate(context.Background(), srv.Users, *activeUser)
+				Expect(err).To(BeNil())
+			})
+
+			Specify("The same response as for an unknown account is returned and no email is sent", func() {
+				request := func(emailAddress string) *httptest.ResponseRecorder {
+					requestBody, err := json.Marshal(login_controller.MagicLinkRequest{EmailAddress: emailAddress})
+					Expect(err).To(BeNil())
+
+					req, err := http.NewRequest("POST", "/api/login/magic-link", bytes.NewBuffer(requestBody))
+					Expect(err).To(BeNil())
+
+					rr := httptest.NewRecorder()
+					http.HandlerFunc(login_controller.RequestMagicLink(&srv)).ServeHTTP(rr, req)
+					return rr
+				}
+
+				inactive := request(usr.EmailAddress)
+				unknown := request("unknown@example.com")
+
+				Expect(inactive.Code).To(Equal(http.StatusAccepted))
+				Expect(inactive.Code).To(Equal(unknown.Code))
+				Expect(inactive.Body.String()).To(Equal(unknown.Body.String()))
+				Expect(sender.to).To(BeEmpty())
+			})
+		})
+	})
 })
+
+// recordingSender keeps the last sent email instead of delivering it.
+type recordingSender struct {
+	to      string
+	subject string
+	body    string
+}
+
+func (s *recordingSender) Send(to, subject, body string) error {
+	s.to = to
+	s.subject = subject
+	s.body = body
+
+	return nil
+}
@@ -9,3 +9,15 @@ type loginResponse struct {
 	Token  string `json:"token"`
 	UserID string `json:"user_id"`
 }
+
+type MagicLinkRequest struct {
+	EmailAddress string `json:"email_address"`
+}
+
+type MagicLinkVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+type statusResponse struct {
+	Message string `json:"response"`
+}
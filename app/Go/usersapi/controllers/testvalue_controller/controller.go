@@ -2,6 +2,7 @@ package testvalue_controller
 
 import (
 	"encoding/json"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
 	"go-ddd-cqrs-example/usersapi/responses"
 	"go-ddd-cqrs-example/usersapi/server"
 	"io/ioutil"
@@ -11,33 +12,37 @@ import (
 // GetTestValue from API to ensure the internal communication between services works fine.
 func GetTestValue(server *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		req, err := http.NewRequest("GET", "http://"+server.TestAPIAddress+"/api/get/testvalue", nil)
+		req, err := http.NewRequestWithContext(r.Context(), "GET", "http://"+server.TestAPIAddress+"/api/get/testvalue", nil)
 		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			responses.ERROR(w, r, err)
 			return
 		}
 
 		res, err := server.HTTPClient.Do(req)
 		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			if err := domain_errors.FromContext(r.Context()); err != nil {
+				responses.ERROR(w, r, err)
+				return
+			}
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUpstreamFailed, "The test service is unavailable"))
 			return
 		}
 
 		body, err := ioutil.ReadAll(res.Body)
 		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUpstreamFailed, "The test service returned an unexpected response"))
 			return
 		}
 
 		testValueResponse := TestResponse{}
 		err = json.Unmarshal(body, &testValueResponse)
 		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUpstreamFailed, "The test service returned an unexpected response"))
 			return
 		}
 
 		if testValueResponse.Value != "Hello world!" {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUpstreamFailed, "The test service returned an unexpected response"))
 			return
 		}
 
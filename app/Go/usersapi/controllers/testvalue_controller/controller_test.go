@@ -8,7 +8,6 @@ import (
 	"github.com/gorilla/mux"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"github.com/spf13/viper"
 	"go-ddd-cqrs-example/usersapi/cmd/config"
 	"go-ddd-cqrs-example/usersapi/controllers/testvalue_controller"
 	"go-ddd-cqrs-example/usersapi/routes"
@@ -17,7 +16,6 @@ import (
 	"io/ioutil"
 	"net/http"
 
-	"os"
 	"path"
 	"runtime"
 )
@@ -31,22 +29,13 @@ var _ = Describe("Login controller", func() {
 	mockCtrl = gomock.NewController(GinkgoT())
 	mockClient = mocks.NewMockHTTPClient(mockCtrl)
 
-	// Hotfix, fix inconsistent current directory to get configuration file.
-	// TODO find better way to handle this.
+	// Set up database connection using the test configuration profile.
 	_, filename, _, _ := runtime.Caller(0)
-	dir := path.Join(path.Dir(filename), "../../..")
-	err := os.Chdir(dir)
+	cfg, err := config.Load(path.Join(path.Dir(filename), "../../cmd/config/configuration.yaml"), config.ProfileTest)
 	Expect(err).To(BeNil())
 
-	// Set up database connection using configuration details.
-	cfg := config.Config{}
-	viper.AddConfigPath(dir + "/usersapi/cmd/config")
-	viper.SetConfigName("configuration")
-	viper.ReadInConfig()
-	viper.Unmarshal(&cfg)
-
 	srv := server.Server{}
-	srv.SecretKey = cfg.SecretKey
+	srv.Keys = server.NewSigningKeys(cfg.SecretKey.Value())
 	srv.Router = mux.NewRouter()
 	srv.Port = cfg.APIAddress
 	routes.InitializeRoutes(&srv)
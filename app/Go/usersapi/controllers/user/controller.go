@@ -1,19 +1,23 @@
 package user_controller
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	validation "github.com/go-ozzo/ozzo-validation"
-	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/bus"
 	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/events"
 	"go-ddd-cqrs-example/domain/models/user"
 	"go-ddd-cqrs-example/usersapi/auth"
 	"go-ddd-cqrs-example/usersapi/responses"
 	"go-ddd-cqrs-example/usersapi/server"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // Register new user with the given details.
@@ -21,63 +25,38 @@ func Register(server *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
 			return
 		}
 
 		registrationReq := RegistrationRequest{}
 		err = json.Unmarshal(body, &registrationReq)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
 			return
 		}
 
-		err = validation.ValidateStruct(&registrationReq,
-			validation.Field(&registrationReq.EmailAddress, validation.Required, is.Email),
-			validation.Field(&registrationReq.Password, validation.Required, validation.Length(6, 20)),
-		)
-		if err != nil {
-			responses.ERROR(w, http.StatusUnprocessableEntity, err)
-			return
-		}
-
-		pendingUser := user.PendingUser{
+		result, err := server.Commands.Dispatch(r.Context(), user.RegisterUser{
 			ID:           uuid.Must(uuid.NewV4()),
 			EmailAddress: registrationReq.EmailAddress,
 			Password:     registrationReq.Password,
-		}
-
-		userCreatedEvent, err := user.Create(*server.DB, pendingUser)
+		})
 		if err != nil {
-			if errors.As(err, &user.AlreadyExists{}) {
-				responses.ERROR(w, http.StatusUnprocessableEntity, err)
-				return
-			} else {
-				responses.ERROR(w, http.StatusInternalServerError, nil)
-				return
-			}
+			responses.ERROR(w, r, err)
+			return
 		}
 
-		if userCreatedEvent != nil {
-			payload, err := json.Marshal(userCreatedEvent)
-			if err != nil {
-				log.Println(err)
-			}
-
-			if err = server.EventEmitter.Publish("new_user", payload); err != nil {
-				log.Println("error while was emitting message", err)
-			}
-		}
+		userCreatedEvent := result.(*user.UserCreated)
 
 		pkUUID, err := uuid.FromString(userCreatedEvent.UserID)
 		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			responses.ERROR(w, r, err)
 			return
 		}
 
-		token, err := auth.CreateJWTToken(server.SecretKey, pkUUID)
+		token, err := auth.CreateJWTToken(server.Keys.Current(), pkUUID)
 		if err != nil {
-			responses.ERROR(w, http.StatusInternalServerError, nil)
+			responses.ERROR(w, r, err)
 			return
 		}
 
@@ -95,89 +74,209 @@ func Deactivate(server *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.ExtractUserID(*server, r)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
 			return
 		}
 
-		activeUser, err := user.GetActive(*server.DB, userID, nil)
+		ctx := bus.WithActor(r.Context(), userID.String())
+
+		_, err = server.Commands.Dispatch(ctx, user.DeactivateUser{UserID: userID})
 		if err != nil {
-			if errors.As(err, &user.IsInactive{}) {
-				responses.ERROR(w, http.StatusUnprocessableEntity, err)
-				return
-			} else {
-				responses.ERROR(w, http.StatusInternalServerError, errors.New("Incorrect details"))
-				return
-			}
+			responses.ERROR(w, r, err)
+			return
 		}
 
-		userDeactivatedEvent, err := user.Deactivate(*server.DB, *activeUser)
+		responses.JSON(w, http.StatusOK, StatusResponse{"User deactivated"})
+	}
+}
+
+// Activate an inactive user.
+func Activate(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
 		if err != nil {
-			if errors.As(err, &domain_errors.StateConflict{}) {
-				responses.ERROR(w, http.StatusUnprocessableEntity, err)
-				return
-			} else {
-				responses.ERROR(w, http.StatusInternalServerError, errors.New("Incorrect details"))
-				return
-			}
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
 		}
 
-		if userDeactivatedEvent != nil {
-			payload, err := json.Marshal(userDeactivatedEvent)
-			if err != nil {
-				log.Println(err)
-			}
+		ctx := bus.WithActor(r.Context(), userID.String())
 
-			if err = server.EventEmitter.Publish("deactivated_user", payload); err != nil {
-				log.Println("error while was emitting message", err)
-			}
+		_, err = server.Commands.Dispatch(ctx, user.ActivateUser{UserID: userID})
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
 		}
 
-		responses.JSON(w, http.StatusOK, StatusResponse{"User deactivated"})
+		responses.JSON(w, http.StatusOK, StatusResponse{"User activated"})
 	}
 }
 
-// Activate an inactive user.
-func Activate(server *server.Server) http.HandlerFunc {
+// GetCurrent user of the token with its version as the ETag.
+func GetCurrent(server *server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := auth.ExtractUserID(*server, r)
 		if err != nil {
-			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
 			return
 		}
 
-		inactiveUser, err := user.GetInactive(*server.DB, userID, nil)
+		view, err := getUser(bus.WithActor(r.Context(), userID.String()), server, userID)
 		if err != nil {
-			if errors.As(err, &user.IsActive{}) {
-				responses.ERROR(w, http.StatusUnprocessableEntity, err)
-				return
-			} else {
-				responses.ERROR(w, http.StatusInternalServerError, errors.New("Incorrect details"))
-				return
-			}
+			responses.ERROR(w, r, err)
+			return
 		}
 
-		userActivatedEvent, err := user.Activate(*server.DB, *inactiveUser)
+		w.Header().Set("ETag", entityTag(view.Version))
+		responses.JSON(w, http.StatusOK, newUserResponse(view))
+	}
+}
+
+// UpdateCurrent user of the token, the status transitions activate or deactivate it and setting the current status is a no-op.
+// The changed fields are applied by a single command, so either all of them or none are stored.
+// The update applies only to the version of the If-Match header if any, the precondition fails once the user has changed.
+func UpdateCurrent(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
 		if err != nil {
-			if errors.As(err, &domain_errors.StateConflict{}) {
-				responses.ERROR(w, http.StatusUnprocessableEntity, err)
-				return
-			} else {
-				responses.ERROR(w, http.StatusInternalServerError, errors.New("Incorrect details"))
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
+			return
+		}
+
+		updateReq := UpdateUserRequest{}
+		err = json.Unmarshal(body, &updateReq)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
+			return
+		}
+
+		err = validation.ValidateStruct(&updateReq,
+			validation.Field(&updateReq.Status, validation.In(StatusActive, StatusInactive)),
+		)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		tags, err := ifMatchTags(r.Header.Get("If-Match"))
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The If-Match header is not a list of entity tags"))
+			return
+		}
+
+		ctx := bus.WithActor(r.Context(), userID.String())
+
+		view, err := getUser(ctx, server, userID)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		var version *uint32
+		if tags != nil {
+			if !matchesEntityTag(tags, view.Version) {
+				responses.PROBLEM(w, r, preconditionFailed())
 				return
 			}
+			version = &view.Version
 		}
 
-		if userActivatedEvent != nil {
-			payload, err := json.Marshal(userActivatedEvent)
-			if err != nil {
-				log.Println(err)
-			}
+		var isActive *bool
+		if updateReq.Status != nil {
+			active := *updateReq.Status == StatusActive
+			isActive = &active
+		}
 
-			if err = server.EventEmitter.Publish("activated_user", payload); err != nil {
-				log.Println("error while was emitting message", err)
+		result, err := server.Commands.Dispatch(ctx, user.UpdateUser{
+			UserID:      userID,
+			Version:     version,
+			IsActive:    isActive,
+			DisplayName: updateReq.DisplayName,
+			Locale:      updateReq.Locale,
+			Timezone:    updateReq.Timezone,
+			AvatarURL:   updateReq.AvatarURL,
+		})
+		// The user changed since it was read above.
+		if errors.As(err, &domain_errors.InvalidVersion{}) {
+			responses.PROBLEM(w, r, preconditionFailed())
+			return
+		} else if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		if recorded, ok := result.([]events.Event); ok && len(recorded) > 0 {
+			if view, err = getUser(ctx, server, userID); err != nil {
+				responses.ERROR(w, r, err)
+				return
 			}
 		}
 
-		responses.JSON(w, http.StatusOK, StatusResponse{"User activated"})
+		w.Header().Set("ETag", entityTag(view.Version))
+		responses.JSON(w, http.StatusOK, newUserResponse(view))
+	}
+}
+
+func getUser(ctx context.Context, server *server.Server, userID uuid.UUID) (*user.UserView, error) {
+	result, err := server.Queries.Dispatch(ctx, user.GetUser{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*user.UserView), nil
+}
+
+// entityTag of the user version.
+func entityTag(version uint32) string {
+	return strconv.Quote(strconv.FormatUint(uint64(version), 10))
+}
+
+// entityTagPattern matches a strong or weak entity tag as defined by RFC 9110, e.g. "3" or W/"3".
+var entityTagPattern = regexp.MustCompile(`^(W/)?"[\x21\x23-\x7E\x80-\xFF]*"$`)
+
+// ifMatchTags of the If-Match header, nil if it is missing or matches any version.
+// Returns an error if the header is not a list of entity tags.
+func ifMatchTags(header string) ([]string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, nil
 	}
+
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		} else if !entityTagPattern.MatchString(tag) {
+			return nil, errors.New("Invalid entity tag")
+		}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) == 0 {
+		return nil, errors.New("Invalid entity tag")
+	}
+
+	return tags, nil
+}
+
+// matchesEntityTag of the user version with the strong comparison required by If-Match, so the weak tags never match.
+func matchesEntityTag(tags []string, version uint32) bool {
+	for _, tag := range tags {
+		if tag == entityTag(version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// preconditionFailed problem of the update applied to a version the user no longer has.
+func preconditionFailed() responses.Problem {
+	return responses.NewProblem(responses.CodePreconditionFailed, "The user was changed since its ETag was read, retry with its current version")
 }
@@ -2,6 +2,7 @@ package user_controller_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gofrs/uuid"
@@ -10,17 +11,18 @@ import (
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	. "github.com/onsi/gomega"
-	"github.com/spf13/viper"
 	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
 	"go-ddd-cqrs-example/usersapi/auth"
 	"go-ddd-cqrs-example/usersapi/cmd/config"
 	user_controller "go-ddd-cqrs-example/usersapi/controllers/user"
+	"go-ddd-cqrs-example/usersapi/responses"
 	"go-ddd-cqrs-example/usersapi/routes"
 	"go-ddd-cqrs-example/usersapi/server"
 	"go-ddd-cqrs-example/usersapi/utils"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"path"
 	"runtime"
 )
@@ -30,25 +32,14 @@ var _ = Describe("User controller", func() {
 		db *gorm.DB
 	)
 
-	// Hotfix, fix inconsistent current directory to get configuration file.
-	// TODO find better way to handle this.
+	// Set up database connection using the test configuration profile.
 	_, filename, _, _ := runtime.Caller(0)
-	dir := path.Join(path.Dir(filename), "../../..")
-	err := os.Chdir(dir)
-	if err != nil {
-		panic(err)
-	}
-
-	// Set up database connection using configuration details.
-	cfg := config.Config{}
-	viper.AddConfigPath(dir + "/usersapi/cmd/config")
-	viper.SetConfigName("configuration")
-	viper.ReadInConfig()
-	viper.Unmarshal(&cfg)
+	cfg, err := config.Load(path.Join(path.Dir(filename), "../../cmd/config/configuration.yaml"), config.ProfileTest)
+	Expect(err).To(BeNil())
 	conn, err := utils.GetDB(
 		cfg.DBDriver,
 		cfg.DBUsername,
-		cfg.DBPassword,
+		cfg.DBPassword.Value(),
 		cfg.DBPort,
 		cfg.DBHost,
 		cfg.DBName,
@@ -56,13 +47,18 @@ var _ = Describe("User controller", func() {
 	Expect(err).To(BeNil())
 
 	srv := server.Server{}
-	srv.SecretKey = cfg.SecretKey
+	srv.Keys = server.NewSigningKeys(cfg.SecretKey.Value())
 	srv.Router = mux.NewRouter()
 	routes.InitializeRoutes(&srv)
 
 	BeforeEach(func() {
 		db = conn.Begin()
 		srv.DB = db
+		srv.Users = postgres.NewUserRepository(db)
+		srv.EventEmitter = &memory.Publisher{}
+		srv.UnitOfWork = postgres.NewUnitOfWork(db)
+		srv.Commands = user.NewCommandBus(srv.UnitOfWork)
+		srv.Queries = user.NewQueryBus(srv.Users)
 	})
 
 	AfterEach(func() {
@@ -89,53 +85,58 @@ var _ = Describe("User controller", func() {
 				Password:     "password",
 			}
 
-			_, err = user.Create(*db, usr2)
+			_, err = user.Create(context.Background(), srv.Users, usr2)
 			Expect(err).To(BeNil())
 		})
 
 		When("Registration request is sent", func() {
 			Specify("The response returned", func() {
 				samples := []struct {
-					email        string
-					password     string
-					statusCode   int
-					errorMessage string
+					email      string
+					password   string
+					statusCode int
+					errorCode  string
+					fields     []string
 				}{
 					{
-						email:        usr.EmailAddress,
-						password:     usr.Password, // Non-hashed password is required to sign in.
-						statusCode:   http.StatusCreated,
-						errorMessage: "",
+						email:      usr.EmailAddress,
+						password:   usr.Password, // Non-hashed password is required to sign in.
+						statusCode: http.StatusCreated,
+						errorCode:  "",
 					},
 					{
-						email:        "Wrong email",
-						password:     usr.Password,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "email_address: must be a valid email address.",
+						email:      "Wrong email",
+						password:   usr.Password,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"email_address"},
 					},
 					{
-						email:        "unique@example.com",
-						password:     "",
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "password: cannot be blank.",
+						email:      "unique@example.com",
+						password:   "",
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"password"},
 					},
 					{
-						email:        "",
-						password:     usr.Password,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "email_address: cannot be blank.",
+						email:      "",
+						password:   usr.Password,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"email_address"},
 					},
 					{
-						email:        "Wrong email",
-						password:     "",
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "email_address: must be a valid email address; password: cannot be blank.",
+						email:      "Wrong email",
+						password:   "",
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeValidationFailed,
+						fields:     []string{"email_address", "password"},
 					},
 					{
-						email:        usr2.EmailAddress,
-						password:     usr2.Password, // Non-hashed password is required to sign in.
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "User already exists",
+						email:      usr2.EmailAddress,
+						password:   usr2.Password, // Non-hashed password is required to sign in.
+						statusCode: http.StatusConflict,
+						errorCode:  responses.CodeUserAlreadyExists,
 					},
 				}
 
@@ -166,13 +167,22 @@ var _ = Describe("User controller", func() {
 						Expect(responseMap["user_id"]).ToNot(Equal(""))
 						Expect(responseMap["token"]).ToNot(Equal(""))
 
-						usrFetched, err := user.GetActiveByEmail(*srv.DB, usr.EmailAddress, nil)
+						usrFetched, err := user.GetActiveByEmail(context.Background(), srv.Users, usr.EmailAddress, nil)
 						Expect(usrFetched).ToNot(BeNil())
 						Expect(err).To(BeNil())
 					}
 
-					if v.statusCode == http.StatusUnprocessableEntity || v.statusCode == http.StatusInternalServerError && v.errorMessage != "" {
-						Expect(responseMap["error"]).To(Equal(v.errorMessage))
+					if v.errorCode != "" {
+						Expect(rr.Header().Get("Content-Type")).To(Equal(responses.ProblemContentType))
+						Expect(responseMap["code"]).To(Equal(v.errorCode))
+
+						fields := []string{}
+						if fieldErrors, ok := responseMap["errors"].([]interface{}); ok {
+							for _, fieldError := range fieldErrors {
+								fields = append(fields, fieldError.(map[string]interface{})["field"].(string))
+							}
+						}
+						Expect(fields).To(ConsistOf(v.fields))
 					}
 				}
 			})
@@ -192,11 +202,11 @@ var _ = Describe("User controller", func() {
 				Password:     "password",
 			}
 
-			_, err = user.Create(*db, usr)
+			_, err = user.Create(context.Background(), srv.Users, usr)
 			Expect(err).To(BeNil())
 
 			//Log in the user and get the authentication token.
-			token, _, err := auth.SignIn(&srv, usr.EmailAddress, "password")
+			token, _, err := auth.SignIn(context.Background(), &srv, usr.EmailAddress, "password")
 			Expect(err).To(gomega.BeNil())
 
 			tokenString = fmt.Sprintf("Bearer %v", *token)
@@ -205,24 +215,24 @@ var _ = Describe("User controller", func() {
 		When("Deactivation request is sent", func() {
 			Specify("The response returned", func() {
 				samples := []struct {
-					token        string
-					statusCode   int
-					errorMessage string
+					token      string
+					statusCode int
+					errorCode  string
 				}{
 					{
-						token:        tokenString,
-						statusCode:   http.StatusOK,
-						errorMessage: "",
+						token:      tokenString,
+						statusCode: http.StatusOK,
+						errorCode:  "",
 					},
 					{
-						token:        tokenString,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "Invariant failed: User is inactive",
+						token:      tokenString,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeUserInactive,
 					},
 					{
-						token:        "wrongToken",
-						statusCode:   http.StatusUnauthorized,
-						errorMessage: "",
+						token:      "wrongToken",
+						statusCode: http.StatusUnauthorized,
+						errorCode:  responses.CodeUnauthorized,
 					},
 				}
 
@@ -244,8 +254,9 @@ var _ = Describe("User controller", func() {
 						Expect(responseMap["response"]).To(Equal("User deactivated"))
 					}
 
-					if v.statusCode == http.StatusUnprocessableEntity || v.statusCode == http.StatusInternalServerError && v.errorMessage != "" {
-						Expect(responseMap["error"]).To(Equal(v.errorMessage))
+					if v.errorCode != "" {
+						Expect(rr.Header().Get("Content-Type")).To(Equal(responses.ProblemContentType))
+						Expect(responseMap["code"]).To(Equal(v.errorCode))
 					}
 				}
 			})
@@ -265,17 +276,17 @@ var _ = Describe("User controller", func() {
 				Password:     "password",
 			}
 
-			_, err = user.Create(*db, usr)
+			_, err = user.Create(context.Background(), srv.Users, usr)
 			Expect(err).To(BeNil())
 
-			activeUser, err := user.GetActive(*db, usr.ID, nil)
+			activeUser, err := user.GetActive(context.Background(), srv.Users, usr.ID, nil)
 			Expect(err).To(BeNil())
 
 			//Log in the user and get the authentication token.
-			token, _, err := auth.SignIn(&srv, usr.EmailAddress, "password")
+			token, _, err := auth.SignIn(context.Background(), &srv, usr.EmailAddress, "password")
 			Expect(err).To(gomega.BeNil())
 
-			_, err = user.Deactivate(*db, *activeUser)
+			_, err = user.Deactivate(context.Background(), srv.Users, *activeUser)
 			Expect(err).To(BeNil())
 
 			tokenString = fmt.Sprintf("Bearer %v", *token)
@@ -284,24 +295,24 @@ var _ = Describe("User controller", func() {
 		When("Activation request is sent", func() {
 			Specify("The response returned", func() {
 				samples := []struct {
-					token        string
-					statusCode   int
-					errorMessage string
+					token      string
+					statusCode int
+					errorCode  string
 				}{
 					{
-						token:        tokenString,
-						statusCode:   http.StatusOK,
-						errorMessage: "",
+						token:      tokenString,
+						statusCode: http.StatusOK,
+						errorCode:  "",
 					},
 					{
-						token:        tokenString,
-						statusCode:   http.StatusUnprocessableEntity,
-						errorMessage: "Invariant failed: User is active",
+						token:      tokenString,
+						statusCode: http.StatusUnprocessableEntity,
+						errorCode:  responses.CodeUserActive,
 					},
 					{
-						token:        "wrongToken",
-						statusCode:   http.StatusUnauthorized,
-						errorMessage: "",
+						token:      "wrongToken",
+						statusCode: http.StatusUnauthorized,
+						errorCode:  responses.CodeUnauthorized,
 					},
 				}
 
@@ -323,8 +334,9 @@ var _ = Describe("User controller", func() {
 						Expect(responseMap["response"]).To(Equal("User activated"))
 					}
 
-					if v.statusCode == http.StatusUnprocessableEntity || v.statusCode == http.StatusInternalServerError && v.errorMessage != "" {
-						Expect(responseMap["error"]).To(Equal(v.errorMessage))
+					if v.errorCode != "" {
+						Expect(rr.Header().Get("Content-Type")).To(Equal(responses.ProblemContentType))
+						Expect(responseMap["code"]).To(Equal(v.errorCode))
 					}
 				}
 			})
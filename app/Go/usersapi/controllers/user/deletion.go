@@ -0,0 +1,79 @@
+package user_controller
+
+import (
+	"encoding/json"
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+)
+
+// DeleteCurrent user of the token confirmed with its password. The user is deactivated right away and erased
+// once the grace period is over, activating the user in the meantime cancels the deletion.
+func DeleteCurrent(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
+			return
+		}
+
+		deletionReq := DeletionRequest{}
+		err = json.Unmarshal(body, &deletionReq)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
+			return
+		}
+
+		err = validation.ValidateStruct(&deletionReq,
+			validation.Field(&deletionReq.Password, validation.Required),
+		)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		ctx := bus.WithActor(r.Context(), userID.String())
+
+		view, err := getUser(ctx, server, userID)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		err = user.VerifyUserPassword(ctx, server.Users, view.EmailAddress, deletionReq.Password)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidCredentials, "The password is incorrect"))
+			return
+		} else if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		_, err = server.Commands.Dispatch(ctx, user.RequestUserDeletion{UserID: userID})
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		if view, err = getUser(ctx, server, userID); err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", entityTag(view.Version))
+		responses.JSON(w, http.StatusAccepted, newUserResponse(view))
+	}
+}
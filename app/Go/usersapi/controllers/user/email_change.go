@@ -0,0 +1,208 @@
+package user_controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"go-ddd-cqrs-example/domain/bus"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// RequestEmailChange of the current user confirmed with its password, the verification link is sent to the new email address.
+func RequestEmailChange(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
+			return
+		}
+
+		changeReq := EmailChangeRequest{}
+		err = json.Unmarshal(body, &changeReq)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
+			return
+		}
+		changeReq.EmailAddress = strings.ToLower(strings.TrimSpace(changeReq.EmailAddress))
+
+		err = validation.ValidateStruct(&changeReq,
+			validation.Field(&changeReq.EmailAddress, validation.Required, is.Email),
+			validation.Field(&changeReq.Password, validation.Required),
+		)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		ctx := bus.WithActor(r.Context(), userID.String())
+
+		view, err := getUser(ctx, server, userID)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		} else if view.EmailAddress == changeReq.EmailAddress {
+			responses.ERROR(w, r, validation.Errors{"email_address": errors.New("must differ from the current email address")})
+			return
+		}
+
+		err = user.VerifyUserPassword(ctx, server.Users, view.EmailAddress, changeReq.Password)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidCredentials, "The password is incorrect"))
+			return
+		} else if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		// Fail early for a taken email address, the uniqueness is enforced again once the change is verified.
+		_, err = server.Queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.GetUserByEmail{EmailAddress: changeReq.EmailAddress})
+		if err == nil {
+			responses.ERROR(w, r, user.AlreadyExists{})
+			return
+		} else if !errors.As(err, &user.UserNotFound{}) {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		token, err := auth.CreateEmailChangeToken(server.Keys, auth.EmailChangePurpose, auth.EmailChange{
+			UserID:          userID,
+			OldEmailAddress: view.EmailAddress,
+			NewEmailAddress: changeReq.EmailAddress,
+			Version:         &view.Version,
+		})
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		err = server.Mailer.Send(
+			changeReq.EmailAddress,
+			"Confirm your new email address",
+			fmt.Sprintf("Use the following link to confirm the email address of your account, it expires in %v: %s?token=%s", auth.EmailChangeTTL, server.EmailChangeURL, *token),
+		)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		responses.JSON(w, http.StatusAccepted, StatusResponse{"Verification link sent to the new email address"})
+	}
+}
+
+// VerifyEmailChange applies the change of the verification link and notifies the old email address with a revert link.
+func VerifyEmailChange(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		change, ok := parseEmailChangeToken(w, r, server, auth.EmailChangePurpose)
+		if !ok {
+			return
+		}
+
+		if !changeEmail(w, r, server, *change) {
+			return
+		}
+
+		token, err := auth.CreateEmailChangeToken(server.Keys, auth.EmailRevertPurpose, auth.EmailChange{
+			UserID:          change.UserID,
+			OldEmailAddress: change.NewEmailAddress,
+			NewEmailAddress: change.OldEmailAddress,
+		})
+		if err == nil {
+			err = server.Mailer.Send(
+				change.OldEmailAddress,
+				"Your email address was changed",
+				fmt.Sprintf("The email address of your account was changed to %s. If you did not request it, use the following link to restore it, it expires in %v: %s?token=%s",
+					change.NewEmailAddress, auth.EmailRevertTTL, server.EmailRevertURL, *token),
+			)
+		}
+		// The change is already stored, the failed notification is not reported to the new owner of the account.
+		if err != nil {
+			logging.FromContext(r.Context()).Errorw("Error notifying the old email address", "user_id", change.UserID, "error", err)
+		}
+
+		responses.JSON(w, http.StatusOK, StatusResponse{"Email address changed"})
+	}
+}
+
+// RevertEmailChange restores the old email address with the revert link sent to it.
+func RevertEmailChange(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		change, ok := parseEmailChangeToken(w, r, server, auth.EmailRevertPurpose)
+		if !ok {
+			return
+		}
+
+		if !changeEmail(w, r, server, *change) {
+			return
+		}
+
+		responses.JSON(w, http.StatusOK, StatusResponse{"Email address restored"})
+	}
+}
+
+// parseEmailChangeToken of the request body, the problem is written to the response on failure.
+func parseEmailChangeToken(w http.ResponseWriter, r *http.Request, server *server.Server, purpose string) (*auth.EmailChange, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body could not be read"))
+		return nil, false
+	}
+
+	verificationReq := EmailChangeVerificationRequest{}
+	err = json.Unmarshal(body, &verificationReq)
+	if err != nil {
+		responses.PROBLEM(w, r, responses.NewProblem(responses.CodeMalformedRequest, "The request body is not valid JSON"))
+		return nil, false
+	}
+
+	err = validation.ValidateStruct(&verificationReq,
+		validation.Field(&verificationReq.Token, validation.Required),
+	)
+	if err != nil {
+		responses.ERROR(w, r, err)
+		return nil, false
+	}
+
+	change, err := auth.ParseEmailChangeToken(server.Keys, purpose, verificationReq.Token)
+	if err != nil {
+		responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidEmailChangeLink, "The email change link is malformed, expired or already used"))
+		return nil, false
+	}
+
+	return change, true
+}
+
+// changeEmail on behalf of the user of the link, at the version it was issued at if any, the problem is written to the response on failure.
+func changeEmail(w http.ResponseWriter, r *http.Request, server *server.Server, change auth.EmailChange) bool {
+	_, err := server.Commands.Dispatch(bus.WithActor(r.Context(), change.UserID.String()), user.ChangeUserEmail{
+		UserID:          change.UserID,
+		Version:         change.Version,
+		OldEmailAddress: change.OldEmailAddress,
+		NewEmailAddress: change.NewEmailAddress,
+	})
+	if errors.As(err, &user.EmailAddressMismatch{}) || errors.As(err, &user.UserNotFound{}) || errors.As(err, &domain_errors.InvalidVersion{}) {
+		responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidEmailChangeLink, "The email change link is malformed, expired or already used"))
+		return false
+	} else if err != nil {
+		responses.ERROR(w, r, err)
+		return false
+	}
+
+	return true
+}
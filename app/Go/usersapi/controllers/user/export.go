@@ -0,0 +1,122 @@
+package user_controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/export"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"net/http"
+	"net/url"
+)
+
+// RequestExport of the personal data of the current user, the archive is assembled in background.
+func RequestExport(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		requested, err := server.Exports.Request(userID)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		exportResp, err := newExportResponse(server, requested)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", "/v2/users/me/exports/"+requested.ID.String())
+		responses.JSON(w, http.StatusAccepted, exportResp)
+	}
+}
+
+// GetExport of the current user, the download URL is given once the archive is ready.
+func GetExport(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := auth.ExtractUserID(*server, r)
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		exportID, err := uuid.FromString(mux.Vars(r)["id"])
+		if err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeExportNotFound, "Export not found"))
+			return
+		}
+
+		found, err := server.Exports.Find(userID, exportID)
+		if errors.As(err, &export.NotFound{}) {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeExportNotFound, "Export not found"))
+			return
+		} else if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		exportResp, err := newExportResponse(server, found)
+		if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+
+		responses.JSON(w, http.StatusOK, exportResp)
+	}
+}
+
+// DownloadExport archive authenticated with the token of the download URL rather than the bearer token,
+// so that the URL can be opened by a browser.
+func DownloadExport(server *server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exportID, userID, err := auth.ParseExportDownloadToken(server.Keys, r.URL.Query().Get("token"))
+		if err != nil || exportID.String() != mux.Vars(r)["id"] {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInvalidDownloadLink, "The download link is malformed or expired"))
+			return
+		}
+
+		archive, found, err := server.Exports.Open(userID, exportID)
+		if errors.As(err, &export.NotFound{}) {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeExportNotFound, "Export not found"))
+			return
+		} else if err != nil {
+			responses.ERROR(w, r, err)
+			return
+		}
+		defer archive.Close()
+
+		name := fmt.Sprintf("export-%s.zip", found.ID)
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeContent(w, r, name, *found.CompletedAt, archive)
+	}
+}
+
+func newExportResponse(server *server.Server, found *export.Export) (ExportResponse, error) {
+	exportResp := ExportResponse{
+		ID:          found.ID.String(),
+		Status:      found.Status,
+		CreatedAt:   found.CreatedAt,
+		CompletedAt: found.CompletedAt,
+		ExpiresAt:   found.ExpiresAt,
+	}
+
+	if found.Status == export.StatusReady {
+		token, err := auth.CreateExportDownloadToken(server.Keys, found.ID, found.UserID, *found.ExpiresAt)
+		if err != nil {
+			return exportResp, err
+		}
+		exportResp.DownloadURL = fmt.Sprintf("/v2/exports/%s/download?token=%s", found.ID, url.QueryEscape(*token))
+	}
+
+	return exportResp, nil
+}
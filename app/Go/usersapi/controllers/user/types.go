@@ -1,5 +1,16 @@
 package user_controller
 
+import (
+	"go-ddd-cqrs-example/domain/models/user"
+	"time"
+)
+
+// Statuses of the user resource.
+const (
+	StatusActive   = "active"
+	StatusInactive = "inactive"
+)
+
 type RegistrationRequest struct {
 	EmailAddress string `json:"email_address"`
 	Password     string `json:"password"`
@@ -10,6 +21,90 @@ type RegistrationSuccessResponse struct {
 	UserID string `json:"user_id"`
 }
 
+// EmailChangeRequest of the current user confirmed with its password.
+type EmailChangeRequest struct {
+	EmailAddress string `json:"email_address"`
+	Password     string `json:"password"`
+}
+
+// EmailChangeVerificationRequest carries the token of the verification or the revert link.
+type EmailChangeVerificationRequest struct {
+	Token string `json:"token"`
+}
+
 type StatusResponse struct {
 	Message string `json:"response"`
 }
+
+// UserResponse is the user resource of the v2 API.
+type UserResponse struct {
+	ID           string    `json:"id"`
+	EmailAddress string    `json:"email_address"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	Version      uint32    `json:"version"`
+	DisplayName  string    `json:"display_name"`
+	Locale       string    `json:"locale"`
+	Timezone     string    `json:"timezone"`
+	AvatarURL    string    `json:"avatar_url"`
+	// EraseAfter is set while the deletion of the user is pending, activating the user cancels it.
+	EraseAfter *time.Time `json:"erase_after,omitempty"`
+}
+
+// DeletionRequest of the current user confirmed with its password.
+type DeletionRequest struct {
+	Password string `json:"password"`
+}
+
+// ExportResponse is the personal data export resource of the v2 API.
+type ExportResponse struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// DownloadURL is relative to the API, it is only set once the export is ready.
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// UpdateUserRequest changes the given fields of the user resource only, an empty string clears a profile field.
+type UpdateUserRequest struct {
+	Status      *string `json:"status"`
+	DisplayName *string `json:"display_name"`
+	Locale      *string `json:"locale"`
+	Timezone    *string `json:"timezone"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+func newUserResponse(view *user.UserView) UserResponse {
+	return UserResponse{
+		ID:           view.ID.String(),
+		EmailAddress: view.EmailAddress,
+		Status:       userStatus(view),
+		CreatedAt:    view.CreatedAt,
+		Version:      view.Version,
+		DisplayName:  view.DisplayName,
+		Locale:       view.Locale,
+		Timezone:     view.Timezone,
+		AvatarURL:    view.AvatarURL,
+		EraseAfter:   eraseAfter(view),
+	}
+}
+
+// eraseAfter the grace period of the pending deletion, nil if there is none.
+func eraseAfter(view *user.UserView) *time.Time {
+	if view.DeletionRequestedAt == nil {
+		return nil
+	}
+
+	at := view.DeletionRequestedAt.Add(user.DeletionGracePeriod)
+	return &at
+}
+
+func userStatus(view *user.UserView) string {
+	if view.IsActive {
+		return StatusActive
+	}
+
+	return StatusInactive
+}
@@ -0,0 +1,88 @@
+// Package erasure erases the users whose deletion grace period is over.
+package erasure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/bus"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"time"
+)
+
+// Eraser defaults.
+const (
+	DefaultInterval = time.Hour
+	DefaultLimit    = user.MaxListLimit
+)
+
+// Eraser of the users due for erasure, the commands and the queries are dispatched as the system actor.
+type Eraser struct {
+	commands *bus.Bus
+	queries  *bus.Bus
+
+	// Interval between the erasures of the due users.
+	Interval time.Duration
+	// Limit of the users erased at once, the rest is left to the next run.
+	Limit int
+	// OnError is called when the due users fail to be erased, they are retried on the next run.
+	OnError func(err error)
+}
+
+// New eraser dispatching through the given buses.
+func New(commands, queries *bus.Bus) *Eraser {
+	return &Eraser{
+		commands: commands,
+		queries:  queries,
+		Interval: DefaultInterval,
+		Limit:    DefaultLimit,
+	}
+}
+
+// EraseDue erases the users whose deletion was requested over user.DeletionGracePeriod before the given time.
+// Every user is erased only at the listed version and while still due, the users changed since they were listed are skipped.
+// The IDs of the users erased so far are returned even when the next one fails.
+func (e *Eraser) EraseDue(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	ctx = bus.WithActor(ctx, bus.SystemActor)
+
+	due := now.Add(-user.DeletionGracePeriod)
+	result, err := e.queries.Dispatch(ctx, user.ListUsers{DeletionRequestedBefore: &due, Limit: e.Limit})
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the users due for erasure: %w", err)
+	}
+
+	erased := []uuid.UUID{}
+	for _, view := range result.([]user.UserView) {
+		version := view.Version
+		_, err := e.commands.Dispatch(ctx, user.EraseUser{UserID: view.ID, Version: &version, Reason: user.ErasureReasonDeletionRequest})
+		// The user erased by another instance, activated or otherwise changed in the meantime is skipped.
+		if errors.As(err, &user.UserNotFound{}) || errors.As(err, &domain_errors.StateConflict{}) {
+			continue
+		} else if err != nil {
+			return erased, fmt.Errorf("Error erasing user %s: %w", view.ID, err)
+		}
+		erased = append(erased, view.ID)
+	}
+
+	return erased, nil
+}
+
+// Run erases the due users every interval until the context is done.
+func (e *Eraser) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := e.EraseDue(ctx, time.Now()); err != nil && ctx.Err() == nil && e.OnError != nil {
+			e.OnError(err)
+		}
+	}
+}
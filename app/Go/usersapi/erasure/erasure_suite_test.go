@@ -0,0 +1,13 @@
+package erasure_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestErasure(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Erasure Suite")
+}
@@ -0,0 +1,112 @@
+package erasure_test
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/usersapi/erasure"
+	"time"
+)
+
+var _ = Describe("Eraser", func() {
+	var (
+		ctx       = context.Background()
+		repo      *memory.UserRepository
+		publisher *memory.Publisher
+		commands  *bus.Bus
+		queries   *bus.Bus
+		eraser    *erasure.Eraser
+	)
+
+	// register a user, its deletion is requested the given time ago if any.
+	register := func(deletedAgo *time.Duration) uuid.UUID {
+		userID := uuid.Must(uuid.NewV4())
+
+		_, err := commands.Dispatch(ctx, user.RegisterUser{ID: userID, EmailAddress: userID.String() + "@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+
+		if deletedAgo != nil {
+			_, err = commands.Dispatch(bus.WithActor(ctx, userID.String()), user.RequestUserDeletion{UserID: userID})
+			Expect(err).To(BeNil())
+
+			stored, err := repo.FindByID(ctx, userID)
+			Expect(err).To(BeNil())
+			requestedAt := time.Now().Add(-*deletedAgo)
+			stored.DeletionRequestedAt = &requestedAt
+			Expect(repo.Update(ctx, *stored, stored.Version)).To(BeNil())
+		}
+
+		return userID
+	}
+
+	erased := func(userID uuid.UUID) bool {
+		_, err := queries.Dispatch(bus.WithActor(ctx, bus.SystemActor), user.GetUserTombstone{UserID: userID})
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		repo = memory.NewUserRepository()
+		publisher = &memory.Publisher{}
+		commands = user.NewCommandBus(memory.NewUnitOfWork(repo, publisher))
+		queries = user.NewQueryBus(repo)
+		eraser = erasure.New(commands, queries)
+	})
+
+	due, recent := user.DeletionGracePeriod+time.Minute, time.Minute
+
+	Specify("only the users past the deletion grace period are erased", func() {
+		dueID, recentID, activeID := register(&due), register(&recent), register(nil)
+
+		ids, err := eraser.EraseDue(ctx, time.Now())
+		Expect(err).To(BeNil())
+		Expect(ids).To(Equal([]uuid.UUID{dueID}))
+		Expect(erased(dueID)).To(BeTrue())
+		Expect(erased(recentID)).To(BeFalse())
+		Expect(erased(activeID)).To(BeFalse())
+
+		ids, err = eraser.EraseDue(ctx, time.Now())
+		Expect(err).To(BeNil())
+		Expect(ids).To(BeEmpty())
+	})
+
+	Specify("the users no longer due once listed are skipped", func() {
+		recentID := register(&recent)
+
+		// The user is listed as due at the later time, while the erasure checks it against the current time.
+		ids, err := eraser.EraseDue(ctx, time.Now().Add(user.DeletionGracePeriod))
+		Expect(err).To(BeNil())
+		Expect(ids).To(BeEmpty())
+		Expect(erased(recentID)).To(BeFalse())
+	})
+
+	Specify("at most the limit of the users is erased at once", func() {
+		register(&due)
+		register(&due)
+		eraser.Limit = 1
+
+		ids, err := eraser.EraseDue(ctx, time.Now())
+		Expect(err).To(BeNil())
+		Expect(ids).To(HaveLen(1))
+	})
+
+	Specify("the due users are erased every interval until the context is done", func() {
+		userID := register(&due)
+		eraser.Interval = time.Millisecond
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			eraser.Run(runCtx)
+		}()
+
+		Eventually(func() bool { return erased(userID) }).Should(BeTrue())
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+})
@@ -0,0 +1,417 @@
+// Package export assembles the personal data held on the users into ZIP archives stored on the local disk.
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofrs/uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of the exports.
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Exporter defaults.
+const (
+	DefaultTTL           = time.Hour * 24
+	DefaultPurgeInterval = time.Minute * 10
+)
+
+// NotFound signifies an export is unknown, expired, not ready or belongs to another user.
+type NotFound struct{}
+
+func (err NotFound) Error() string {
+	return "Export not found"
+}
+
+// Export of the personal data of a user, its archive is stored next to it once ready.
+type Export struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// Section of the archive, the data collected for the user is stored as JSON in the file of the given name.
+type Section struct {
+	Name    string
+	Collect func(ctx context.Context, userID uuid.UUID) (interface{}, error)
+}
+
+// Exporter assembles the archives in background, safe for concurrent use.
+// Every export is stored as <id>.json in the directory along with its <id>.zip archive once ready.
+type Exporter struct {
+	dir      string
+	sections []Section
+	mu       sync.Mutex
+	running  sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// TTL of the exports once completed, the pending ones older than that are considered abandoned.
+	TTL time.Duration
+	// PurgeInterval between the removals of the expired exports.
+	PurgeInterval time.Duration
+	// OnError is called when an archive fails to be assembled or the expired exports fail to be purged.
+	OnError func(err error)
+}
+
+// New exporter storing the archives made of the sections in the directory, the directory is created if missing.
+func New(dir string, sections ...Section) (*Exporter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Error creating export directory: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Exporter{
+		dir:           dir,
+		sections:      sections,
+		ctx:           ctx,
+		cancel:        cancel,
+		TTL:           DefaultTTL,
+		PurgeInterval: DefaultPurgeInterval,
+	}, nil
+}
+
+// Request an export of the user, the pending export of the user is returned if there is one.
+func (e *Exporter) Request(userID uuid.UUID) (*Export, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	exports, err := e.list()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, export := range exports {
+		if export.UserID == userID && export.Status == StatusPending && !e.expired(export, now) {
+			return &export, nil
+		}
+	}
+
+	export := Export{
+		ID:        uuid.Must(uuid.NewV4()),
+		UserID:    userID,
+		Status:    StatusPending,
+		CreatedAt: now,
+	}
+	if err := e.save(export); err != nil {
+		return nil, err
+	}
+
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		e.assemble(export)
+	}()
+
+	return &export, nil
+}
+
+// Find the export of the user.
+func (e *Exporter) Find(userID, id uuid.UUID) (*Export, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.find(userID, id)
+}
+
+// Open the archive of the ready export of the user, the caller has to close it.
+func (e *Exporter) Open(userID, id uuid.UUID) (*os.File, *Export, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	export, err := e.find(userID, id)
+	if err != nil {
+		return nil, nil, err
+	} else if export.Status != StatusReady {
+		return nil, nil, NotFound{}
+	}
+
+	archive, err := os.Open(e.archivePath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, NotFound{}
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("Error opening export archive: %w", err)
+	}
+
+	return archive, export, nil
+}
+
+// RemoveUser exports along with their archives, e.g. once the user is erased.
+// The exports still being assembled are discarded once their archives are complete.
+func (e *Exporter) RemoveUser(userID uuid.UUID) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	exports, err := e.list()
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.UserID == userID {
+			if err := e.remove(export.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Purge the exports expired by the given time, returns the number of the removed exports.
+func (e *Exporter) Purge(now time.Time) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	exports, err := e.list()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, export := range exports {
+		if !e.expired(export, now) {
+			continue
+		}
+		if err := e.remove(export.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Run purges the expired exports until the context is done.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := e.Purge(time.Now()); err != nil && e.OnError != nil {
+			e.OnError(err)
+		}
+	}
+}
+
+// Close stops assembling the archives and waits for the running assemblies until the context is done.
+// The interrupted exports fail.
+func (e *Exporter) Close(ctx context.Context) error {
+	e.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// assemble the archive of the export and store the outcome.
+func (e *Exporter) assemble(export Export) {
+	err := e.write(export)
+
+	now := time.Now()
+	expiresAt := now.Add(e.TTL)
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	export.Status = StatusReady
+	if err != nil {
+		export.Status = StatusFailed
+		if e.OnError != nil {
+			e.OnError(fmt.Errorf("Error assembling export %s: %w", export.ID, err))
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// The export removed in the meantime is not stored again.
+	if _, err := os.Stat(e.metadataPath(export.ID)); errors.Is(err, os.ErrNotExist) {
+		_ = os.Remove(e.archivePath(export.ID))
+		return
+	}
+
+	if err := e.save(export); err != nil && e.OnError != nil {
+		e.OnError(err)
+	}
+}
+
+// write the archive of the sections, it is renamed into place once complete.
+func (e *Exporter) write(export Export) error {
+	tmpPath := e.archivePath(export.ID) + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Error creating export archive: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	archive := zip.NewWriter(file)
+	for _, section := range e.sections {
+		if err := e.ctx.Err(); err != nil {
+			file.Close()
+			return err
+		}
+
+		data, err := section.Collect(e.ctx, export.UserID)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("Error collecting %s: %w", section.Name, err)
+		}
+
+		w, err := archive.Create(section.Name)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			file.Close()
+			return fmt.Errorf("Error encoding %s: %w", section.Name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		file.Close()
+		return fmt.Errorf("Error writing export archive: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Error writing export archive: %w", err)
+	}
+
+	return os.Rename(tmpPath, e.archivePath(export.ID))
+}
+
+// find the export of the user, the caller has to hold the lock.
+func (e *Exporter) find(userID, id uuid.UUID) (*Export, error) {
+	export, err := e.load(e.metadataPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, NotFound{}
+	} else if err != nil {
+		return nil, err
+	} else if export.UserID != userID || e.expired(*export, time.Now()) {
+		return nil, NotFound{}
+	}
+
+	return export, nil
+}
+
+// expired checks whether the export is over its TTL, the pending exports expire once abandoned.
+func (e *Exporter) expired(export Export, now time.Time) bool {
+	if export.ExpiresAt != nil {
+		return !now.Before(*export.ExpiresAt)
+	}
+
+	return !now.Before(export.CreatedAt.Add(e.TTL))
+}
+
+// list the stored exports, the caller has to hold the lock.
+func (e *Exporter) list() ([]Export, error) {
+	entries, err := ioutil.ReadDir(e.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing exports: %w", err)
+	}
+
+	exports := []Export{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		export, err := e.load(filepath.Join(e.dir, entry.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *export)
+	}
+
+	return exports, nil
+}
+
+func (e *Exporter) load(path string) (*Export, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	export := Export{}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("Error decoding export %s: %w", filepath.Base(path), err)
+	}
+
+	return &export, nil
+}
+
+// save the export, it is written to a temporary file renamed into place so that it is never read partially.
+func (e *Exporter) save(export Export) error {
+	data, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := e.metadataPath(export.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("Error storing export: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, e.metadataPath(export.ID)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Error storing export: %w", err)
+	}
+
+	return nil
+}
+
+// remove the export and its archive, the caller has to hold the lock.
+func (e *Exporter) remove(id uuid.UUID) error {
+	for _, path := range []string{e.archivePath(id), e.metadataPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("Error removing export: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (e *Exporter) metadataPath(id uuid.UUID) string {
+	return filepath.Join(e.dir, id.String()+".json")
+}
+
+func (e *Exporter) archivePath(id uuid.UUID) string {
+	return filepath.Join(e.dir, id.String()+".zip")
+}
@@ -0,0 +1,196 @@
+package export_test
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/usersapi/export"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+var _ = Describe("Exporter", func() {
+	var dir string
+	var userID uuid.UUID
+	var release chan struct{}
+	var exporter *export.Exporter
+
+	profile := export.Section{
+		Name: "profile.json",
+		Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return map[string]string{"id": userID.String()}, nil
+		},
+	}
+
+	blocking := func(name string) export.Section {
+		return export.Section{
+			Name: name,
+			Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				return []string{"event"}, nil
+			},
+		}
+	}
+
+	status := func(id uuid.UUID) func() string {
+		return func() string {
+			found, err := exporter.Find(userID, id)
+			if err != nil {
+				return err.Error()
+			}
+			return found.Status
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "exports")
+		Expect(err).ToNot(HaveOccurred())
+
+		userID = uuid.Must(uuid.NewV4())
+		release = make(chan struct{})
+		exporter, err = export.New(dir, profile, blocking("events.json"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(exporter.Close(context.Background())).To(Succeed())
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	Specify("the archive holds a JSON file per section once ready", func() {
+		requested, err := exporter.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requested.Status).To(Equal(export.StatusPending))
+
+		_, _, err = exporter.Open(userID, requested.ID)
+		Expect(err).To(Equal(export.NotFound{}))
+
+		close(release)
+		Eventually(status(requested.ID)).Should(Equal(export.StatusReady))
+
+		file, ready, err := exporter.Open(userID, requested.ID)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+		Expect(ready.CompletedAt).ToNot(BeNil())
+		Expect(*ready.ExpiresAt).To(BeTemporally("~", ready.CompletedAt.Add(export.DefaultTTL)))
+
+		info, err := file.Stat()
+		Expect(err).ToNot(HaveOccurred())
+		archive, err := zip.NewReader(file, info.Size())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(archive.File).To(HaveLen(2))
+		Expect(archive.File[0].Name).To(Equal("profile.json"))
+		Expect(archive.File[1].Name).To(Equal("events.json"))
+
+		content, err := archive.File[0].Open()
+		Expect(err).ToNot(HaveOccurred())
+		defer content.Close()
+		decoded := map[string]string{}
+		Expect(json.NewDecoder(content).Decode(&decoded)).To(Succeed())
+		Expect(decoded).To(Equal(map[string]string{"id": userID.String()}))
+	})
+
+	Specify("the pending export of the user is reused", func() {
+		first, err := exporter.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+		second, err := exporter.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(second.ID).To(Equal(first.ID))
+
+		other, err := exporter.Request(uuid.Must(uuid.NewV4()))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other.ID).ToNot(Equal(first.ID))
+
+		close(release)
+	})
+
+	Specify("the exports of other users are not found", func() {
+		requested, err := exporter.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+		close(release)
+		Eventually(status(requested.ID)).Should(Equal(export.StatusReady))
+
+		samples := []uuid.UUID{uuid.Must(uuid.NewV4()), uuid.Nil}
+		for _, sample := range samples {
+			_, err := exporter.Find(sample, requested.ID)
+			Expect(err).To(Equal(export.NotFound{}))
+			_, _, err = exporter.Open(sample, requested.ID)
+			Expect(err).To(Equal(export.NotFound{}))
+		}
+
+		_, err = exporter.Find(userID, uuid.Must(uuid.NewV4()))
+		Expect(err).To(Equal(export.NotFound{}))
+	})
+
+	Specify("the export fails when a section fails to be collected", func() {
+		reported := make(chan error, 1)
+		failing := export.Section{
+			Name: "failing.json",
+			Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+				return nil, errors.New("unavailable")
+			},
+		}
+		failed, err := export.New(dir, failing)
+		Expect(err).ToNot(HaveOccurred())
+		failed.OnError = func(err error) { reported <- err }
+		defer failed.Close(context.Background())
+
+		requested, err := failed.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(reported).Should(Receive(MatchError(ContainSubstring("unavailable"))))
+		Eventually(func() string {
+			found, err := failed.Find(userID, requested.ID)
+			Expect(err).ToNot(HaveOccurred())
+			return found.Status
+		}).Should(Equal(export.StatusFailed))
+
+		_, _, err = failed.Open(userID, requested.ID)
+		Expect(err).To(Equal(export.NotFound{}))
+		close(release)
+	})
+
+	Specify("the expired exports are purged", func() {
+		requested, err := exporter.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+		close(release)
+		Eventually(status(requested.ID)).Should(Equal(export.StatusReady))
+
+		purged, err := exporter.Purge(time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(purged).To(Equal(0))
+
+		purged, err = exporter.Purge(time.Now().Add(export.DefaultTTL + time.Minute))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(purged).To(Equal(1))
+
+		entries, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	Specify("the exports of a removed user are discarded even while being assembled", func() {
+		requested, err := exporter.Request(userID)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(exporter.RemoveUser(userID)).To(Succeed())
+		_, err = exporter.Find(userID, requested.ID)
+		Expect(err).To(Equal(export.NotFound{}))
+
+		close(release)
+		Expect(exporter.Close(context.Background())).To(Succeed())
+
+		entries, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+})
@@ -0,0 +1,38 @@
+package export
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+)
+
+// ProfileSection of the user as returned by the user queries, collected on behalf of the user.
+func ProfileSection(queries *bus.Bus) Section {
+	return Section{
+		Name: "profile.json",
+		Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUser{UserID: userID})
+		},
+	}
+}
+
+// HistorySection of the recorded versions of the user, collected on behalf of the user.
+func HistorySection(queries *bus.Bus) Section {
+	return Section{
+		Name: "history.json",
+		Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUserHistory{UserID: userID})
+		},
+	}
+}
+
+// LoginHistorySection of the recorded logins of the user, collected on behalf of the user.
+func LoginHistorySection(queries *bus.Bus) Section {
+	return Section{
+		Name: "login_history.json",
+		Collect: func(ctx context.Context, userID uuid.UUID) (interface{}, error) {
+			return queries.Dispatch(bus.WithActor(ctx, userID.String()), user.GetUserLogins{UserID: userID})
+		},
+	}
+}
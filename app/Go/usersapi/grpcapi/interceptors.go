@@ -0,0 +1,225 @@
+package grpcapi
+
+import (
+	"context"
+	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Metadata keys of the request ID and the bearer token.
+var (
+	requestIDKey     = strings.ToLower(logging.RequestIDHeader)
+	authorizationKey = "authorization"
+)
+
+// publicMethods of the Users service callable without a token.
+var publicMethods = map[string]bool{
+	"/users.Users/Register": true,
+	"/users.Users/Login":    true,
+}
+
+// UnaryLogging identifies the call with the incoming x-request-id metadata or a generated ID, echoed back in the header,
+// and logs the call with its status code and latency once handled.
+func UnaryLogging() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, requestID := withRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamLogging is the UnaryLogging of the streaming calls.
+func StreamLogging() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, requestID := withRequestID(stream.Context())
+		_ = stream.SetHeader(metadata.Pairs(requestIDKey, requestID))
+
+		start := time.Now()
+		err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+		logCall(ctx, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+// UnaryMetrics observes the duration and the status code of the calls, it matches the monitoring.Metrics ObserveRPC signature.
+func UnaryMetrics(observe func(method, code string, duration time.Duration)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observe(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+		return resp, err
+	}
+}
+
+// StreamMetrics is the UnaryMetrics of the streaming calls.
+func StreamMetrics(observe func(method, code string, duration time.Duration)) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		observe(info.FullMethod, status.Code(err).String(), time.Since(start))
+
+		return err
+	}
+}
+
+// UnaryRecovery turns the panics of the handlers into internal errors, the observer is called with the method if not nil.
+func UnaryRecovery(observe func(method string)) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recoverPanic(ctx, info.FullMethod, recovered, observe)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecovery is the UnaryRecovery of the streaming calls.
+func StreamRecovery(observe func(method string)) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = recoverPanic(stream.Context(), info.FullMethod, recovered, observe)
+			}
+		}()
+
+		return handler(srv, stream)
+	}
+}
+
+// UnaryAuthentication rejects the calls of the Users service without a valid bearer token in the authorization metadata,
+// except for the public methods, and dispatches the messages on behalf of the user of the token.
+func UnaryAuthentication(srv *server.Server) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, srv, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthentication is the UnaryAuthentication of the streaming calls.
+func StreamAuthentication(srv *server.Server) grpc.StreamServerInterceptor {
+	return func(s interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), srv, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(s, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// contextStream replaces the context of the stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// withRequestID returns the context with the request ID, the request-scoped logger and the correlation ID of the events.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(requestIDKey)) > 0 {
+		requestID = md.Get(requestIDKey)[0]
+	}
+	if !logging.ValidRequestID(requestID) {
+		requestID = logging.NewRequestID()
+	}
+
+	logger := zap.S().With("request_id", requestID)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		logger = logger.With("trace_id", spanContext.TraceID().String())
+	}
+
+	ctx = logging.WithRequestID(ctx, requestID)
+	ctx = logging.WithLogger(ctx, logger)
+	ctx = events.WithCorrelationID(ctx, requestID)
+
+	return ctx, requestID
+}
+
+// logCall handled, the failures on the server side are logged as errors.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []interface{}{
+		"method", method,
+		"code", code.String(),
+		"duration", time.Since(start),
+	}
+
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		logging.FromContext(ctx).Errorw("Call handled", fields...)
+	default:
+		logging.FromContext(ctx).Infow("Call handled", fields...)
+	}
+}
+
+// recoverPanic logs the recovered panic with its stack and returns the internal error.
+func recoverPanic(ctx context.Context, method string, recovered interface{}, observe func(method string)) error {
+	logging.FromContext(ctx).Errorw("Panic recovered",
+		"method", method,
+		"panic", recovered,
+		"stack", string(debug.Stack()),
+	)
+
+	if observe != nil {
+		observe(method)
+	}
+
+	return problemStatus(responses.NewProblem(responses.CodeInternal, "The call could not be handled, retry later or report it with the request ID"))
+}
+
+// authenticate the call of a Users service method, the context carries the user of the token as the actor.
+func authenticate(ctx context.Context, srv *server.Server, method string) (context.Context, error) {
+	if publicMethods[method] || !strings.HasPrefix(method, "/"+Users_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(authorizationKey)) > 0 {
+		token = strings.TrimPrefix(md.Get(authorizationKey)[0], "Bearer ")
+	}
+
+	userID, err := auth.ParseSessionUserID(srv.Keys, token)
+	if err != nil || userID == uuid.Nil {
+		return nil, problemStatus(responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+	}
+
+	logging.With(ctx, "user_id", userID.String())
+
+	return bus.WithActor(ctx, userID.String()), nil
+}
+
+// sessionUserID authenticated by the interceptors.
+func sessionUserID(ctx context.Context) uuid.UUID {
+	return uuid.FromStringOrNil(bus.ActorFromContext(ctx))
+}
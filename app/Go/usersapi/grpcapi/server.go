@@ -0,0 +1,247 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/gofrs/uuid"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchBuffer of the events waiting to be sent to a slow watcher before the publishing is held back.
+const watchBuffer = 16
+
+// Server implements the Users service over the same buses and sign in as the HTTP API.
+type Server struct {
+	UnimplementedUsersServer
+
+	server *server.Server
+}
+
+// NewServer of the gRPC API serving the Users service with the logging, metrics, recovery and authentication interceptors,
+// the reflection service is registered if enabled.
+func NewServer(srv *server.Server, enableReflection bool, options ...grpc.ServerOption) *grpc.Server {
+	grpcServer := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			UnaryLogging(),
+			UnaryMetrics(srv.Metrics.ObserveRPC),
+			UnaryRecovery(srv.Metrics.ObserveRPCPanic),
+			UnaryAuthentication(srv),
+		),
+		grpc.ChainStreamInterceptor(
+			StreamLogging(),
+			StreamMetrics(srv.Metrics.ObserveRPC),
+			StreamRecovery(srv.Metrics.ObserveRPCPanic),
+			StreamAuthentication(srv),
+		),
+	}, options...)...)
+
+	RegisterUsersServer(grpcServer, &Server{server: srv})
+	if enableReflection {
+		reflection.Register(grpcServer)
+	}
+
+	return grpcServer
+}
+
+// Register a new active user and start its session.
+func (s *Server) Register(ctx context.Context, in *Credentials) (*Session, error) {
+	result, err := s.server.Commands.Dispatch(ctx, user.RegisterUser{
+		ID:           uuid.Must(uuid.NewV4()),
+		EmailAddress: in.EmailAddress,
+		Password:     in.Password,
+	})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	userID := uuid.FromStringOrNil(result.(*user.UserCreated).UserID)
+
+	token, err := auth.CreateJWTToken(s.server.Keys.Current(), userID)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &Session{Token: *token, UserId: userID.String()}, nil
+}
+
+// Login with the email address and the password.
+func (s *Server) Login(ctx context.Context, in *Credentials) (*Session, error) {
+	err := validation.Errors{
+		"email_address": validation.Validate(in.EmailAddress, validation.Required, is.Email),
+		"password":      validation.Validate(in.Password, validation.Required, validation.Length(6, 20)),
+	}.Filter()
+	if err != nil {
+		s.server.Metrics.ObserveLogin(auth.LoginMethodPassword, auth.LoginReasonInvalidRequest)
+		return nil, statusError(ctx, err)
+	}
+
+	token, userID, err := auth.SignIn(ctx, s.server, in.EmailAddress, in.Password)
+	s.server.Metrics.ObserveLogin(auth.LoginMethodPassword, auth.LoginFailureReason(err))
+	if err != nil {
+		// Unknown email addresses and wrong passwords are not told apart to not disclose which accounts exist.
+		if errors.As(err, &user.UserNotFound{}) || errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return nil, problemStatus(responses.NewProblem(responses.CodeInvalidCredentials, "Incorrect details"))
+		}
+		return nil, statusError(ctx, err)
+	}
+
+	return &Session{Token: *token, UserId: *userID}, nil
+}
+
+// GetUser by ID, the user of the session if the ID is empty.
+func (s *Server) GetUser(ctx context.Context, in *GetUserRequest) (*User, error) {
+	userID := sessionUserID(ctx)
+	if in.UserId != "" {
+		var err error
+		if userID, err = uuid.FromString(in.UserId); err != nil {
+			return nil, statusError(ctx, validation.Errors{"user_id": errors.New("must be a valid UUID")})
+		}
+	}
+
+	result, err := s.server.Queries.Dispatch(ctx, user.GetUser{UserID: userID})
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	view := result.(*user.UserView)
+
+	return &User{
+		Id:           view.ID.String(),
+		EmailAddress: view.EmailAddress,
+		IsActive:     view.IsActive,
+		CreatedAt:    timestamppb.New(view.CreatedAt),
+		Version:      view.Version,
+		DisplayName:  view.DisplayName,
+		Locale:       view.Locale,
+		Timezone:     view.Timezone,
+		AvatarUrl:    view.AvatarURL,
+	}, nil
+}
+
+// Activate the user of the session.
+func (s *Server) Activate(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	if _, err := s.server.Commands.Dispatch(ctx, user.ActivateUser{UserID: sessionUserID(ctx)}); err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Deactivate the user of the session.
+func (s *Server) Deactivate(ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	if _, err := s.server.Commands.Dispatch(ctx, user.DeactivateUser{UserID: sessionUserID(ctx)}); err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// WatchUserEvents streams the events of the user of the session published from now on.
+// The response header is sent once the subscription is in place, so the events raised after it are not missed.
+func (s *Server) WatchUserEvents(in *WatchUserEventsRequest, stream Users_WatchUserEventsServer) error {
+	ctx := stream.Context()
+
+	topics := in.Topics
+	if len(topics) == 0 {
+		topics = user.Topics()
+	}
+
+	known := map[string]bool{}
+	for _, topic := range user.Topics() {
+		known[topic] = true
+	}
+	for _, topic := range topics {
+		if !known[topic] {
+			return statusError(ctx, validation.Errors{"topics": errors.New("must be user event topics")})
+		}
+	}
+
+	if s.server.Subscriber == nil {
+		return problemStatus(responses.NewProblem(responses.CodeUpstreamFailed, "The events cannot be watched"))
+	}
+
+	userID := sessionUserID(ctx).String()
+	received := make(chan *UserEvent, watchBuffer)
+
+	unsubscribe, err := s.server.Subscriber.Subscribe(topics, func(topic string, body []byte) {
+		event, err := decodeEvent(topic, body)
+		if err != nil {
+			logging.FromContext(ctx).Warnw("Error decoding event", "topic", topic, "error", err)
+			return
+		}
+
+		if event.UserId != userID {
+			return
+		}
+
+		select {
+		case received <- event:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		logging.FromContext(ctx).Errorw("Error subscribing to the user events", "error", err)
+		return problemStatus(responses.NewProblem(responses.CodeUpstreamFailed, "The events cannot be watched"))
+	}
+	defer unsubscribe()
+
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-received:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decodeEvent from the envelope of the published user event.
+func decodeEvent(topic string, body []byte) (*UserEvent, error) {
+	envelope := events.Envelope{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+
+	payload := struct {
+		UserID          string
+		EmailAddress    string
+		NewEmailAddress string
+		Version         uint32
+	}{}
+	if err := json.Unmarshal(envelope.Event, &payload); err != nil {
+		return nil, err
+	}
+
+	// The email changes carry the new email address of the user.
+	if payload.EmailAddress == "" {
+		payload.EmailAddress = payload.NewEmailAddress
+	}
+
+	return &UserEvent{
+		Topic:         topic,
+		UserId:        payload.UserID,
+		EmailAddress:  payload.EmailAddress,
+		Version:       payload.Version,
+		CorrelationId: envelope.CorrelationID,
+	}, nil
+}
@@ -0,0 +1,275 @@
+package grpcapi_test
+
+import (
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gofrs/uuid"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/usersapi/grpcapi"
+	"go-ddd-cqrs-example/usersapi/monitoring"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/server"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"net"
+	"time"
+)
+
+// errorReason of the error info details of the status error.
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+
+	return ""
+}
+
+// fieldViolations of the bad request details of the status error.
+func fieldViolations(err error) []string {
+	var fields []string
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.FieldViolations {
+				fields = append(fields, violation.Field)
+			}
+		}
+	}
+
+	return fields
+}
+
+var _ = Describe("gRPC API", func() {
+	var (
+		ctx        context.Context
+		cancel     context.CancelFunc
+		grpcServer *grpc.Server
+		conn       *grpc.ClientConn
+		client     grpcapi.UsersClient
+	)
+
+	// authenticated context of the session.
+	authenticated := func(session *grpcapi.Session) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+session.Token)
+	}
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+
+		repo := memory.NewUserRepository()
+		publisher := &memory.Publisher{}
+		srv := &server.Server{
+			Users:      repo,
+			UnitOfWork: memory.NewUnitOfWork(repo, publisher),
+			Subscriber: publisher,
+			Keys:       server.NewSigningKeys("secret"),
+			Metrics:    monitoring.New(),
+		}
+		srv.Commands = user.NewCommandBus(srv.UnitOfWork)
+		srv.Queries = user.NewQueryBus(srv.Users)
+
+		listener := bufconn.Listen(1 << 20)
+		grpcServer = grpcapi.NewServer(srv, false)
+		go grpcServer.Serve(listener)
+
+		var err error
+		conn, err = grpc.DialContext(ctx, "bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).To(BeNil())
+		client = grpcapi.NewUsersClient(conn)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		grpcServer.Stop()
+		cancel()
+	})
+
+	Specify("the users register, log in, get their account and deactivate and activate it", func() {
+		registered, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+		Expect(registered.Token).NotTo(BeEmpty())
+
+		session, err := client.Login(ctx, &grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+		Expect(session.UserId).To(Equal(registered.UserId))
+
+		_, err = client.Deactivate(authenticated(session), &emptypb.Empty{})
+		Expect(err).To(BeNil())
+
+		account, err := client.GetUser(authenticated(session), &grpcapi.GetUserRequest{})
+		Expect(err).To(BeNil())
+		Expect(account.Id).To(Equal(session.UserId))
+		Expect(account.EmailAddress).To(Equal("user@example.com"))
+		Expect(account.IsActive).To(BeFalse())
+		Expect(account.CreatedAt.AsTime()).NotTo(BeZero())
+
+		_, err = client.Activate(authenticated(session), &emptypb.Empty{})
+		Expect(err).To(BeNil())
+
+		_, err = client.Activate(authenticated(session), &emptypb.Empty{})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		Expect(errorReason(err)).To(Equal(responses.CodeUserActive))
+	})
+
+	Specify("the errors carry the problem codes of the HTTP API", func() {
+		samples := []struct {
+			call   func() error
+			code   codes.Code
+			reason string
+			fields []string
+		}{
+			{
+				call: func() error {
+					_, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "not an email address", Password: "password"})
+					return err
+				},
+				code:   codes.InvalidArgument,
+				reason: responses.CodeValidationFailed,
+				fields: []string{"email_address"},
+			},
+			{
+				call: func() error {
+					_, err := client.Login(ctx, &grpcapi.Credentials{EmailAddress: "unknown@example.com", Password: "password"})
+					return err
+				},
+				code:   codes.Unauthenticated,
+				reason: responses.CodeInvalidCredentials,
+			},
+			{
+				call: func() error {
+					_, err := client.GetUser(ctx, &grpcapi.GetUserRequest{})
+					return err
+				},
+				code:   codes.Unauthenticated,
+				reason: responses.CodeUnauthorized,
+			},
+			{
+				call: func() error {
+					_, err := client.Deactivate(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer invalid"), &emptypb.Empty{})
+					return err
+				},
+				code:   codes.Unauthenticated,
+				reason: responses.CodeUnauthorized,
+			},
+		}
+
+		for _, sample := range samples {
+			err := sample.call()
+			Expect(status.Code(err)).To(Equal(sample.code), "%v", err)
+			Expect(errorReason(err)).To(Equal(sample.reason))
+			Expect(fieldViolations(err)).To(Equal(sample.fields))
+		}
+	})
+
+	Specify("the users cannot get the accounts of the other users", func() {
+		session, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+		other, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "other@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+
+		_, err = client.GetUser(authenticated(session), &grpcapi.GetUserRequest{UserId: other.UserId})
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	Specify("only the session tokens are accepted as bearer tokens", func() {
+		session, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+
+		expiresAt := time.Now().Add(time.Hour).Unix()
+		samples := []jwt.MapClaims{
+			// Magic link sent by email.
+			{"jti": uuid.Must(uuid.NewV4()).String(), "user_id": session.UserId, "purpose": "magic_link", "exp": expiresAt},
+			{"authorized": true, "user_id": session.UserId, "purpose": "magic_link", "exp": expiresAt},
+			{"user_id": session.UserId, "exp": expiresAt},
+		}
+
+		for _, claims := range samples {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+			Expect(err).To(BeNil())
+
+			_, err = client.GetUser(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), &grpcapi.GetUserRequest{})
+			Expect(status.Code(err)).To(Equal(codes.Unauthenticated), "%v", claims)
+			Expect(errorReason(err)).To(Equal(responses.CodeUnauthorized))
+		}
+	})
+
+	Specify("the request ID of the call is echoed back", func() {
+		var header metadata.MD
+		_, err := client.Register(metadata.AppendToOutgoingContext(ctx, "x-request-id", "request-1"),
+			&grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"},
+			grpc.Header(&header),
+		)
+		Expect(err).To(BeNil())
+		Expect(header.Get("x-request-id")).To(Equal([]string{"request-1"}))
+	})
+
+	Specify("the users watch their own events", func() {
+		session, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+		other, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "other@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+
+		stream, err := client.WatchUserEvents(authenticated(session), &grpcapi.WatchUserEventsRequest{})
+		Expect(err).To(BeNil())
+		// The header is sent once the subscription is in place.
+		_, err = stream.Header()
+		Expect(err).To(BeNil())
+
+		_, err = client.Deactivate(authenticated(other), &emptypb.Empty{})
+		Expect(err).To(BeNil())
+		_, err = client.Deactivate(metadata.AppendToOutgoingContext(authenticated(session), "x-request-id", "request-1"), &emptypb.Empty{})
+		Expect(err).To(BeNil())
+
+		event, err := stream.Recv()
+		Expect(err).To(BeNil())
+		Expect(event.Topic).To(Equal("deactivated_user"))
+		Expect(event.UserId).To(Equal(session.UserId))
+		Expect(event.Version).To(Equal(uint32(2)))
+		Expect(event.CorrelationId).To(Equal("request-1"))
+	})
+
+	Specify("only the user event topics can be watched", func() {
+		session, err := client.Register(ctx, &grpcapi.Credentials{EmailAddress: "user@example.com", Password: "password"})
+		Expect(err).To(BeNil())
+
+		stream, err := client.WatchUserEvents(authenticated(session), &grpcapi.WatchUserEventsRequest{Topics: []string{"unknown"}})
+		Expect(err).To(BeNil())
+
+		_, err = stream.Recv()
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(fieldViolations(err)).To(Equal([]string{"topics"}))
+	})
+})
+
+var _ = Describe("gRPC interceptors", func() {
+	Specify("the panics of the handlers are recovered into internal errors", func() {
+		var observed []string
+		interceptor := grpcapi.UnaryRecovery(func(method string) {
+			observed = append(observed, method)
+		})
+
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/users.Users/Login"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic("handler failed")
+			},
+		)
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		Expect(errorReason(err)).To(Equal(responses.CodeInternal))
+		Expect(observed).To(Equal([]string{"/users.Users/Login"}))
+	})
+})
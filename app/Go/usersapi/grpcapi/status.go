@@ -0,0 +1,87 @@
+package grpcapi
+
+import (
+	"context"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// ErrorDomain of the error info details, their reason is the stable problem code, e.g. user_inactive.
+const ErrorDomain = "usersapi"
+
+// problemCodes are the status codes of the problem codes shared with the HTTP API.
+var problemCodes = map[string]codes.Code{
+	responses.CodeMalformedRequest:       codes.InvalidArgument,
+	responses.CodeValidationFailed:       codes.InvalidArgument,
+	responses.CodeUnauthorized:           codes.Unauthenticated,
+	responses.CodeInvalidCredentials:     codes.Unauthenticated,
+	responses.CodeInvalidLoginLink:       codes.Unauthenticated,
+	responses.CodeInvalidEmailChangeLink: codes.InvalidArgument,
+	responses.CodeInvalidDownloadLink:    codes.InvalidArgument,
+	responses.CodeForbidden:              codes.PermissionDenied,
+	responses.CodeUserNotFound:           codes.NotFound,
+	responses.CodeUserAlreadyExists:      codes.AlreadyExists,
+	responses.CodeExportNotFound:         codes.NotFound,
+	responses.CodeUserActive:             codes.FailedPrecondition,
+	responses.CodeUserInactive:           codes.FailedPrecondition,
+	responses.CodeStateConflict:          codes.FailedPrecondition,
+	responses.CodeVersionConflict:        codes.Aborted,
+	responses.CodePreconditionFailed:     codes.FailedPrecondition,
+	responses.CodeRateLimited:            codes.ResourceExhausted,
+	responses.CodeTimeout:                codes.DeadlineExceeded,
+	responses.CodeCanceled:               codes.Canceled,
+	responses.CodeUpstreamFailed:         codes.Unavailable,
+	responses.CodeInternal:               codes.Internal,
+}
+
+// statusError of the error mapped the same way as the HTTP problems, the server side failures are logged.
+func statusError(ctx context.Context, err error) error {
+	problem := responses.ProblemFromError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logging.FromContext(ctx).Errorw("Error handling call", "error", err)
+	}
+
+	return problemStatus(problem)
+}
+
+// problemStatus carries the problem code in the error info details and the field errors in the bad request details.
+func problemStatus(problem responses.Problem) error {
+	code, ok := problemCodes[problem.Code]
+	if !ok {
+		code = codes.Internal
+	}
+
+	message := problem.Detail
+	if message == "" {
+		message = problem.Title
+	}
+
+	st := status.New(code, message)
+
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{Reason: problem.Code, Domain: ErrorDomain})
+	if err != nil {
+		return st.Err()
+	}
+
+	if len(problem.Errors) == 0 {
+		return withDetails.Err()
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, fieldErr := range problem.Errors {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldErr.Field,
+			Description: fieldErr.Message,
+		})
+	}
+
+	if withFields, err := withDetails.WithDetails(badRequest); err == nil {
+		return withFields.Err()
+	}
+
+	return withDetails.Err()
+}
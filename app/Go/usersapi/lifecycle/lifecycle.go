@@ -0,0 +1,135 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultStopTimeout of the components when the manager has no timeout set.
+const DefaultStopTimeout = 15 * time.Second
+
+// Component of the service started and stopped by the Manager.
+type Component struct {
+	Name string
+	// Start the component, it returns once the component is ready to be used by the next ones.
+	Start func(ctx context.Context) error
+	// Run the component in the background until it is stopped, optional.
+	// An error returned by Run shuts the service down.
+	Run func() error
+	// Stop the component within the context deadline, optional.
+	Stop func(ctx context.Context) error
+}
+
+// ComponentError of the component failed to start, run or stop.
+type ComponentError struct {
+	Name  string
+	Stage string
+	Err   error
+}
+
+func (err ComponentError) Error() string {
+	return fmt.Sprintf("Error %s %s: %v", err.Stage, err.Name, err.Err)
+}
+
+func (err ComponentError) Unwrap() error {
+	return err.Err
+}
+
+// Manager starts the components in order and stops them in reverse order,
+// so that every component is stopped before the ones it depends on.
+type Manager struct {
+	components []Component
+
+	// StopTimeout of all the components together, the remaining components are stopped with an expired context.
+	StopTimeout time.Duration
+	// OnStop is called when a component is stopped, err is nil if it stopped cleanly.
+	OnStop func(name string, err error)
+}
+
+// Add the component started after the components added before.
+func (m *Manager) Add(component Component) {
+	m.components = append(m.components, component)
+}
+
+// Run starts the components and blocks until the context is done or a component fails, then stops the started components.
+// The first error is returned, either the failure of a component or the error of a component failed to stop.
+func (m *Manager) Run(ctx context.Context) error {
+	var (
+		started []Component
+		failure error
+		failed  = make(chan error, len(m.components))
+		running sync.WaitGroup
+	)
+
+	for _, component := range m.components {
+		if component.Start != nil {
+			if err := component.Start(ctx); err != nil {
+				failure = ComponentError{Name: component.Name, Stage: "starting", Err: err}
+				break
+			}
+		}
+
+		started = append(started, component)
+
+		if component.Run != nil {
+			running.Add(1)
+			go func(component Component) {
+				defer running.Done()
+
+				if err := component.Run(); err != nil {
+					failed <- ComponentError{Name: component.Name, Stage: "running", Err: err}
+				}
+			}(component)
+		}
+	}
+
+	if failure == nil {
+		select {
+		case <-ctx.Done():
+		case failure = <-failed:
+		}
+	}
+
+	if err := m.stop(started); err != nil && failure == nil {
+		failure = err
+	}
+
+	running.Wait()
+
+	return failure
+}
+
+// stop the components in reverse order within the stop timeout.
+func (m *Manager) stop(components []Component) error {
+	timeout := m.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var first error
+	for i := len(components) - 1; i >= 0; i-- {
+		component := components[i]
+		if component.Stop == nil {
+			continue
+		}
+
+		var err error
+		if stopErr := component.Stop(ctx); stopErr != nil {
+			err = ComponentError{Name: component.Name, Stage: "stopping", Err: stopErr}
+			if first == nil {
+				first = err
+			}
+		}
+
+		if m.OnStop != nil {
+			m.OnStop(component.Name, err)
+		}
+	}
+
+	return first
+}
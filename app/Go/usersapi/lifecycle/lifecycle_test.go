@@ -0,0 +1,130 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/usersapi/lifecycle"
+	"sync"
+	"time"
+)
+
+var _ = Describe("Lifecycle manager", func() {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls = append(calls, call)
+	}
+
+	component := func(name string) lifecycle.Component {
+		return lifecycle.Component{
+			Name: name,
+			Start: func(ctx context.Context) error {
+				record("start " + name)
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				record("stop " + name)
+				return nil
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		calls = nil
+	})
+
+	Specify("the components are stopped in reverse order once the context is done", func() {
+		manager := lifecycle.Manager{}
+		manager.Add(component("database"))
+		manager.Add(component("publisher"))
+		manager.Add(component("http"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		Expect(manager.Run(ctx)).To(BeNil())
+		Expect(calls).To(Equal([]string{
+			"start database", "start publisher", "start http",
+			"stop http", "stop publisher", "stop database",
+		}))
+	})
+
+	Specify("only the started components are stopped when a component fails to start", func() {
+		manager := lifecycle.Manager{}
+		manager.Add(component("database"))
+		manager.Add(lifecycle.Component{
+			Name:  "publisher",
+			Start: func(ctx context.Context) error { return errors.New("unreachable") },
+			Stop: func(ctx context.Context) error {
+				record("stop publisher")
+				return nil
+			},
+		})
+		manager.Add(component("http"))
+
+		err := manager.Run(context.Background())
+
+		Expect(err).To(MatchError("Error starting publisher: unreachable"))
+		Expect(calls).To(Equal([]string{"start database", "stop database"}))
+	})
+
+	Specify("a failed running component shuts the service down", func() {
+		stopped := make(chan struct{})
+
+		manager := lifecycle.Manager{}
+		manager.Add(component("database"))
+		manager.Add(lifecycle.Component{
+			Name: "http",
+			Run: func() error {
+				return errors.New("address in use")
+			},
+			Stop: func(ctx context.Context) error {
+				close(stopped)
+				return nil
+			},
+		})
+
+		err := manager.Run(context.Background())
+
+		Expect(errors.As(err, &lifecycle.ComponentError{})).To(BeTrue())
+		Expect(err).To(MatchError("Error running http: address in use"))
+		Expect(stopped).To(BeClosed())
+		Expect(calls).To(Equal([]string{"start database", "stop database"}))
+	})
+
+	Specify("the components share the stop timeout", func() {
+		var deadline time.Time
+
+		manager := lifecycle.Manager{StopTimeout: 50 * time.Millisecond}
+		manager.Add(lifecycle.Component{
+			Name: "database",
+			Stop: func(ctx context.Context) error {
+				deadline, _ = ctx.Deadline()
+				return nil
+			},
+		})
+		manager.Add(lifecycle.Component{
+			Name: "http",
+			Stop: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := manager.Run(ctx)
+
+		Expect(err).To(MatchError("Error stopping http: context deadline exceeded"))
+		Expect(deadline).To(BeTemporally("<=", time.Now()))
+	})
+})
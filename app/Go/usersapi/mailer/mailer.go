@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Sender interface to deliver emails, allows to plug in a real mail service or a fake one for test purposes.
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// LogSender writes emails to the log instead of delivering them, meant for local development only
+// as the bodies carry the login and email change links.
+type LogSender struct{}
+
+// Send logs the email details.
+func (s LogSender) Send(to, subject, body string) error {
+	zap.S().Infow("Sending email",
+		"to", to,
+		"subject", subject,
+		"body", body,
+	)
+
+	return nil
+}
+
+// SMTPSender delivers emails through an SMTP server, authenticated with the username and password if any.
+// The connection is upgraded with STARTTLS whenever the server supports it.
+type SMTPSender struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+}
+
+// Send the plain text email.
+func (s SMTPSender) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Address)
+		if err != nil {
+			return fmt.Errorf("Error sending email: %w", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(s.Address, auth, s.From, []string{to}, []byte(message)); err != nil {
+		return fmt.Errorf("Error sending email: %w", err)
+	}
+
+	return nil
+}
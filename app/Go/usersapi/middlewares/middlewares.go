@@ -1,20 +1,35 @@
 package middlewares
 
 import (
-	"errors"
+	"context"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/platform/metrics"
 	"go-ddd-cqrs-example/usersapi/auth"
+	"go-ddd-cqrs-example/usersapi/ratelimit"
 	"go-ddd-cqrs-example/usersapi/responses"
 	"go-ddd-cqrs-example/usersapi/server"
-	"log"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
 )
 
+// quietRoutes are polled by the orchestrator and the metrics scraper, their access logs are at the debug level.
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
 // SetMiddlewareJSON sets server response type to json.
 func SetMiddlewareJSON(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,access-control-allow-origin, access-control-allow-headers")
 		next(w, r)
 	}
 }
@@ -22,18 +37,182 @@ func SetMiddlewareJSON(next http.HandlerFunc) http.HandlerFunc {
 // SetMiddlewareAuthentication sets auth for the server.
 func SetMiddlewareAuthentication(server server.Server, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-
 		valid, err := auth.CheckJWTTokenValidity(server, r)
-		if valid == false {
-			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		if valid == false || err != nil {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeUnauthorized, "The token is missing or invalid"))
+			return
+		}
+
+		if userID, err := auth.ExtractUserID(server, r); err == nil {
+			logging.With(r.Context(), "user_id", userID.String())
+		}
+
+		next(w, r)
+	}
+}
+
+// SetMiddlewareTimeout sets the deadline for the request context, zero timeout means no deadline.
+func SetMiddlewareTimeout(timeout time.Duration, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if timeout <= 0 {
+			next(w, r)
 			return
 		}
 
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// SetMiddlewareRateLimit rejects the requests over the limit of the client address, nil limiter allows every request.
+func SetMiddlewareRateLimit(limiter *ratelimit.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
 		if err != nil {
-			log.Panic(err)
+			client = r.RemoteAddr
+		}
+
+		if !limiter.Allow(client) {
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeRateLimited, "Too many requests, retry later"))
+			return
 		}
 
 		next(w, r)
 	}
 }
+
+// SetMiddlewareDeprecation marks the responses of a deprecated route with the Deprecation (RFC 9745) and Sunset (RFC 8594)
+// headers and links the route superseding it.
+func SetMiddlewareDeprecation(deprecation, sunset time.Time, successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecation.Unix(), 10))
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+
+		next(w, r)
+	}
+}
+
+// SetMiddlewareRequestID identifies the request with the incoming X-Request-ID header or a generated ID.
+// The ID is echoed back, added to the request-scoped logger and attached to the events published by the request.
+func SetMiddlewareRequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, requestID)
+
+		logger := zap.S().With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			logger = logger.With("trace_id", spanContext.TraceID().String())
+		}
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = logging.WithLogger(ctx, logger)
+		ctx = events.WithCorrelationID(ctx, requestID)
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// SetMiddlewareLogging writes the access log of every request with its status, size and latency.
+func SetMiddlewareLogging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(recorder, r)
+
+		route := metrics.MuxRoute(r)
+		log := logging.FromContext(r.Context()).Infow
+		if quietRoutes[route] {
+			log = logging.FromContext(r.Context()).Debugw
+		}
+
+		log("Request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration", time.Since(start),
+		)
+	}
+}
+
+// SetMiddlewareRecovery converts the panics of the handlers into 500 responses, logging their stack with the request fields.
+// The observer is notified with the route of the recovered panics, e.g. to count them.
+func SetMiddlewareRecovery(observe func(route string), next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			// The server aborts the response on purpose with this panic, it must reach the server.
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			route := metrics.MuxRoute(r)
+			logging.FromContext(r.Context()).Errorw("Panic recovered",
+				"route", route,
+				"panic", recovered,
+				"stack", string(debug.Stack()),
+			)
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetStatus(codes.Error, "Panic recovered")
+
+			if observe != nil {
+				observe(route)
+			}
+
+			// Too late to replace the response once the handler has started writing it.
+			if recorder.wroteHeader {
+				return
+			}
+
+			responses.PROBLEM(recorder, r, responses.NewProblem(responses.CodeInternal, "The request could not be handled, retry later or report it with the request ID"))
+		}()
+
+		next(recorder, r)
+	}
+}
+
+// statusRecorder captures the status and the size of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
@@ -0,0 +1,193 @@
+package middlewares_test
+
+import (
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/middlewares"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Request logging", func() {
+	var (
+		router     *mux.Router
+		logs       *observer.ObservedLogs
+		restoreLog func()
+		handled    *http.Request
+	)
+
+	BeforeEach(func() {
+		var core zapcore.Core
+		core, logs = observer.New(zap.DebugLevel)
+		restoreLog = zap.ReplaceGlobals(zap.New(core))
+
+		router = mux.NewRouter()
+		router.Use(func(next http.Handler) http.Handler {
+			return middlewares.SetMiddlewareRequestID(next.ServeHTTP)
+		})
+		router.Use(func(next http.Handler) http.Handler {
+			return middlewares.SetMiddlewareLogging(next.ServeHTTP)
+		})
+		router.HandleFunc("/api/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			handled = r
+			logging.With(r.Context(), "user_id", "user-1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		})
+	})
+
+	AfterEach(func() {
+		restoreLog()
+	})
+
+	serve := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/users/1", nil)
+		if requestID != "" {
+			req.Header.Set(logging.RequestIDHeader, requestID)
+		}
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		return res
+	}
+
+	Specify("the incoming request ID is honored", func() {
+		res := serve("request-1")
+
+		Expect(res.Header().Get(logging.RequestIDHeader)).To(Equal("request-1"))
+		Expect(logging.RequestIDFromContext(handled.Context())).To(Equal("request-1"))
+		Expect(events.CorrelationIDFromContext(handled.Context())).To(Equal("request-1"))
+	})
+
+	Specify("the request ID is generated when missing or invalid", func() {
+		res := serve("request 1")
+
+		requestID := res.Header().Get(logging.RequestIDHeader)
+		Expect(requestID).NotTo(Equal("request 1"))
+		Expect(logging.ValidRequestID(requestID)).To(BeTrue())
+		Expect(logging.RequestIDFromContext(handled.Context())).To(Equal(requestID))
+	})
+
+	Specify("the access log carries the route, the outcome and the request fields", func() {
+		serve("request-1")
+
+		Expect(logs.FilterMessage("Request handled").All()).To(HaveLen(1))
+		fields := logs.FilterMessage("Request handled").All()[0].ContextMap()
+		Expect(fields).To(HaveKeyWithValue("request_id", "request-1"))
+		Expect(fields).To(HaveKeyWithValue("user_id", "user-1"))
+		Expect(fields).To(HaveKeyWithValue("method", "GET"))
+		Expect(fields).To(HaveKeyWithValue("path", "/api/users/1"))
+		Expect(fields).To(HaveKeyWithValue("route", "/api/users/{id}"))
+		Expect(fields).To(HaveKeyWithValue("status", int64(http.StatusCreated)))
+		Expect(fields).To(HaveKeyWithValue("bytes", int64(len("created"))))
+		Expect(fields).To(HaveKey("duration"))
+	})
+})
+
+var _ = Describe("Panic recovery", func() {
+	var (
+		router    *mux.Router
+		logs      *observer.ObservedLogs
+		restore   func()
+		recovered []string
+	)
+
+	BeforeEach(func() {
+		var core zapcore.Core
+		core, logs = observer.New(zap.DebugLevel)
+		restore = zap.ReplaceGlobals(zap.New(core))
+		recovered = nil
+
+		router = mux.NewRouter()
+		router.Use(func(next http.Handler) http.Handler {
+			return middlewares.SetMiddlewareRequestID(next.ServeHTTP)
+		})
+		router.Use(func(next http.Handler) http.Handler {
+			return middlewares.SetMiddlewareRecovery(func(route string) { recovered = append(recovered, route) }, next.ServeHTTP)
+		})
+		router.HandleFunc("/api/panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("handler failed")
+		})
+		router.HandleFunc("/api/panic/written", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("handler failed")
+		})
+	})
+
+	AfterEach(func() {
+		restore()
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(logging.RequestIDHeader, "request-1")
+
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		return res
+	}
+
+	Specify("the panic is converted into a 500 problem response", func() {
+		res := serve("/api/panic")
+
+		Expect(res.Code).To(Equal(http.StatusInternalServerError))
+		Expect(res.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+		Expect(res.Body.String()).To(ContainSubstring(`"status":500`))
+		Expect(res.Body.String()).NotTo(ContainSubstring("handler failed"))
+	})
+
+	Specify("the panic is logged with its stack and the request ID, and observed", func() {
+		serve("/api/panic")
+
+		entries := logs.FilterMessage("Panic recovered").All()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].ContextMap()).To(HaveKeyWithValue("request_id", "request-1"))
+		Expect(entries[0].ContextMap()).To(HaveKeyWithValue("panic", "handler failed"))
+		Expect(entries[0].ContextMap()["stack"]).To(ContainSubstring("middlewares_test"))
+		Expect(recovered).To(Equal([]string{"/api/panic"}))
+	})
+
+	Specify("the response already started is kept", func() {
+		res := serve("/api/panic/written")
+
+		Expect(res.Code).To(Equal(http.StatusAccepted))
+		Expect(res.Body.String()).To(BeEmpty())
+		Expect(recovered).To(HaveLen(1))
+	})
+
+	Specify("the aborted responses are left to the server", func() {
+		router.HandleFunc("/api/abort", func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+
+		Expect(func() { serve("/api/abort") }).To(PanicWith(http.ErrAbortHandler))
+		Expect(recovered).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Deprecation", func() {
+	Specify("the responses of the deprecated routes carry the deprecation and sunset dates and the successor", func() {
+		deprecation := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+		sunset := time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+		handler := middlewares.SetMiddlewareDeprecation(deprecation, sunset, "/v1/login", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		res := httptest.NewRecorder()
+		handler(res, httptest.NewRequest("POST", "/api/login", nil))
+
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Deprecation")).To(Equal("@1790812800"))
+		Expect(res.Header().Get("Sunset")).To(Equal("Thu, 01 Apr 2027 00:00:00 GMT"))
+		Expect(res.Header().Get("Link")).To(Equal(`</v1/login>; rel="successor-version"`))
+	})
+})
@@ -0,0 +1,390 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock held by the migration runner.
+const lockKey = 7301450417
+
+//go:embed sql/*.sql
+var files embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change with its rollback.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status of a migration in the database.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// SchemaBehind signifies the database schema is older than the one the binary expects.
+type SchemaBehind struct {
+	Current int
+	Latest  int
+}
+
+func (err SchemaBehind) Error() string {
+	return fmt.Sprintf("Database schema version %d is behind the latest version %d", err.Current, err.Latest)
+}
+
+// UnknownVersion signifies there is no migration with the given version.
+type UnknownVersion struct {
+	Version int
+}
+
+func (err UnknownVersion) Error() string {
+	return fmt.Sprintf("Unknown migration version %d", err.Version)
+}
+
+// Load the migrations embedded in the binary ordered by version.
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, p := range paths {
+		match := fileNamePattern.FindStringSubmatch(path.Base(p))
+		if match == nil {
+			return nil, fmt.Errorf("Invalid migration file name: %s", p)
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("Conflicting migration names for version %d: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("Migration %d_%s has to provide both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies the migrations to the database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New migrator with the embedded migrations.
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest version known to the binary.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the latest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		target := 0
+		for _, migration := range m.migrations {
+			if migration.Version < current {
+				target = migration.Version
+			}
+		}
+
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// To migrates the database up or down to the given version, zero rolls back everything.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return UnknownVersion{Version: version}
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+// Status of every migration known to the binary.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		exists, err := tableExists(ctx, conn)
+		if err != nil {
+			return err
+		} else if !exists {
+			for _, migration := range m.migrations {
+				statuses = append(statuses, Status{Migration: migration})
+			}
+			return nil
+		}
+
+		rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		applied := map[int]time.Time{}
+		for rows.Next() {
+			var (
+				version   int
+				appliedAt time.Time
+			)
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				return err
+			}
+			applied[version] = appliedAt
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// Current version of the database schema, zero if no migrations have been applied.
+func (m *Migrator) Current(ctx context.Context) (int, error) {
+	var current int
+
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		var err error
+		current, err = currentVersion(ctx, conn)
+		return err
+	})
+
+	return current, err
+}
+
+// EnsureUpToDate returns SchemaBehind error if there are pending migrations.
+func (m *Migrator) EnsureUpToDate(ctx context.Context) error {
+	current, err := m.Current(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current < m.Latest() {
+		return SchemaBehind{Current: current, Latest: m.Latest()}
+	}
+
+	return nil
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+
+	return nil
+}
+
+// migrate applies or rolls back the migrations between the versions, each one in its own transaction.
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target int) error {
+	if target >= current {
+		for _, migration := range m.migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+
+			err := inTx(ctx, conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("Error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+
+		err := inTx(ctx, conn, migration.Down,
+			"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		if err != nil {
+			return fmt.Errorf("Error rolling back migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// withLock runs the function holding the advisory lock so concurrent runners wait for each other.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	return m.withConn(ctx, func(conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			return fmt.Errorf("Error acquiring migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+
+		if err := createTable(ctx, conn); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+// withConn runs the function on a single connection, the advisory locks are bound to the connection.
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+func createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("Error creating migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var exists bool
+
+	err := conn.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("Error checking migrations table: %w", err)
+	}
+
+	return exists, nil
+}
+
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+
+	exists, err := tableExists(ctx, conn)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	err = conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("Error loading schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, script string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Loading migrations", func() {
+	Specify("the embedded migrations are ordered by version and complete", func() {
+		migrations, err := Load()
+
+		Expect(err).To(BeNil())
+		Expect(migrations).NotTo(BeEmpty())
+		for i, migration := range migrations {
+			Expect(migration.Up).NotTo(BeEmpty())
+			Expect(migration.Down).NotTo(BeEmpty())
+			if i > 0 {
+				Expect(migration.Version).To(BeNumerically(">", migrations[i-1].Version))
+			}
+		}
+	})
+
+	Specify("the migrations are sorted by the numeric version", func() {
+		migrations, err := load(fstest.MapFS{
+			"sql/10_third.up.sql":   {Data: []byte("SELECT 10")},
+			"sql/10_third.down.sql": {Data: []byte("SELECT -10")},
+			"sql/2_second.up.sql":   {Data: []byte("SELECT 2")},
+			"sql/2_second.down.sql": {Data: []byte("SELECT -2")},
+			"sql/1_first.up.sql":    {Data: []byte("SELECT 1")},
+			"sql/1_first.down.sql":  {Data: []byte("SELECT -1")},
+		})
+
+		Expect(err).To(BeNil())
+		Expect(migrations).To(HaveLen(3))
+		Expect(migrations[0].Name).To(Equal("first"))
+		Expect(migrations[1].Name).To(Equal("second"))
+		Expect(migrations[2].Name).To(Equal("third"))
+		Expect(migrations[2].Up).To(Equal("SELECT 10"))
+		Expect(migrations[2].Down).To(Equal("SELECT -10"))
+	})
+
+	Specify("an error is returned when the down file is missing", func() {
+		_, err := load(fstest.MapFS{
+			"sql/1_first.up.sql": {Data: []byte("SELECT 1")},
+		})
+
+		Expect(err).NotTo(BeNil())
+	})
+
+	Specify("an error is returned for the conflicting names of the same version", func() {
+		_, err := load(fstest.MapFS{
+			"sql/1_first.up.sql":   {Data: []byte("SELECT 1")},
+			"sql/1_other.down.sql": {Data: []byte("SELECT -1")},
+		})
+
+		Expect(err).NotTo(BeNil())
+	})
+
+	Specify("an error is returned for an invalid file name", func() {
+		_, err := load(fstest.MapFS{
+			"sql/first.up.sql": {Data: []byte("SELECT 1")},
+		})
+
+		Expect(err).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Migrating to an unknown version", func() {
+	Specify("an unknown version error is returned without touching the database", func() {
+		migrator, err := New(nil)
+		Expect(err).To(BeNil())
+
+		err = migrator.To(context.Background(), migrator.Latest()+1)
+
+		Expect(err).To(Equal(UnknownVersion{Version: migrator.Latest() + 1}))
+	})
+})
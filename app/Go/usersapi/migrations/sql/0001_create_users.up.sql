@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY,
+    email_address text NOT NULL UNIQUE,
+    password text NOT NULL UNIQUE,
+    is_active boolean NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    version integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_member ON users (id, email_address);
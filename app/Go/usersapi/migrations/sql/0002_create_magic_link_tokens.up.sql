@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS magic_link_tokens (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_user_id ON magic_link_tokens (user_id);
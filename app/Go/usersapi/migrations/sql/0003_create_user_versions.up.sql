@@ -0,0 +1,12 @@
+CREATE TABLE user_versions (
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    email_address text NOT NULL,
+    is_active boolean NOT NULL,
+    recorded_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, version)
+);
+
+-- The history of the existing users starts with their current state.
+INSERT INTO user_versions (user_id, version, email_address, is_active, recorded_at)
+SELECT id, version, email_address, is_active, created_at FROM users;
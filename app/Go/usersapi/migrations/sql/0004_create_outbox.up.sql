@@ -0,0 +1,10 @@
+CREATE TABLE outbox (
+    id bigserial PRIMARY KEY,
+    topic text NOT NULL,
+    payload bytea NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    published_at timestamp with time zone
+);
+
+-- The relay only scans the events waiting to be published.
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
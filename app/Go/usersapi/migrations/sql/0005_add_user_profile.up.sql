@@ -0,0 +1,12 @@
+ALTER TABLE users
+    ADD COLUMN display_name text NOT NULL DEFAULT '',
+    ADD COLUMN locale text NOT NULL DEFAULT '',
+    ADD COLUMN timezone text NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url text NOT NULL DEFAULT '';
+
+-- The recorded versions carry the profile they were stored with.
+ALTER TABLE user_versions
+    ADD COLUMN display_name text NOT NULL DEFAULT '',
+    ADD COLUMN locale text NOT NULL DEFAULT '',
+    ADD COLUMN timezone text NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url text NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS user_tombstones;
+
+ALTER TABLE magic_link_tokens DROP CONSTRAINT IF EXISTS magic_link_tokens_user_id_fkey;
+
+DROP INDEX IF EXISTS users_deletion_requested_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_requested_at;
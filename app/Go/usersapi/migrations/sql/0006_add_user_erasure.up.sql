@@ -0,0 +1,19 @@
+-- The users waiting for the erasure once the grace period of their deletion request is over.
+ALTER TABLE users ADD COLUMN deletion_requested_at timestamp with time zone;
+
+CREATE INDEX users_deletion_requested_idx ON users (deletion_requested_at) WHERE deletion_requested_at IS NOT NULL;
+
+-- The login links go away with the erased user, the links of the users that no longer exist are dropped first.
+DELETE FROM magic_link_tokens WHERE user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE magic_link_tokens
+    ADD CONSTRAINT magic_link_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+-- The audit record of the erased users, it carries no personal data.
+CREATE TABLE user_tombstones (
+    user_id uuid PRIMARY KEY,
+    version integer NOT NULL,
+    reason text NOT NULL,
+    deletion_requested_at timestamp with time zone,
+    erased_at timestamp with time zone NOT NULL DEFAULT now()
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS outbox_user_id_idx;
+
+ALTER TABLE outbox DROP COLUMN IF EXISTS user_id;
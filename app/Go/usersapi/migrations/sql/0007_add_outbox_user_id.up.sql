@@ -0,0 +1,10 @@
+-- The events of a user are looked up by its ID, e.g. to export or to erase them, rather than by decoding every payload.
+ALTER TABLE outbox ADD COLUMN user_id uuid;
+
+-- The payloads stored before the envelopes carry the event itself.
+UPDATE outbox SET user_id = COALESCE(
+    convert_from(payload, 'UTF8')::jsonb -> 'event' ->> 'UserID',
+    convert_from(payload, 'UTF8')::jsonb ->> 'UserID'
+)::uuid;
+
+CREATE INDEX outbox_user_id_idx ON outbox (user_id) WHERE user_id IS NOT NULL;
@@ -0,0 +1,9 @@
+-- The login history of the users, it goes away with the erased user.
+CREATE TABLE user_logins (
+    id bigserial PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    method text NOT NULL,
+    logged_in_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_logins_user_id_idx ON user_logins (user_id, logged_in_at);
@@ -0,0 +1,184 @@
+package monitoring
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/platform/metrics"
+	"time"
+)
+
+// Namespace of the users API metrics.
+const Namespace = "usersapi"
+
+// Results of the observed operations.
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// Metrics of the users API on top of the HTTP metrics.
+// The methods are no-ops on nil metrics, e.g. in the tests not exporting them.
+type Metrics struct {
+	*metrics.Metrics
+
+	logins          *prometheus.CounterVec
+	passwordHashing *prometheus.HistogramVec
+	publishes       *prometheus.CounterVec
+	messages        *prometheus.HistogramVec
+	panics          *prometheus.CounterVec
+	rpcs            *prometheus.HistogramVec
+	rpcPanics       *prometheus.CounterVec
+}
+
+// New metrics registered in their own registry.
+func New() *Metrics {
+	m := &Metrics{
+		Metrics: metrics.New(Namespace),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "logins_total",
+			Help:      "Number of the login attempts by method, result and failure reason.",
+		}, []string{"method", "result", "reason"}),
+		passwordHashing: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "password_hashing_duration_seconds",
+			Help:      "Duration of the bcrypt operations by operation, either hash or verify.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 10),
+		}, []string{"operation"}),
+		publishes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "events_published_total",
+			Help:      "Number of the events published by topic and result.",
+		}, []string{"topic", "result"}),
+		messages: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "bus_message_duration_seconds",
+			Help:      "Duration of the commands and queries dispatched through the buses by message and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"message", "result"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "http_panics_recovered_total",
+			Help:      "Number of the panics recovered from the request handlers by route.",
+		}, []string{"route"}),
+		rpcs: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Duration of the gRPC calls by method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		rpcPanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "grpc_panics_recovered_total",
+			Help:      "Number of the panics recovered from the gRPC handlers by method.",
+		}, []string{"method"}),
+	}
+
+	m.MustRegister(m.logins, m.passwordHashing, m.publishes, m.messages, m.panics, m.rpcs, m.rpcPanics)
+
+	return m
+}
+
+// RegisterDB exports the connection pool statistics of the database.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.MustRegister(metrics.NewDBStatsCollector(Namespace, db, name))
+}
+
+// ObserveLogin attempt with the given method, e.g. password or magic_link, the empty reason stands for a successful login.
+func (m *Metrics) ObserveLogin(method, reason string) {
+	if m == nil {
+		return
+	}
+
+	result := resultSuccess
+	if reason != "" {
+		result = resultFailure
+	}
+
+	m.logins.WithLabelValues(method, result, reason).Inc()
+}
+
+// ObservePasswordHashing duration of the bcrypt operation.
+func (m *Metrics) ObservePasswordHashing(operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.passwordHashing.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// ObserveMessage dispatched through the bus, it matches the bus.Metrics observer signature.
+func (m *Metrics) ObserveMessage(name string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.messages.WithLabelValues(name, result(err)).Observe(duration.Seconds())
+}
+
+// ObservePanic recovered from the handler of the route.
+func (m *Metrics) ObservePanic(route string) {
+	if m == nil {
+		return
+	}
+
+	m.panics.WithLabelValues(route).Inc()
+}
+
+// ObserveRPC duration of the gRPC call of the full method, e.g. /users.Users/Login, with its status code.
+func (m *Metrics) ObserveRPC(method, code string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.rpcs.WithLabelValues(method, code).Observe(duration.Seconds())
+}
+
+// ObserveRPCPanic recovered from the handler of the gRPC method.
+func (m *Metrics) ObserveRPCPanic(method string) {
+	if m == nil {
+		return
+	}
+
+	m.rpcPanics.WithLabelValues(method).Inc()
+}
+
+// Publisher counting the published events by topic.
+func (m *Metrics) Publisher(publisher events.Publisher) events.Publisher {
+	if m == nil {
+		return publisher
+	}
+
+	return &instrumentedPublisher{publisher: publisher, publishes: m.publishes}
+}
+
+type instrumentedPublisher struct {
+	publisher events.Publisher
+	publishes *prometheus.CounterVec
+}
+
+func (p *instrumentedPublisher) Publish(topic string, body []byte) error {
+	err := p.publisher.Publish(topic, body)
+	p.publishes.WithLabelValues(topic, result(err)).Inc()
+
+	return err
+}
+
+// Ping the broker if the wrapped publisher supports it, e.g. the NSQ producer checked by the readiness probe.
+func (p *instrumentedPublisher) Ping() error {
+	if pinger, ok := p.publisher.(interface{ Ping() error }); ok {
+		return pinger.Ping()
+	}
+
+	return errors.New("Publisher does not support pings")
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+
+	return resultSuccess
+}
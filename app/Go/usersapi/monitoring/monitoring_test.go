@@ -0,0 +1,87 @@
+package monitoring_test
+
+import (
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/usersapi/monitoring"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// failingPublisher rejects every message.
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(topic string, body []byte) error {
+	return errors.New("broker unavailable")
+}
+
+var _ = Describe("Users API metrics", func() {
+	var m *monitoring.Metrics
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		return recorder.Body.String()
+	}
+
+	BeforeEach(func() {
+		m = monitoring.New()
+	})
+
+	Specify("the published events are counted by topic and result", func() {
+		Expect(m.Publisher(&memory.Publisher{}).Publish("new_user", nil)).To(Succeed())
+		Expect(m.Publisher(failingPublisher{}).Publish("new_user", nil)).NotTo(Succeed())
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`usersapi_events_published_total{result="success",topic="new_user"} 1`))
+		Expect(body).To(ContainSubstring(`usersapi_events_published_total{result="failure",topic="new_user"} 1`))
+	})
+
+	Specify("the login attempts are counted by method and reason", func() {
+		m.ObserveLogin("password", "")
+		m.ObserveLogin("password", "invalid_password")
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`usersapi_logins_total{method="password",reason="",result="success"} 1`))
+		Expect(body).To(ContainSubstring(`usersapi_logins_total{method="password",reason="invalid_password",result="failure"} 1`))
+	})
+
+	Specify("the password hashing and the bus messages are timed", func() {
+		m.ObservePasswordHashing("hash", 50*time.Millisecond)
+		m.ObserveMessage("RegisterUser", time.Millisecond, nil)
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`usersapi_password_hashing_duration_seconds_count{operation="hash"} 1`))
+		Expect(body).To(ContainSubstring(`usersapi_bus_message_duration_seconds_count{message="RegisterUser",result="success"} 1`))
+	})
+
+	Specify("the recovered panics are counted by route", func() {
+		m.ObservePanic("/api/login")
+
+		Expect(scrape()).To(ContainSubstring(`usersapi_http_panics_recovered_total{route="/api/login"} 1`))
+	})
+
+	Specify("the gRPC calls are timed by method and code and their recovered panics are counted", func() {
+		m.ObserveRPC("/users.Users/Login", "OK", time.Millisecond)
+		m.ObserveRPCPanic("/users.Users/Login")
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`usersapi_grpc_request_duration_seconds_count{code="OK",method="/users.Users/Login"} 1`))
+		Expect(body).To(ContainSubstring(`usersapi_grpc_panics_recovered_total{method="/users.Users/Login"} 1`))
+	})
+
+	Specify("nil metrics are no-ops", func() {
+		var disabled *monitoring.Metrics
+		publisher := &memory.Publisher{}
+
+		disabled.ObserveLogin("password", "")
+		disabled.ObservePanic("/api/login")
+		disabled.ObserveRPC("/users.Users/Login", "OK", time.Millisecond)
+		disabled.ObserveRPCPanic("/users.Users/Login")
+		Expect(disabled.Publisher(publisher)).To(BeIdenticalTo(publisher))
+	})
+})
@@ -0,0 +1,230 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// document of the users API, every route registered by routes.InitializeRoutes must be described in it.
+//
+//go:embed openapi.json
+var document []byte
+
+// docsPage renders the document with Swagger UI.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Users API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@4/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@4/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: %q, dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// The archives of the personal data exports are decoded as files when their responses are validated.
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/zip", openapi3filter.FileBodyDecoder)
+}
+
+// Load the OpenAPI document of the users API.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(document)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading OpenAPI document: %w", err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("Invalid OpenAPI document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// Handler serving the OpenAPI document.
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(document)
+	}
+}
+
+// DocsHandler serving the documentation UI of the OpenAPI document served at the given path.
+func DocsHandler(documentPath string) http.HandlerFunc {
+	page := fmt.Sprintf(docsPage, documentPath)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}
+}
+
+// Validator rejects the requests not matching the OpenAPI document.
+type Validator struct {
+	router routers.Router
+	// ValidateResponses replaces the responses not matching the document with internal errors, meant for the tests
+	// as the responses are buffered.
+	ValidateResponses bool
+}
+
+// NewValidator of the requests against the document.
+func NewValidator(doc *openapi3.T) (*Validator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validator{router: router}, nil
+}
+
+// Middleware validating the requests and optionally the responses, the routes missing from the document are passed through.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError: true,
+				// The tokens are verified by the authentication middleware.
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			responses.PROBLEM(w, r, requestProblem(err))
+			return
+		}
+
+		if !v.ValidateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buffer := &responseBuffer{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffer, r)
+
+		err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 buffer.status,
+			Header:                 buffer.header,
+			Body:                   ioutil.NopCloser(bytes.NewReader(buffer.body.Bytes())),
+			Options:                &openapi3filter.Options{MultiError: true},
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Errorw("Response does not match the OpenAPI document",
+				"status", buffer.status,
+				"error", err,
+			)
+			responses.PROBLEM(w, r, responses.NewProblem(responses.CodeInternal, "The response does not match the OpenAPI document"))
+			return
+		}
+
+		for key, values := range buffer.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(buffer.status)
+		_, _ = w.Write(buffer.body.Bytes())
+	})
+}
+
+// requestProblem of the failed request validation, the schema violations are reported by field.
+func requestProblem(err error) responses.Problem {
+	var fieldErrors []responses.FieldError
+
+	for _, err := range flatten(err) {
+		requestErr := &openapi3filter.RequestError{}
+		if !errors.As(err, &requestErr) {
+			continue
+		}
+
+		if requestErr.Parameter != nil {
+			fieldErrors = append(fieldErrors, responses.FieldError{Field: requestErr.Parameter.Name, Message: requestErr.Reason})
+			continue
+		}
+
+		schemaErrors := schemaErrors(requestErr.Err)
+		if len(schemaErrors) == 0 {
+			// The body is missing, not JSON or of another content type.
+			return responses.NewProblem(responses.CodeMalformedRequest, requestErr.Error())
+		}
+
+		for _, schemaErr := range schemaErrors {
+			fieldErrors = append(fieldErrors, responses.FieldError{Field: strings.Join(schemaErr.JSONPointer(), "."), Message: schemaErr.Reason})
+		}
+	}
+
+	problem := responses.NewProblem(responses.CodeValidationFailed, "The request does not match the API specification")
+	problem.Errors = fieldErrors
+
+	return problem
+}
+
+func schemaErrors(err error) []*openapi3.SchemaError {
+	var result []*openapi3.SchemaError
+
+	for _, err := range flatten(err) {
+		schemaErr := &openapi3.SchemaError{}
+		if errors.As(err, &schemaErr) {
+			result = append(result, schemaErr)
+		}
+	}
+
+	return result
+}
+
+// flatten the multi errors, the errors wrapping them are kept as is.
+func flatten(err error) []error {
+	multiErr, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+
+	var result []error
+	for _, err := range multiErr {
+		result = append(result, flatten(err)...)
+	}
+
+	return result
+}
+
+// responseBuffer holds the response until it's validated.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
@@ -0,0 +1,137 @@
+package openapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/usersapi/openapi"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("OpenAPI document", func() {
+	Specify("the document is valid", func() {
+		doc, err := openapi.Load()
+
+		Expect(err).To(BeNil())
+		Expect(doc.Paths).To(HaveKey("/api/register"))
+	})
+
+	Specify("the document and its UI are served", func() {
+		res := httptest.NewRecorder()
+		openapi.Handler().ServeHTTP(res, httptest.NewRequest("GET", "/openapi.json", nil))
+
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(res.Body.String()).To(ContainSubstring(`"openapi": "3.0.3"`))
+
+		res = httptest.NewRecorder()
+		openapi.DocsHandler("/openapi.json").ServeHTTP(res, httptest.NewRequest("GET", "/docs", nil))
+
+		Expect(res.Code).To(Equal(http.StatusOK))
+		Expect(res.Body.String()).To(ContainSubstring(`"/openapi.json"`))
+	})
+})
+
+var _ = Describe("Validator", func() {
+	var (
+		validator *openapi.Validator
+		response  interface{}
+		status    int
+		handled   bool
+	)
+
+	BeforeEach(func() {
+		doc, err := openapi.Load()
+		Expect(err).To(BeNil())
+
+		validator, err = openapi.NewValidator(doc)
+		Expect(err).To(BeNil())
+
+		handled = false
+		status = http.StatusCreated
+		response = map[string]string{"token": "token", "user_id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}
+	})
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		handler := validator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handled = true
+			w.Header().Set("Content-Type", "application/json")
+			responses.JSON(w, status, response)
+		}))
+
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	problem := func(res *httptest.ResponseRecorder) responses.Problem {
+		problem := responses.Problem{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &problem)).To(Succeed())
+
+		return problem
+	}
+
+	Specify("the valid requests are passed to the handler", func() {
+		res := serve("POST", "/api/register", `{"email_address": "user@example.com", "password": "password"}`)
+
+		Expect(handled).To(BeTrue())
+		Expect(res.Code).To(Equal(http.StatusCreated))
+	})
+
+	Specify("the requests missing the required fields are rejected by field", func() {
+		res := serve("POST", "/api/register", `{"password": 1}`)
+
+		Expect(handled).To(BeFalse())
+		Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(problem(res).Code).To(Equal(responses.CodeValidationFailed))
+
+		var fields []string
+		for _, fieldError := range problem(res).Errors {
+			fields = append(fields, fieldError.Field)
+		}
+		Expect(fields).To(ConsistOf("email_address", "password"))
+	})
+
+	Specify("the malformed requests are rejected", func() {
+		res := serve("POST", "/api/register", `{"email_address":`)
+
+		Expect(handled).To(BeFalse())
+		Expect(res.Code).To(Equal(http.StatusBadRequest))
+		Expect(problem(res).Code).To(Equal(responses.CodeMalformedRequest))
+	})
+
+	Specify("the routes missing from the document are left to the router", func() {
+		serve("GET", "/api/unknown", "")
+
+		Expect(handled).To(BeTrue())
+	})
+
+	When("the responses are validated", func() {
+		BeforeEach(func() {
+			validator.ValidateResponses = true
+		})
+
+		Specify("the valid responses are passed through", func() {
+			res := serve("POST", "/api/register", `{"email_address": "user@example.com", "password": "password"}`)
+
+			Expect(res.Code).To(Equal(http.StatusCreated))
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/json"))
+			Expect(res.Body.String()).To(ContainSubstring(`"token":"token"`))
+		})
+
+		Specify("the responses not matching the document are replaced with internal errors", func() {
+			response = map[string]string{"token": "token"}
+
+			res := serve("POST", "/api/register", `{"email_address": "user@example.com", "password": "password"}`)
+
+			Expect(res.Code).To(Equal(http.StatusInternalServerError))
+			Expect(problem(res).Code).To(Equal(responses.CodeInternal))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+// Package ratelimit limits the request rate per client with the token buckets.
+package ratelimit
+
+import (
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// idleTimeout after which the client buckets are forgotten.
+const idleTimeout = 3 * time.Minute
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter of the requests per client, safe for concurrent use.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+// New limiter allowing the given number of requests per second with the burst, zero limit disables it.
+func New(perSecond float64, burst int) *Limiter {
+	return &Limiter{
+		limit:     rate.Limit(perSecond),
+		burst:     burst,
+		clients:   map[string]*client{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Set the limit and the burst, the clients start with the full buckets.
+func (l *Limiter) Set(perSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = rate.Limit(perSecond)
+	l.burst = burst
+	l.clients = map[string]*client{}
+}
+
+// Allow a request of the client.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	l.sweep(now)
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	return c.limiter.AllowN(now, 1)
+}
+
+// sweep the idle clients once per idle timeout, the caller has to hold the lock.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTimeout {
+		return
+	}
+
+	for key, c := range l.clients {
+		if now.Sub(c.lastSeen) > idleTimeout {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
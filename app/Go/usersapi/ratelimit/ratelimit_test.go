@@ -0,0 +1,40 @@
+package ratelimit_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/usersapi/ratelimit"
+)
+
+var _ = Describe("Rate limiter", func() {
+	Specify("the requests over the burst are rejected per client", func() {
+		limiter := ratelimit.New(1, 2)
+
+		Expect(limiter.Allow("a")).To(BeTrue())
+		Expect(limiter.Allow("a")).To(BeTrue())
+		Expect(limiter.Allow("a")).To(BeFalse())
+		Expect(limiter.Allow("b")).To(BeTrue())
+	})
+
+	Specify("zero limit allows every request", func() {
+		limiter := ratelimit.New(0, 0)
+
+		for i := 0; i < 100; i++ {
+			Expect(limiter.Allow("a")).To(BeTrue())
+		}
+	})
+
+	Specify("the new limit is applied to the known clients", func() {
+		limiter := ratelimit.New(1, 1)
+		Expect(limiter.Allow("a")).To(BeTrue())
+		Expect(limiter.Allow("a")).To(BeFalse())
+
+		limiter.Set(0, 0)
+
+		Expect(limiter.Allow("a")).To(BeTrue())
+
+		limiter.Set(1000, 10)
+
+		Expect(limiter.Allow("a")).To(BeTrue())
+	})
+})
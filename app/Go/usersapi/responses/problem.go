@@ -0,0 +1,184 @@
+package responses
+
+import (
+	"errors"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"go-ddd-cqrs-example/domain/bus"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/platform/logging"
+	"net/http"
+	"sort"
+)
+
+// ProblemContentType of the error responses.
+const ProblemContentType = "application/problem+json"
+
+// StatusClientClosedRequest of the requests cancelled by the client, the status is never received by the client
+// but it is logged and reported to the metrics apart from the server errors.
+const StatusClientClosedRequest = 499
+
+// problemTypePrefix of the problem types, the type is the prefix followed by the code.
+const problemTypePrefix = "urn:usersapi:problem:"
+
+// Error codes of the problem responses, the clients rely on them so they must never change.
+const (
+	CodeMalformedRequest       = "malformed_request"
+	CodeValidationFailed       = "validation_failed"
+	CodeUnauthorized           = "unauthorized"
+	CodeInvalidCredentials     = "invalid_credentials"
+	CodeInvalidLoginLink       = "invalid_login_link"
+	CodeInvalidEmailChangeLink = "invalid_email_change_link"
+	CodeInvalidDownloadLink    = "invalid_download_link"
+	CodeForbidden              = "forbidden"
+	CodeUserNotFound           = "user_not_found"
+	CodeUserAlreadyExists      = "user_already_exists"
+	CodeExportNotFound         = "export_not_found"
+	CodeUserActive             = "user_active"
+	CodeUserInactive           = "user_inactive"
+	CodeStateConflict          = "state_conflict"
+	CodeVersionConflict        = "version_conflict"
+	CodePreconditionFailed     = "precondition_failed"
+	CodeRateLimited            = "rate_limited"
+	CodeTimeout                = "timeout"
+	CodeCanceled               = "cancelled"
+	CodeUpstreamFailed         = "upstream_failed"
+	CodeInternal               = "internal_error"
+)
+
+// problemKind is the status and the title shared by the problems with the same code.
+type problemKind struct {
+	status int
+	title  string
+}
+
+var problemKinds = map[string]problemKind{
+	CodeMalformedRequest:       {http.StatusBadRequest, "Malformed request"},
+	CodeValidationFailed:       {http.StatusUnprocessableEntity, "Validation failed"},
+	CodeUnauthorized:           {http.StatusUnauthorized, "Unauthorized"},
+	CodeInvalidCredentials:     {http.StatusUnprocessableEntity, "Invalid credentials"},
+	CodeInvalidLoginLink:       {http.StatusUnprocessableEntity, "Invalid login link"},
+	CodeInvalidEmailChangeLink: {http.StatusUnprocessableEntity, "Invalid email change link"},
+	CodeInvalidDownloadLink:    {http.StatusUnprocessableEntity, "Invalid download link"},
+	CodeForbidden:              {http.StatusForbidden, "Forbidden"},
+	CodeUserNotFound:           {http.StatusNotFound, "User not found"},
+	CodeUserAlreadyExists:      {http.StatusConflict, "User already exists"},
+	CodeExportNotFound:         {http.StatusNotFound, "Export not found"},
+	CodeUserActive:             {http.StatusUnprocessableEntity, "User is active"},
+	CodeUserInactive:           {http.StatusUnprocessableEntity, "User is inactive"},
+	CodeStateConflict:          {http.StatusConflict, "State conflict"},
+	CodeVersionConflict:        {http.StatusConflict, "Version conflict"},
+	CodePreconditionFailed:     {http.StatusPreconditionFailed, "Precondition failed"},
+	CodeRateLimited:            {http.StatusTooManyRequests, "Too many requests"},
+	CodeTimeout:                {http.StatusGatewayTimeout, "Request timed out"},
+	CodeCanceled:               {StatusClientClosedRequest, "Request cancelled"},
+	CodeUpstreamFailed:         {http.StatusBadGateway, "Upstream service failed"},
+	CodeInternal:               {http.StatusInternalServerError, "Internal error"},
+}
+
+// Problem details of the failed request as defined by RFC 7807, extended with a stable code,
+// the request ID and the field errors of the failed validation.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a validation failure of a request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewProblem with the code and the detail, the unknown codes are internal errors.
+func NewProblem(code, detail string) Problem {
+	kind, ok := problemKinds[code]
+	if !ok {
+		code, kind = CodeInternal, problemKinds[CodeInternal]
+	}
+
+	return Problem{
+		Type:   problemTypePrefix + code,
+		Title:  kind.title,
+		Status: kind.status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// ProblemFromError maps the domain errors to their problems.
+// The unknown errors are internal errors and their messages are not disclosed.
+func ProblemFromError(err error) Problem {
+	validationErrors := validation.Errors{}
+
+	switch {
+	case errors.As(err, &validationErrors):
+		problem := NewProblem(CodeValidationFailed, "The request has invalid fields")
+		problem.Errors = fieldErrors("", validationErrors)
+		return problem
+	case errors.As(err, &domain_errors.Timeout{}):
+		return NewProblem(CodeTimeout, "The request was not completed in time")
+	case errors.As(err, &domain_errors.Canceled{}):
+		return NewProblem(CodeCanceled, "The request was cancelled by the client")
+	case errors.As(err, &bus.Forbidden{}):
+		return NewProblem(CodeForbidden, "The operation is not allowed")
+	case errors.As(err, &user.UserNotFound{}):
+		return NewProblem(CodeUserNotFound, "User not found")
+	case errors.As(err, &user.AlreadyExists{}):
+		return NewProblem(CodeUserAlreadyExists, "User already exists")
+	case errors.As(err, &user.IsActive{}):
+		return NewProblem(CodeUserActive, "User is active")
+	case errors.As(err, &user.IsInactive{}):
+		return NewProblem(CodeUserInactive, "User is inactive")
+	case errors.As(err, &user.EmailAddressMismatch{}):
+		return NewProblem(CodeStateConflict, "The email address of the user was changed, retry with its current email address")
+	case errors.As(err, &domain_errors.InvalidVersion{}):
+		return NewProblem(CodeVersionConflict, "The user was changed concurrently, retry with its current version")
+	case errors.As(err, &domain_errors.StateConflict{}):
+		return NewProblem(CodeStateConflict, "The user was changed concurrently, retry the request")
+	}
+
+	return NewProblem(CodeInternal, "")
+}
+
+// fieldErrors of the validation errors sorted by field, the nested fields are joined with dots.
+func fieldErrors(prefix string, validationErrors validation.Errors) []FieldError {
+	var result []FieldError
+
+	for field, err := range validationErrors {
+		if nested := (validation.Errors{}); errors.As(err, &nested) {
+			result = append(result, fieldErrors(prefix+field+".", nested)...)
+			continue
+		}
+
+		result = append(result, FieldError{Field: prefix + field, Message: err.Error()})
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Field < result[j].Field })
+
+	return result
+}
+
+// PROBLEM writes given problem details to the response.
+func PROBLEM(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Instance = r.URL.Path
+	problem.RequestID = logging.RequestIDFromContext(r.Context())
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	JSON(w, problem.Status, problem)
+}
+
+// ERROR writes the problem of given error to the response, the server errors are logged.
+func ERROR(w http.ResponseWriter, r *http.Request, err error) {
+	problem := ProblemFromError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Errorw("Request failed", "code", problem.Code, "error", err)
+	}
+
+	PROBLEM(w, r, problem)
+}
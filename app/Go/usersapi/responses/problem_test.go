@@ -0,0 +1,102 @@
+package responses_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	validation "github.com/go-ozzo/ozzo-validation"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/bus"
+	domain_errors "go-ddd-cqrs-example/domain/errors"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/platform/logging"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Problem responses", func() {
+	Specify("the domain errors are mapped to their status and code", func() {
+		samples := []struct {
+			err    error
+			status int
+			code   string
+		}{
+			{user.AlreadyExists{}, http.StatusConflict, responses.CodeUserAlreadyExists},
+			{fmt.Errorf("Invariant failed: %w", user.IsInactive{}), http.StatusUnprocessableEntity, responses.CodeUserInactive},
+			{user.IsActive{}, http.StatusUnprocessableEntity, responses.CodeUserActive},
+			{fmt.Errorf("User not found: %w", user.UserNotFound{}), http.StatusNotFound, responses.CodeUserNotFound},
+			{domain_errors.StateConflict{}, http.StatusConflict, responses.CodeStateConflict},
+			{fmt.Errorf("Invariant failed: %w", user.EmailAddressMismatch{}), http.StatusConflict, responses.CodeStateConflict},
+			{domain_errors.InvalidVersion{}, http.StatusConflict, responses.CodeVersionConflict},
+			{domain_errors.FromContext(expiredContext()), http.StatusGatewayTimeout, responses.CodeTimeout},
+			{domain_errors.FromContext(cancelledContext()), responses.StatusClientClosedRequest, responses.CodeCanceled},
+			{bus.Forbidden{}, http.StatusForbidden, responses.CodeForbidden},
+			{errors.New("pq: relation \"users\" does not exist"), http.StatusInternalServerError, responses.CodeInternal},
+		}
+
+		for _, v := range samples {
+			problem := responses.ProblemFromError(v.err)
+
+			Expect(problem.Status).To(Equal(v.status))
+			Expect(problem.Code).To(Equal(v.code))
+			Expect(problem.Type).To(Equal("urn:usersapi:problem:" + v.code))
+			Expect(problem.Title).NotTo(BeEmpty())
+		}
+	})
+
+	Specify("the validation errors are reported by field", func() {
+		err := validation.Errors{
+			"password":      errors.New("cannot be blank"),
+			"email_address": errors.New("must be a valid email address"),
+		}
+
+		problem := responses.ProblemFromError(fmt.Errorf("Invalid command: %w", err))
+
+		Expect(problem.Status).To(Equal(http.StatusUnprocessableEntity))
+		Expect(problem.Code).To(Equal(responses.CodeValidationFailed))
+		Expect(problem.Errors).To(Equal([]responses.FieldError{
+			{Field: "email_address", Message: "must be a valid email address"},
+			{Field: "password", Message: "cannot be blank"},
+		}))
+	})
+
+	Specify("the unknown codes are internal errors", func() {
+		Expect(responses.NewProblem("unknown", "").Status).To(Equal(http.StatusInternalServerError))
+	})
+
+	Specify("the problem is written as problem+json with the instance and the request ID", func() {
+		req := httptest.NewRequest("POST", "/api/register", nil)
+		req = req.WithContext(logging.WithRequestID(req.Context(), "request-1"))
+		res := httptest.NewRecorder()
+
+		responses.ERROR(res, req, errors.New("pq: connection refused"))
+
+		Expect(res.Code).To(Equal(http.StatusInternalServerError))
+		Expect(res.Header().Get("Content-Type")).To(Equal(responses.ProblemContentType))
+		Expect(res.Body.String()).NotTo(ContainSubstring("connection refused"))
+
+		problem := responses.Problem{}
+		Expect(json.Unmarshal(res.Body.Bytes(), &problem)).To(Succeed())
+		Expect(problem.Code).To(Equal(responses.CodeInternal))
+		Expect(problem.Instance).To(Equal("/api/register"))
+		Expect(problem.RequestID).To(Equal("request-1"))
+	})
+})
+
+func cancelledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	return ctx
+}
+
+func expiredContext() context.Context {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	cancel()
+
+	return ctx
+}
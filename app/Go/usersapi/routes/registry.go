@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"github.com/gorilla/mux"
+	"go-ddd-cqrs-example/usersapi/middlewares"
+	"net/http"
+	"time"
+)
+
+// Deprecation and sunset dates of the legacy /api routes superseded by the versioned ones.
+var (
+	LegacyDeprecation = time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	LegacySunset      = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Route of a version of the API.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	// Legacy unversioned path served by the same handler with the deprecation headers, empty if none.
+	Legacy string
+}
+
+// Version of the API, its routes are registered on a subrouter under its prefix, e.g. /v1.
+type Version struct {
+	Prefix string
+	Routes []Route
+}
+
+// Register the routes of the versions, their legacy paths are registered on the router itself.
+func Register(router *mux.Router, versions ...Version) {
+	for _, version := range versions {
+		subrouter := router.PathPrefix(version.Prefix).Subrouter()
+
+		for _, route := range version.Routes {
+			subrouter.HandleFunc(route.Path, route.Handler).Methods(route.Method)
+
+			if route.Legacy != "" {
+				handler := middlewares.SetMiddlewareDeprecation(LegacyDeprecation, LegacySunset, version.Prefix+route.Path, route.Handler)
+				router.HandleFunc(route.Legacy, handler).Methods(route.Method)
+			}
+		}
+	}
+}
@@ -1,21 +1,93 @@
 package routes
 
 import (
+	"go-ddd-cqrs-example/platform/health"
+	"go-ddd-cqrs-example/platform/metrics"
+	"go-ddd-cqrs-example/platform/tracing"
 	"go-ddd-cqrs-example/usersapi/controllers/login_controller"
 	"go-ddd-cqrs-example/usersapi/controllers/testvalue_controller"
 	user_controller "go-ddd-cqrs-example/usersapi/controllers/user"
 	"go-ddd-cqrs-example/usersapi/middlewares"
+	"go-ddd-cqrs-example/usersapi/openapi"
 	"go-ddd-cqrs-example/usersapi/server"
+	"net/http"
 )
 
 func InitializeRoutes(s *server.Server) {
-	// Auth routes
-	s.Router.HandleFunc("/api/login", middlewares.SetMiddlewareJSON(login_controller.Login(s))).Methods("POST")
-	s.Router.HandleFunc("/api/register", middlewares.SetMiddlewareJSON(user_controller.Register(s))).Methods("POST")
+	s.Router.Use(func(next http.Handler) http.Handler {
+		return middlewares.SetMiddlewareRequestID(next.ServeHTTP)
+	})
+	s.Router.Use(func(next http.Handler) http.Handler {
+		return middlewares.SetMiddlewareLogging(next.ServeHTTP)
+	})
+	s.Router.Use(func(next http.Handler) http.Handler {
+		return middlewares.SetMiddlewareRecovery(s.Metrics.ObservePanic, next.ServeHTTP)
+	})
+	s.Router.Use(tracing.RouteMiddleware(metrics.MuxRoute))
+	if s.Metrics != nil {
+		s.Router.Use(s.Metrics.Middleware(metrics.MuxRoute))
+		s.Router.Handle("/metrics", s.Metrics.Handler()).Methods("GET")
+	}
+	s.Router.Use(func(next http.Handler) http.Handler {
+		return middlewares.SetMiddlewareRateLimit(s.RateLimiter, next.ServeHTTP)
+	})
+	s.Router.Use(func(next http.Handler) http.Handler {
+		return middlewares.SetMiddlewareTimeout(s.RequestTimeout, next.ServeHTTP)
+	})
+	if s.Validator != nil {
+		s.Router.Use(s.Validator.Middleware)
+	}
 
-	//// User routes
-	s.Router.HandleFunc("/api/deactivate/current", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.Deactivate(s)))).Methods("POST")
-	s.Router.HandleFunc("/api/activate/current", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.Activate(s)))).Methods("POST")
+	// Documentation, every route registered below must be described in the OpenAPI document.
+	s.Router.HandleFunc("/openapi.json", openapi.Handler()).Methods("GET")
+	s.Router.HandleFunc("/docs", openapi.DocsHandler("/openapi.json")).Methods("GET")
 
-	s.Router.HandleFunc("/api/get/testvalue", middlewares.SetMiddlewareJSON(testvalue_controller.GetTestValue(s))).Methods("GET")
+	// Probes
+	s.Router.HandleFunc("/healthz", health.LivenessHandler()).Methods("GET")
+	s.Router.HandleFunc("/readyz", health.ReadinessHandler(s.Health)).Methods("GET")
+
+	Register(s.Router, v1(s), v2(s))
+}
+
+// v1 of the API, it keeps the behavior of the legacy /api routes.
+func v1(s *server.Server) Version {
+	return Version{
+		Prefix: "/v1",
+		Routes: []Route{
+			// Auth routes
+			{Method: "POST", Path: "/login", Legacy: "/api/login", Handler: middlewares.SetMiddlewareJSON(login_controller.Login(s))},
+			{Method: "POST", Path: "/login/magic-link", Legacy: "/api/login/magic-link", Handler: middlewares.SetMiddlewareJSON(login_controller.RequestMagicLink(s))},
+			{Method: "POST", Path: "/login/magic-link/verify", Legacy: "/api/login/magic-link/verify", Handler: middlewares.SetMiddlewareJSON(login_controller.VerifyMagicLink(s))},
+			{Method: "POST", Path: "/token/refresh", Legacy: "/api/token/refresh", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, login_controller.RefreshToken(s)))},
+			{Method: "POST", Path: "/register", Legacy: "/api/register", Handler: middlewares.SetMiddlewareJSON(user_controller.Register(s))},
+
+			// User routes
+			{Method: "POST", Path: "/deactivate/current", Legacy: "/api/deactivate/current", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.Deactivate(s)))},
+			{Method: "POST", Path: "/activate/current", Legacy: "/api/activate/current", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.Activate(s)))},
+
+			{Method: "GET", Path: "/get/testvalue", Legacy: "/api/get/testvalue", Handler: middlewares.SetMiddlewareJSON(testvalue_controller.GetTestValue(s))},
+		},
+	}
+}
+
+// v2 of the API with the resource oriented routes.
+func v2(s *server.Server) Version {
+	return Version{
+		Prefix: "/v2",
+		Routes: []Route{
+			{Method: "GET", Path: "/users/me", Legacy: "/api/users/me", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.GetCurrent(s)))},
+			{Method: "PATCH", Path: "/users/me", Legacy: "/api/users/me", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.UpdateCurrent(s)))},
+			{Method: "DELETE", Path: "/users/me", Legacy: "/api/users/me", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.DeleteCurrent(s)))},
+
+			// Personal data exports, the token of the download URL authenticates the download.
+			{Method: "POST", Path: "/users/me/export", Legacy: "/api/users/me/export", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.RequestExport(s)))},
+			{Method: "GET", Path: "/users/me/exports/{id}", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.GetExport(s)))},
+			{Method: "GET", Path: "/exports/{id}/download", Handler: user_controller.DownloadExport(s)},
+
+			// Email change, the links sent by email authenticate the verification and the revert.
+			{Method: "POST", Path: "/users/me/email-change", Handler: middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(*s, user_controller.RequestEmailChange(s)))},
+			{Method: "POST", Path: "/email-change/verify", Handler: middlewares.SetMiddlewareJSON(user_controller.VerifyEmailChange(s))},
+			{Method: "POST", Path: "/email-change/revert", Handler: middlewares.SetMiddlewareJSON(user_controller.RevertEmailChange(s))},
+		},
+	}
 }
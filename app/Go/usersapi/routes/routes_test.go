@@ -0,0 +1,489 @@
+package routes_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/memory"
+	"go-ddd-cqrs-example/usersapi/export"
+	"go-ddd-cqrs-example/usersapi/monitoring"
+	"go-ddd-cqrs-example/usersapi/openapi"
+	"go-ddd-cqrs-example/usersapi/responses"
+	"go-ddd-cqrs-example/usersapi/routes"
+	"go-ddd-cqrs-example/usersapi/server"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+var _ = Describe("Routes", func() {
+	Specify("every registered route is described in the OpenAPI document and vice versa", func() {
+		doc, err := openapi.Load()
+		Expect(err).To(BeNil())
+
+		srv := &server.Server{Router: mux.NewRouter(), Metrics: monitoring.New()}
+		routes.InitializeRoutes(srv)
+
+		registered := map[string]bool{}
+		err = srv.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return err
+			}
+
+			// The version prefixes of the subrouters match every method.
+			methods, err := route.GetMethods()
+			if err != nil {
+				return nil
+			}
+
+			for _, method := range methods {
+				registered[method+" "+path] = true
+			}
+
+			return nil
+		})
+		Expect(err).To(BeNil())
+
+		documented := map[string]bool{}
+		for path, item := range doc.Paths {
+			for method := range item.Operations() {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+
+		Expect(registered).NotTo(BeEmpty())
+		Expect(registered).To(Equal(documented))
+	})
+
+	Describe("Serving the versions of the API", func() {
+		var (
+			srv    *server.Server
+			sender *recordingSender
+		)
+
+		BeforeEach(func() {
+			doc, err := openapi.Load()
+			Expect(err).To(BeNil())
+			validator, err := openapi.NewValidator(doc)
+			Expect(err).To(BeNil())
+			validator.ValidateResponses = true
+
+			repo := memory.NewUserRepository()
+			srv = &server.Server{
+				Router:     mux.NewRouter(),
+				Users:      repo,
+				UnitOfWork: memory.NewUnitOfWork(repo, &memory.Publisher{}),
+				Keys:       server.NewSigningKeys("secret"),
+				Metrics:    monitoring.New(),
+				Validator:  validator,
+			}
+			sender = &recordingSender{}
+			srv.Mailer = sender
+			srv.EmailChangeURL = "https://localhost:8000/email-change/verify"
+			srv.EmailRevertURL = "https://localhost:8000/email-change/revert"
+			srv.Commands = user.NewCommandBus(srv.UnitOfWork)
+			srv.Queries = user.NewQueryBus(srv.Users)
+			routes.InitializeRoutes(srv)
+		})
+
+		serveIfMatch := func(method, path, token, ifMatch string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+			payload, err := json.Marshal(body)
+			Expect(err).To(BeNil())
+
+			req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+
+			res := httptest.NewRecorder()
+			srv.Router.ServeHTTP(res, req)
+
+			responseMap := map[string]interface{}{}
+			Expect(json.Unmarshal(res.Body.Bytes(), &responseMap)).To(Succeed())
+
+			return res, responseMap
+		}
+
+		serve := func(method, path, token string, body interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+			return serveIfMatch(method, path, token, "", body)
+		}
+
+		register := func() string {
+			res, responseMap := serve("POST", "/v1/register", "", map[string]string{"email_address": "user@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusCreated))
+
+			return responseMap["token"].(string)
+		}
+
+		Specify("the legacy routes behave like the v1 ones and announce their deprecation", func() {
+			token := register()
+
+			res, responseMap := serve("POST", "/api/login", "", map[string]string{"email_address": "user@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap["token"]).NotTo(BeEmpty())
+			Expect(res.Header().Get("Deprecation")).To(Equal("@1790812800"))
+			Expect(res.Header().Get("Sunset")).To(Equal("Thu, 01 Apr 2027 00:00:00 GMT"))
+			Expect(res.Header().Get("Link")).To(Equal(`</v1/login>; rel="successor-version"`))
+
+			res, _ = serve("POST", "/v1/deactivate/current", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Deprecation")).To(BeEmpty())
+		})
+
+		Specify("the current user is served by the legacy routes too", func() {
+			token := register()
+
+			res, responseMap := serve("GET", "/api/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap["email_address"]).To(Equal("user@example.com"))
+			Expect(res.Header().Get("ETag")).To(Equal(`"1"`))
+			Expect(res.Header().Get("Deprecation")).To(Equal("@1790812800"))
+			Expect(res.Header().Get("Link")).To(Equal(`</v2/users/me>; rel="successor-version"`))
+
+			res, responseMap = serveIfMatch("PATCH", "/api/users/me", token, `"1"`, map[string]string{"display_name": "Jane Doe"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap["display_name"]).To(Equal("Jane Doe"))
+			Expect(res.Header().Get("ETag")).To(Equal(`"2"`))
+			Expect(res.Header().Get("Link")).To(Equal(`</v2/users/me>; rel="successor-version"`))
+
+			res, responseMap = serve("DELETE", "/api/users/me", token, map[string]string{"password": "password"})
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			Expect(responseMap["status"]).To(Equal("inactive"))
+			Expect(res.Header().Get("Link")).To(Equal(`</v2/users/me>; rel="successor-version"`))
+		})
+
+		Specify("the current user is a v2 resource changing status with the updates", func() {
+			token := register()
+
+			res, responseMap := serve("GET", "/v2/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap["email_address"]).To(Equal("user@example.com"))
+			Expect(responseMap["status"]).To(Equal("active"))
+			Expect(responseMap["version"]).To(BeEquivalentTo(1))
+
+			samples := []struct {
+				status  string
+				version int
+			}{
+				{status: "inactive", version: 2},
+				// Setting the current status is a no-op.
+				{status: "inactive", version: 2},
+				{status: "active", version: 3},
+			}
+
+			for _, sample := range samples {
+				res, responseMap = serve("PATCH", "/v2/users/me", token, map[string]string{"status": sample.status})
+				Expect(res.Code).To(Equal(http.StatusOK))
+				Expect(responseMap["status"]).To(Equal(sample.status))
+				Expect(responseMap["version"]).To(BeEquivalentTo(sample.version))
+			}
+		})
+
+		Specify("the profile of the current user is updated at the version of its ETag", func() {
+			token := register()
+
+			res, responseMap := serve("GET", "/v2/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("ETag")).To(Equal(`"1"`))
+			Expect(responseMap["display_name"]).To(BeEmpty())
+
+			profile := map[string]string{"display_name": "Jane Doe", "locale": "en-GB", "timezone": "Europe/London"}
+			res, responseMap = serveIfMatch("PATCH", "/v2/users/me", token, `"1"`, profile)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("ETag")).To(Equal(`"2"`))
+			Expect(responseMap["display_name"]).To(Equal("Jane Doe"))
+			Expect(responseMap["locale"]).To(Equal("en-GB"))
+			Expect(responseMap["timezone"]).To(Equal("Europe/London"))
+
+			// The update is rejected once the user has changed since the ETag was read.
+			res, responseMap = serveIfMatch("PATCH", "/v2/users/me", token, `"1"`, map[string]string{"display_name": "John Doe"})
+			Expect(res.Code).To(Equal(http.StatusPreconditionFailed))
+			Expect(responseMap["code"]).To(Equal(responses.CodePreconditionFailed))
+
+			res, responseMap = serveIfMatch("PATCH", "/v2/users/me", token, `"2"`, map[string]string{"avatar_url": "https://example.com/avatar.png", "status": "inactive"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("ETag")).To(Equal(`"4"`))
+			Expect(responseMap["avatar_url"]).To(Equal("https://example.com/avatar.png"))
+			Expect(responseMap["display_name"]).To(Equal("Jane Doe"))
+			Expect(responseMap["status"]).To(Equal("inactive"))
+
+			// The weak tags never match, and the malformed headers are rejected before the user is read.
+			samples := []struct {
+				ifMatch string
+				status  int
+				code    string
+			}{
+				{`W/"4"`, http.StatusPreconditionFailed, responses.CodePreconditionFailed},
+				{`"four"`, http.StatusPreconditionFailed, responses.CodePreconditionFailed},
+				{`"3", W/"4"`, http.StatusPreconditionFailed, responses.CodePreconditionFailed},
+				{`4`, http.StatusBadRequest, responses.CodeMalformedRequest},
+				{`"4`, http.StatusBadRequest, responses.CodeMalformedRequest},
+				{`"4", *`, http.StatusBadRequest, responses.CodeMalformedRequest},
+			}
+
+			for _, sample := range samples {
+				res, responseMap = serveIfMatch("PATCH", "/v2/users/me", token, sample.ifMatch, map[string]string{"display_name": "John Doe"})
+				Expect(res.Code).To(Equal(sample.status))
+				Expect(responseMap["code"]).To(Equal(sample.code))
+			}
+
+			res, _ = serveIfMatch("PATCH", "/v2/users/me", token, `"3", "4"`, map[string]string{"display_name": "John Doe"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("ETag")).To(Equal(`"5"`))
+
+			res, _ = serveIfMatch("PATCH", "/v2/users/me", token, "*", map[string]string{"display_name": "Jane Doe"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("ETag")).To(Equal(`"6"`))
+		})
+
+		Specify("the email address is changed once verified and restored with the revert link", func() {
+			token := register()
+
+			samples := []struct {
+				request map[string]string
+				code    string
+			}{
+				{map[string]string{"email_address": "new@example.com", "password": "wrongPassword"}, responses.CodeInvalidCredentials},
+				{map[string]string{"email_address": "User@example.com", "password": "password"}, responses.CodeValidationFailed},
+				{map[string]string{"email_address": "new@example.com"}, responses.CodeValidationFailed},
+			}
+
+			for _, sample := range samples {
+				res, responseMap := serve("POST", "/v2/users/me/email-change", token, sample.request)
+				Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(responseMap["code"]).To(Equal(sample.code))
+			}
+			Expect(sender.sent).To(BeEmpty())
+
+			res, _ := serve("POST", "/v2/users/me/email-change", token, map[string]string{"email_address": "New@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			Expect(sender.sent).To(HaveLen(1))
+			Expect(sender.sent[0].to).To(Equal("new@example.com"))
+			verificationToken := sender.token(0)
+
+			// The links are neither bearer tokens nor interchangeable.
+			res, _ = serve("GET", "/v2/users/me", verificationToken, nil)
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+			res, responseMap := serve("POST", "/v2/email-change/revert", "", map[string]string{"token": verificationToken})
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseMap["code"]).To(Equal(responses.CodeInvalidEmailChangeLink))
+
+			res, _ = serve("POST", "/v2/email-change/verify", "", map[string]string{"token": verificationToken})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(sender.sent).To(HaveLen(2))
+			Expect(sender.sent[1].to).To(Equal("user@example.com"))
+			Expect(sender.sent[1].body).To(ContainSubstring("new@example.com"))
+			revertToken := sender.token(1)
+
+			res, responseMap = serve("GET", "/v2/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap["email_address"]).To(Equal("new@example.com"))
+
+			// Every link is single-use.
+			res, responseMap = serve("POST", "/v2/email-change/verify", "", map[string]string{"token": verificationToken})
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseMap["code"]).To(Equal(responses.CodeInvalidEmailChangeLink))
+
+			// The later changes of the user do not keep the owner of the old email address from reverting.
+			res, _ = serve("PATCH", "/v2/users/me", token, map[string]string{"display_name": "Someone Else"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			res, _ = serve("POST", "/v2/email-change/revert", "", map[string]string{"token": revertToken})
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			res, _ = serve("POST", "/v1/login", "", map[string]string{"email_address": "user@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			res, _ = serve("POST", "/v2/email-change/revert", "", map[string]string{"token": revertToken})
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+
+			// The verification link is not replayed once the user is back to the old email address.
+			res, responseMap = serve("POST", "/v2/email-change/verify", "", map[string]string{"token": verificationToken})
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseMap["code"]).To(Equal(responses.CodeInvalidEmailChangeLink))
+
+			res, responseMap = serve("GET", "/v2/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap["email_address"]).To(Equal("user@example.com"))
+		})
+
+		Specify("the email address cannot be changed to a taken one", func() {
+			token := register()
+
+			res, _ := serve("POST", "/v1/register", "", map[string]string{"email_address": "taken@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusCreated))
+
+			res, responseMap := serve("POST", "/v2/users/me/email-change", token, map[string]string{"email_address": "taken@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusConflict))
+			Expect(responseMap["code"]).To(Equal(responses.CodeUserAlreadyExists))
+			Expect(sender.sent).To(BeEmpty())
+		})
+
+		Specify("the current user is deactivated until its erasure unless activated in the meantime", func() {
+			token := register()
+
+			res, responseMap := serve("DELETE", "/v2/users/me", token, map[string]string{"password": "wrongPassword"})
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(responseMap["code"]).To(Equal(responses.CodeInvalidCredentials))
+
+			res, responseMap = serve("DELETE", "/v2/users/me", token, map[string]string{"password": "password"})
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			Expect(res.Header().Get("ETag")).To(Equal(`"2"`))
+			Expect(responseMap["status"]).To(Equal("inactive"))
+			Expect(responseMap["erase_after"]).NotTo(BeEmpty())
+
+			res, responseMap = serve("PATCH", "/v2/users/me", token, map[string]string{"status": "active"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(responseMap).NotTo(HaveKey("erase_after"))
+
+			res, _ = serve("DELETE", "/v2/users/me", token, map[string]string{"password": "password"})
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+
+			res, responseMap = serve("GET", "/v2/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			userID, err := uuid.FromString(responseMap["id"].(string))
+			Expect(err).To(BeNil())
+
+			_, err = srv.Commands.Dispatch(bus.WithActor(context.Background(), bus.SystemActor), user.EraseUser{
+				UserID: userID,
+				Reason: user.ErasureReasonOperator,
+			})
+			Expect(err).To(BeNil())
+
+			res, _ = serve("GET", "/v2/users/me", token, nil)
+			Expect(res.Code).To(Equal(http.StatusNotFound))
+
+			res, _ = serve("POST", "/v1/login", "", map[string]string{"email_address": "user@example.com", "password": "password"})
+			Expect(res.Code).NotTo(Equal(http.StatusOK))
+		})
+
+		Specify("the personal data of the current user is exported to an archive downloaded with a time-limited link", func() {
+			token := register()
+
+			dir, err := ioutil.TempDir("", "exports")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			srv.Exports, err = export.New(dir, export.ProfileSection(srv.Queries), export.HistorySection(srv.Queries), export.LoginHistorySection(srv.Queries))
+			Expect(err).To(BeNil())
+			defer srv.Exports.Close(context.Background())
+
+			res, _ := serve("POST", "/v1/login", "", map[string]string{"email_address": "user@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusOK))
+
+			res, responseMap := serve("POST", "/v2/users/me/export", token, nil)
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			Expect(responseMap["status"]).To(Equal(export.StatusPending))
+			location := res.Header().Get("Location")
+			Expect(location).To(Equal("/v2/users/me/exports/" + responseMap["id"].(string)))
+
+			Eventually(func() interface{} {
+				_, responseMap = serve("GET", location, token, nil)
+				return responseMap["status"]
+			}).Should(Equal(export.StatusReady))
+			downloadURL := responseMap["download_url"].(string)
+
+			res, responseMap = serve("POST", "/v1/register", "", map[string]string{"email_address": "other@example.com", "password": "password"})
+			Expect(res.Code).To(Equal(http.StatusCreated))
+			res, responseMap = serve("GET", location, responseMap["token"].(string), nil)
+			Expect(res.Code).To(Equal(http.StatusNotFound))
+			Expect(responseMap["code"]).To(Equal(responses.CodeExportNotFound))
+
+			download := func(url string) *httptest.ResponseRecorder {
+				res := httptest.NewRecorder()
+				srv.Router.ServeHTTP(res, httptest.NewRequest("GET", url, nil))
+				return res
+			}
+
+			res = download(strings.Replace(downloadURL, "token=", "token=x", 1))
+			Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(res.Body.String()).To(ContainSubstring(responses.CodeInvalidDownloadLink))
+
+			res = download(downloadURL)
+			Expect(res.Code).To(Equal(http.StatusOK))
+			Expect(res.Header().Get("Content-Type")).To(Equal("application/zip"))
+			Expect(res.Header().Get("Content-Disposition")).To(HavePrefix("attachment"))
+
+			archive, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+			Expect(err).To(BeNil())
+			names := []string{}
+			logins := []user.Login{}
+			for _, file := range archive.File {
+				names = append(names, file.Name)
+				if file.Name == "login_history.json" {
+					content, err := file.Open()
+					Expect(err).To(BeNil())
+					Expect(json.NewDecoder(content).Decode(&logins)).To(BeNil())
+					content.Close()
+				}
+			}
+			Expect(names).To(Equal([]string{"profile.json", "history.json", "login_history.json"}))
+			Expect(logins).To(HaveLen(1))
+			Expect(logins[0].Method).To(Equal(user.LoginMethodPassword))
+
+			// The legacy route requests a new export once the previous one is ready.
+			res, responseMap = serve("POST", "/api/users/me/export", token, nil)
+			Expect(res.Code).To(Equal(http.StatusAccepted))
+			Expect(res.Header().Get("Location")).To(Equal("/v2/users/me/exports/" + responseMap["id"].(string)))
+			Expect(res.Header().Get("Link")).To(Equal(`</v2/users/me/export>; rel="successor-version"`))
+		})
+
+		Specify("the updates of the current user are validated", func() {
+			token := register()
+
+			samples := []interface{}{
+				map[string]string{"status": "deleted"},
+				map[string]string{"is_active": "true"},
+				map[string]string{"locale": "english"},
+				map[string]string{"timezone": "Mars/Olympus"},
+			}
+
+			for _, sample := range samples {
+				res, responseMap := serve("PATCH", "/v2/users/me", token, sample)
+				Expect(res.Code).To(Equal(http.StatusUnprocessableEntity))
+				Expect(responseMap["code"]).To(Equal(responses.CodeValidationFailed))
+			}
+
+			res, responseMap := serve("GET", "/v2/users/me", "", nil)
+			Expect(res.Code).To(Equal(http.StatusUnauthorized))
+			Expect(responseMap["code"]).To(Equal(responses.CodeUnauthorized))
+		})
+	})
+})
+
+// recordingSender keeps the sent emails instead of delivering them.
+type recordingSender struct {
+	sent []email
+}
+
+type email struct {
+	to      string
+	subject string
+	body    string
+}
+
+func (s *recordingSender) Send(to, subject, body string) error {
+	s.sent = append(s.sent, email{to: to, subject: subject, body: body})
+
+	return nil
+}
+
+// token of the link in the body of the email sent at the given index.
+func (s *recordingSender) token(i int) string {
+	body := s.sent[i].body
+
+	return body[strings.Index(body, "?token=")+len("?token="):]
+}
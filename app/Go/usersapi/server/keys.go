@@ -0,0 +1,44 @@
+package server
+
+import "sync"
+
+// SigningKeys of the JWT tokens, safe for concurrent use to be swapped on configuration reloads.
+// The tokens are signed with the current key, the previous keys still verify the tokens issued before a rotation.
+type SigningKeys struct {
+	mu       sync.RWMutex
+	current  string
+	previous []string
+}
+
+// NewSigningKeys with the current key and the previous ones.
+func NewSigningKeys(current string, previous ...string) *SigningKeys {
+	keys := &SigningKeys{}
+	keys.Set(current, previous...)
+
+	return keys
+}
+
+// Set the current key and the previous ones.
+func (k *SigningKeys) Set(current string, previous ...string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.current = current
+	k.previous = append([]string{}, previous...)
+}
+
+// Current key signing the tokens.
+func (k *SigningKeys) Current() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.current
+}
+
+// Verification keys starting with the current one.
+func (k *SigningKeys) Verification() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return append([]string{k.current}, k.previous...)
+}
@@ -4,9 +4,19 @@ package server
 import (
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
-	"github.com/nsqio/go-nsq"
+	"go-ddd-cqrs-example/domain/bus"
+	"go-ddd-cqrs-example/domain/events"
+	"go-ddd-cqrs-example/domain/models/user"
+	"go-ddd-cqrs-example/domain/models/user/postgres"
+	"go-ddd-cqrs-example/platform/health"
+	"go-ddd-cqrs-example/usersapi/export"
+	"go-ddd-cqrs-example/usersapi/mailer"
+	"go-ddd-cqrs-example/usersapi/monitoring"
+	"go-ddd-cqrs-example/usersapi/openapi"
+	"go-ddd-cqrs-example/usersapi/ratelimit"
 	"io"
 	"net/http"
+	"time"
 )
 
 // HTTPClient interface to mock the network requests for test purposes.
@@ -18,10 +28,26 @@ type HTTPClient interface {
 // Server is a wrapper for the service context.
 type Server struct {
 	DB             *gorm.DB
+	Users          user.Repository
 	Router         *mux.Router
 	HTTPClient     HTTPClient
 	Port           string
-	SecretKey      string
+	Keys           *SigningKeys
 	TestAPIAddress string
-	EventEmitter   nsq.Producer
+	EventEmitter   events.Publisher
+	Subscriber     events.Subscriber
+	Relay          *postgres.Relay
+	UnitOfWork     user.UnitOfWork
+	Commands       *bus.Bus
+	Queries        *bus.Bus
+	Mailer         mailer.Sender
+	MagicLinkURL   string
+	EmailChangeURL string
+	EmailRevertURL string
+	RequestTimeout time.Duration
+	RateLimiter    *ratelimit.Limiter
+	Health         *health.Checker
+	Metrics        *monitoring.Metrics
+	Validator      *openapi.Validator
+	Exports        *export.Exporter
 }
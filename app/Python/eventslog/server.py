@@ -1,15 +1,35 @@
+import json
 import nsq
 
+# Only the user IDs of the events are logged, so that no personal data ends up in the logs and nothing is held on the erased users.
+def log_user_id(kind, message):
+    payload = json.loads(message.body)
+    # The payloads published before the envelopes were introduced are the events themselves.
+    event = payload.get("event", payload)
+    print (kind + ": " + str(event.get("UserID")))
+
 def new_user_handler(message):
-    print ("New: " + str(message.body))
+    log_user_id("New", message)
     return True
 
 def deactivated_user_handler(message):
-    print ("Deactivated: " + str(message.body))
+    log_user_id("Deactivated", message)
     return True
 
 def activated_user_handler(message):
-    print ("Activated: " + str(message.body))
+    log_user_id("Activated", message)
+    return True
+
+def updated_user_profile_handler(message):
+    log_user_id("Profile updated", message)
+    return True
+
+def changed_user_email_handler(message):
+    log_user_id("Email changed", message)
+    return True
+
+def erased_user_handler(message):
+    log_user_id("Erased", message)
     return True
 
 r1 = nsq.Reader(message_handler=new_user_handler,
@@ -24,4 +44,16 @@ r3 = nsq.Reader(message_handler=activated_user_handler,
         lookupd_http_addresses=['nsqlookupd:4161'],
         topic='activated_user', channel='events-python', lookupd_poll_interval=15)
 
-nsq.run()
\ No newline at end of file
+r4 = nsq.Reader(message_handler=updated_user_profile_handler,
+        lookupd_http_addresses=['nsqlookupd:4161'],
+        topic='updated_user_profile', channel='events-python', lookupd_poll_interval=15)
+
+r5 = nsq.Reader(message_handler=changed_user_email_handler,
+        lookupd_http_addresses=['nsqlookupd:4161'],
+        topic='changed_user_email', channel='events-python', lookupd_poll_interval=15)
+
+r6 = nsq.Reader(message_handler=erased_user_handler,
+        lookupd_http_addresses=['nsqlookupd:4161'],
+        topic='erased_user', channel='events-python', lookupd_poll_interval=15)
+
+nsq.run()